@@ -0,0 +1,107 @@
+package benchmarks
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"propagation-tx/sql"
+	"testing"
+	"time"
+)
+
+func newManager(b testing.TB) sql.TransactionManager {
+	factory, err := sql.NewCachedDBFactory(stubCreator{key: b.Name()})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return sql.NewTransactionManager(factory)
+}
+
+// inTransaction runs fn in a root transaction of tm
+func inTransaction(b testing.TB, tm sql.TransactionManager, fn func(ctx context.Context)) {
+	err := tm.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+		fn(ctx)
+		return nil
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+}
+
+func noop(context.Context, *gorm.DB) error {
+	return nil
+}
+
+func BenchmarkRootTransaction(b *testing.B) {
+	tm := newManager(b)
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = tm.Transaction(ctx, noop)
+	}
+}
+
+func BenchmarkRequiredJoin(b *testing.B) {
+	tm := newManager(b)
+	inTransaction(b, tm, func(ctx context.Context) {
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			_ = tm.Transaction(ctx, noop, sql.PropagationRequired)
+		}
+	})
+}
+
+func BenchmarkNestedSavepoint(b *testing.B) {
+	tm := newManager(b)
+	inTransaction(b, tm, func(ctx context.Context) {
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			_ = tm.Transaction(ctx, noop, sql.PropagationNested)
+		}
+	})
+}
+
+func BenchmarkNestedSingleStatement(b *testing.B) {
+	tm := newManager(b)
+	inTransaction(b, tm, func(ctx context.Context) {
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			_ = tm.Transaction(ctx, noop, sql.PropagationNested, sql.WithSingleStatement())
+		}
+	})
+}
+
+func BenchmarkContextLookup(b *testing.B) {
+	tm := newManager(b)
+	inTransaction(b, tm, func(ctx context.Context) {
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			_ = tm.GetDB(ctx)
+		}
+	})
+}
+
+func BenchmarkCachedFactory(b *testing.B) {
+	creator := stubCreator{key: b.Name()}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = sql.NewCachedDBFactory(creator)
+	}
+}
+
+func BenchmarkCachedQuery(b *testing.B) {
+	sql.SetQueryCache(sql.NewMemoryQueryCache())
+	defer sql.SetQueryCache(nil)
+	ctx := context.Background()
+	fetch := func(ctx context.Context) (int, error) { return 42, nil }
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = sql.CachedQuery(ctx, "answer", time.Minute, fetch)
+	}
+}
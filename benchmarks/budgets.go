@@ -0,0 +1,24 @@
+// Package benchmarks publishes the benchmarks of propagation-tx and the allocation budgets they are held to.
+// The benchmarks run against a stub database driver, so they measure the overhead of the library only:
+//
+//	go test ./benchmarks -bench .
+//
+// TestAllocationBudgets fails when a change makes a path allocate more than its budget, raise a budget
+// deliberately along with the change that needs it.
+package benchmarks
+
+// Allocations per operation allowed on the hot paths
+const (
+	// RootTransactionAllocs is the budget of a root transaction committing an empty bizFn
+	RootTransactionAllocs = 40
+	// RequiredJoinAllocs is the budget of a PropagationRequired call joining the ambient transaction
+	RequiredJoinAllocs = 10
+	// NestedSavepointAllocs is the budget of a PropagationNested call with its savepoint
+	NestedSavepointAllocs = 32
+	// ContextLookupAllocs is the budget of TransactionManager.GetDB inside a transaction
+	ContextLookupAllocs = 0
+	// CachedFactoryAllocs is the budget of NewCachedDBFactory for a cached datasource
+	CachedFactoryAllocs = 2
+	// CachedQueryAllocs is the budget of a CachedQuery hit on the MemoryQueryCache
+	CachedQueryAllocs = 2
+)
@@ -0,0 +1,46 @@
+package benchmarks
+
+import (
+	"context"
+	"propagation-tx/sql"
+	"testing"
+	"time"
+)
+
+func TestAllocationBudgets(t *testing.T) {
+	tm := newManager(t)
+	ctx := context.Background()
+	assertBudget(t, "root transaction", RootTransactionAllocs, func() {
+		_ = tm.Transaction(ctx, noop)
+	})
+	inTransaction(t, tm, func(ctx context.Context) {
+		assertBudget(t, "required join", RequiredJoinAllocs, func() {
+			_ = tm.Transaction(ctx, noop, sql.PropagationRequired)
+		})
+		assertBudget(t, "nested savepoint", NestedSavepointAllocs, func() {
+			_ = tm.Transaction(ctx, noop, sql.PropagationNested)
+		})
+		assertBudget(t, "context lookup", ContextLookupAllocs, func() {
+			_ = tm.GetDB(ctx)
+		})
+	})
+
+	creator := stubCreator{key: t.Name()}
+	assertBudget(t, "cached factory", CachedFactoryAllocs, func() {
+		_, _ = sql.NewCachedDBFactory(creator)
+	})
+
+	sql.SetQueryCache(sql.NewMemoryQueryCache())
+	defer sql.SetQueryCache(nil)
+	fetch := func(ctx context.Context) (int, error) { return 42, nil }
+	assertBudget(t, "cached query", CachedQueryAllocs, func() {
+		_, _ = sql.CachedQuery(ctx, "answer", time.Minute, fetch)
+	})
+}
+
+func assertBudget(t *testing.T, name string, budget int, fn func()) {
+	t.Helper()
+	if allocs := testing.AllocsPerRun(100, fn); allocs > float64(budget) {
+		t.Errorf("%s: %.0f allocs/op, budget is %d", name, allocs, budget)
+	}
+}
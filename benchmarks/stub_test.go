@@ -0,0 +1,76 @@
+package benchmarks
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"io"
+	"sync"
+)
+
+// stubDriver is a database/sql driver doing nothing, so the benchmarks measure the library and not the database
+type stubDriver struct{}
+
+type stubConn struct{}
+
+type stubTx struct{}
+
+type stubResult struct{}
+
+type stubRows struct{}
+
+func (stubDriver) Open(string) (driver.Conn, error) { return stubConn{}, nil }
+
+func (stubConn) Prepare(string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (stubConn) Close() error                        { return nil }
+func (stubConn) Begin() (driver.Tx, error)           { return stubTx{}, nil }
+func (stubConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	return stubTx{}, nil
+}
+func (stubConn) ExecContext(context.Context, string, []driver.NamedValue) (driver.Result, error) {
+	return stubResult{}, nil
+}
+func (stubConn) QueryContext(context.Context, string, []driver.NamedValue) (driver.Rows, error) {
+	return stubRows{}, nil
+}
+
+func (stubTx) Commit() error   { return nil }
+func (stubTx) Rollback() error { return nil }
+
+func (stubResult) LastInsertId() (int64, error) { return 1, nil }
+func (stubResult) RowsAffected() (int64, error) { return 1, nil }
+
+func (stubRows) Columns() []string         { return nil }
+func (stubRows) Close() error              { return nil }
+func (stubRows) Next([]driver.Value) error { return io.EOF }
+
+var registerStub sync.Once
+
+// openStubDB return a gorm.DB of the mysql dialect backed by stubDriver
+func openStubDB(dsn string) *gorm.DB {
+	registerStub.Do(func() {
+		sql.Register("propagation-tx-stub", stubDriver{})
+	})
+	sqlDB, err := sql.Open("propagation-tx-stub", dsn)
+	if err != nil {
+		panic(err)
+	}
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: sqlDB, SkipInitializeWithVersion: true}),
+		&gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		panic(err)
+	}
+	return db
+}
+
+// stubCreator is a CacheableDBCreator of stub databases
+type stubCreator struct {
+	key string
+}
+
+func (c stubCreator) CreateDB() (*gorm.DB, error) { return openStubDB(c.key), nil }
+func (c stubCreator) CacheKey() string            { return c.key }
+func (c stubCreator) CacheSource() string         { return "benchmarks" }
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// generate return the unformatted source of the decorator of pkg
+func generate(pkg *txPackage) ([]byte, error) {
+	// the packages of the generated code keep the names the signatures already use
+	nameOf := func(p, name string) string {
+		if used, ok := pkg.imports[p]; ok {
+			return used
+		}
+		pkg.imports[p] = name
+		return name
+	}
+	contextName := nameOf("context", "context")
+	gormName := nameOf("gorm.io/gorm", "gorm")
+	ptxName := nameOf("propagation-tx/sql", "ptx")
+	for _, m := range pkg.methods {
+		for i, option := range m.options {
+			option = ptxName + "." + strings.TrimPrefix(option, "ptx.")
+			if strings.Contains(option, "(stdsql.") {
+				option = strings.Replace(option, "(stdsql.", "("+nameOf("database/sql", "stdsql")+".", 1)
+			}
+			if strings.Contains(option, "Timeout(") {
+				option = strings.Replace(option, "time.", nameOf("time", "time")+".", 1)
+			}
+			m.options[i] = option
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by propagation-tx-gen. DO NOT EDIT.\n\npackage %s\n\nimport (\n", pkg.name)
+	paths := make([]string, 0, len(pkg.imports))
+	for p := range pkg.imports {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		if name := pkg.imports[p]; name != importName(p) {
+			fmt.Fprintf(&buf, "\t%s %q\n", name, p)
+		} else {
+			fmt.Fprintf(&buf, "\t%q\n", p)
+		}
+	}
+	buf.WriteString(")\n\n")
+
+	impl := pkg.typeName
+	if pkg.pointer {
+		impl = "*" + impl
+	}
+	decorator := "Transactional" + pkg.typeName
+	fmt.Fprintf(&buf, "// %s runs the methods of %s annotated with a tx directive in transactions of tm\n", decorator, pkg.typeName)
+	fmt.Fprintf(&buf, "type %s struct {\n\t%s\n\ttm %s.TransactionManager\n}\n\n", decorator, impl, ptxName)
+	fmt.Fprintf(&buf, "func New%s(impl %s, tm %s.TransactionManager) *%s {\n\treturn &%s{%s: impl, tm: tm}\n}\n",
+		decorator, impl, ptxName, decorator, decorator, pkg.typeName)
+
+	for _, m := range pkg.methods {
+		params := []string{"ctx " + contextName + ".Context"}
+		args := []string{"ctx"}
+		for i, typ := range m.params {
+			name := "a" + strconv.Itoa(i+1)
+			if m.variadic && i == len(m.params)-1 {
+				params = append(params, name+" ..."+typ)
+				args = append(args, name+"...")
+				continue
+			}
+			params = append(params, name+" "+typ)
+			args = append(args, name)
+		}
+		var results, assigned []string
+		for i, typ := range m.results {
+			name := "r" + strconv.Itoa(i)
+			results = append(results, name+" "+typ)
+			assigned = append(assigned, name)
+		}
+		results = append(results, "err error")
+		assigned = append(assigned, "err")
+
+		fmt.Fprintf(&buf, "\n// %s runs %s.%s in a transaction: //tx:%s\n", m.name, pkg.typeName, m.name, m.directive)
+		fmt.Fprintf(&buf, "func (t *%s) %s(%s) (%s) {\n", decorator, m.name, strings.Join(params, ", "), strings.Join(results, ", "))
+		fmt.Fprintf(&buf, "\terr = t.tm.Transaction(ctx, func(ctx %s.Context, _ *%s.DB) error {\n", contextName, gormName)
+		fmt.Fprintf(&buf, "\t\t%s = t.%s.%s(%s)\n\t\treturn err\n", strings.Join(assigned, ", "), pkg.typeName, m.name, strings.Join(args, ", "))
+		fmt.Fprintf(&buf, "\t}%s)\n\treturn\n}\n", strings.Join(append([]string{""}, m.options...), ", "))
+	}
+	return buf.Bytes(), nil
+}
+
+// durationExpr return the Go expression of a duration of a directive
+func durationExpr(value string) (string, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return "", fmt.Errorf("invalid duration %q", value)
+	}
+	for _, unit := range []struct {
+		d    time.Duration
+		name string
+	}{{time.Minute, "Minute"}, {time.Second, "Second"}, {time.Millisecond, "Millisecond"}} {
+		if d%unit.d == 0 {
+			return fmt.Sprintf("%d * time.%s", d/unit.d, unit.name), nil
+		}
+	}
+	return fmt.Sprintf("time.Duration(%d)", d), nil
+}
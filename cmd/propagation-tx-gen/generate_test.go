@@ -0,0 +1,146 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"go/format"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const service = `package orders
+
+import (
+	"context"
+	sqlx "database/sql"
+	"time"
+)
+
+type OrderService struct{}
+
+// Place places an order
+//
+//tx:required,name=place
+func (s *OrderService) Place(ctx context.Context, ids ...int64) error {
+	return nil
+}
+
+//tx:requires_new,readonly,isolation=serializable,statement_timeout=2s
+func (s *OrderService) Quote(ctx context.Context, id int64, at time.Time) (*sqlx.NullInt64, int, error) {
+	return nil, 0, nil
+}
+
+func (s *OrderService) Cancel(ctx context.Context, id int64) error {
+	return nil
+}
+`
+
+const decorator = `// Code generated by propagation-tx-gen. DO NOT EDIT.
+
+package orders
+
+import (
+	"context"
+	sqlx "database/sql"
+	"gorm.io/gorm"
+	ptx "propagation-tx/sql"
+	"time"
+)
+
+// TransactionalOrderService runs the methods of OrderService annotated with a tx directive in transactions of tm
+type TransactionalOrderService struct {
+	*OrderService
+	tm ptx.TransactionManager
+}
+
+func NewTransactionalOrderService(impl *OrderService, tm ptx.TransactionManager) *TransactionalOrderService {
+	return &TransactionalOrderService{OrderService: impl, tm: tm}
+}
+
+// Place runs OrderService.Place in a transaction: //tx:required,name=place
+func (t *TransactionalOrderService) Place(ctx context.Context, a1 ...int64) (err error) {
+	err = t.tm.Transaction(ctx, func(ctx context.Context, _ *gorm.DB) error {
+		err = t.OrderService.Place(ctx, a1...)
+		return err
+	}, ptx.PropagationRequired, ptx.WithName("place"))
+	return
+}
+
+// Quote runs OrderService.Quote in a transaction: //tx:requires_new,readonly,isolation=serializable,statement_timeout=2s
+func (t *TransactionalOrderService) Quote(ctx context.Context, a1 int64, a2 time.Time) (r0 *sqlx.NullInt64, r1 int, err error) {
+	err = t.tm.Transaction(ctx, func(ctx context.Context, _ *gorm.DB) error {
+		r0, r1, err = t.OrderService.Quote(ctx, a1, a2)
+		return err
+	}, ptx.PropagationRequiresNew, ptx.WithReadOnly(true), ptx.WithIsolation(sqlx.LevelSerializable), ptx.WithStatementTimeout(2*time.Second))
+	return
+}
+`
+
+// writePackage writes the files of a package to a temporary directory and return it
+func writePackage(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestGenerate(t *testing.T) {
+	// the output of a previous run is skipped
+	dir := writePackage(t, map[string]string{"service.go": service, "orderservice_tx.go": decorator})
+	pkg, err := parsePackage(dir, "OrderService")
+	assert.NoError(t, err)
+	src, err := generate(pkg)
+	assert.NoError(t, err)
+	formatted, err := format.Source(src)
+	assert.NoError(t, err)
+	assert.Equal(t, decorator, string(formatted))
+}
+
+func TestParsePackage_Errors(t *testing.T) {
+	for name, method := range map[string]string{
+		"no directive":   "func (s *OrderService) Place(ctx context.Context) error { return nil }",
+		"no ctx":         "//tx:required\nfunc (s *OrderService) Place(id int64) error { return nil }",
+		"no error":       "//tx:required\nfunc (s *OrderService) Place(ctx context.Context) int { return 0 }",
+		"bad directive":  "//tx:required,nested\nfunc (s *OrderService) Place(ctx context.Context) error { return nil }",
+		"unknown import": "//tx:required\nfunc (s *OrderService) Place(ctx context.Context, at orders.Order) error { return nil }",
+	} {
+		dir := writePackage(t, map[string]string{"service.go": "package orders\n\nimport \"context\"\n\ntype OrderService struct{}\n\n" +
+			method + "\n\nvar _ = context.Background\n"})
+		_, err := parsePackage(dir, "OrderService")
+		assert.Error(t, err, name)
+	}
+}
+
+func TestParseDirective(t *testing.T) {
+	for directive, options := range map[string][]string{
+		"required":                 {"ptx.PropagationRequired"},
+		"nested, readonly":         {"ptx.PropagationNested", "ptx.WithReadOnly(true)"},
+		"isolation=read_committed": {"ptx.WithIsolation(stdsql.LevelReadCommitted)"},
+		"name=place order":         {`ptx.WithName("place order")`},
+		"lock_timeout=1500ms":      {"ptx.WithLockTimeout(1500 * time.Millisecond)"},
+		"statement_timeout=1m":     {"ptx.WithStatementTimeout(1 * time.Minute)"},
+		"read_retry=3":             {"ptx.WithReadRetry(3)"},
+	} {
+		got, err := parseDirective(directive)
+		assert.NoError(t, err, directive)
+		assert.Equal(t, options, got, directive)
+	}
+	for _, directive := range []string{"required,never", "isolation=snapshot", "lock_timeout=soon", "read_retry=x", "retry"} {
+		_, err := parseDirective(directive)
+		assert.Error(t, err, directive)
+	}
+}
+
+func TestImportName(t *testing.T) {
+	for p, name := range map[string]string{
+		"context":                    "context",
+		"github.com/jackc/pgx/v5":    "pgx",
+		"github.com/go-redis/redis":  "redis",
+		"github.com/nats-io/nats.go": "nats",
+	} {
+		assert.Equal(t, name, importName(p), p)
+	}
+}
@@ -0,0 +1,66 @@
+// Command propagation-tx-gen generates declarative transactions: for a type whose methods are annotated with a
+// tx directive, it writes a decorator type running each annotated method in tm.Transaction with the options of
+// its directive.
+//
+//	//go:generate propagation-tx-gen -type OrderService
+//
+//	//tx:requires_new,readonly,isolation=serializable
+//	func (s *OrderService) Quote(ctx context.Context, id int64) (*Quote, error)
+//
+// generates TransactionalOrderService in orderservice_tx.go, embedding *OrderService so the methods without
+// directive are passed through as they are. An annotated method must take a context.Context first and return an
+// error last: the ctx carries the transaction to the repositories, the error rolls it back.
+//
+// The directive is a comma separated list of
+//
+//	required, supports, mandatory, requires_new, not_supported, nested, never   the propagation
+//	readonly                                                                     sql.WithReadOnly(true)
+//	isolation=read_uncommitted|read_committed|repeatable_read|serializable       sql.WithIsolation
+//	name=<name>                                                                  sql.WithName
+//	statement_timeout=<duration>, lock_timeout=<duration>                        sql.WithStatementTimeout, sql.WithLockTimeout
+//	read_retry=<attempts>                                                        sql.WithReadRetry
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/format"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	typeName := flag.String("type", "", "name of the type whose annotated methods are decorated")
+	dir := flag.String("dir", ".", "directory of the package of the type")
+	output := flag.String("output", "", "path of the generated file, <type>_tx.go in dir if empty")
+	flag.Parse()
+	if *typeName == "" {
+		fmt.Fprintln(os.Stderr, "propagation-tx-gen: -type is required")
+		os.Exit(2)
+	}
+
+	pkg, err := parsePackage(*dir, *typeName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "propagation-tx-gen:", err)
+		os.Exit(1)
+	}
+	src, err := generate(pkg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "propagation-tx-gen:", err)
+		os.Exit(1)
+	}
+	formatted, err := format.Source(src)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "propagation-tx-gen: format generated code: %v\n%s", err, src)
+		os.Exit(1)
+	}
+	path := *output
+	if path == "" {
+		path = filepath.Join(*dir, strings.ToLower(*typeName)+"_tx.go")
+	}
+	if err := os.WriteFile(path, formatted, 0o644); err != nil {
+		fmt.Fprintln(os.Stderr, "propagation-tx-gen:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// directivePrefix starts the comment line annotating a method
+const directivePrefix = "//tx:"
+
+// txPackage is what the generation needs of the package of the type
+type txPackage struct {
+	name     string
+	typeName string
+	pointer  bool
+	methods  []*txMethod
+	// imports are the names of the import paths used by the signatures of the methods
+	imports map[string]string
+}
+
+// txMethod is an annotated method
+type txMethod struct {
+	name      string
+	directive string
+	params    []string
+	variadic  bool
+	// results are the types of the results but the last error
+	results []string
+	options []string
+}
+
+// parsePackage parses the package in dir and collects the annotated methods of typeName
+func parsePackage(dir, typeName string) (*txPackage, error) {
+	fset := token.NewFileSet()
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	pkg := &txPackage{typeName: typeName, imports: make(map[string]string)}
+	for _, name := range files {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, name, nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		if generated(file) {
+			continue
+		}
+		pkg.name = file.Name.Name
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Recv == nil || fn.Doc == nil {
+				continue
+			}
+			recv, pointer := receiverType(fn.Recv.List[0].Type)
+			if recv != typeName {
+				continue
+			}
+			directive := directiveOf(fn.Doc)
+			if directive == "" {
+				continue
+			}
+			pkg.pointer = pkg.pointer || pointer
+			m, err := parseMethod(fset, file, fn, directive, pkg.imports)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s.%s: %w", fset.Position(fn.Pos()), typeName, fn.Name.Name, err)
+			}
+			pkg.methods = append(pkg.methods, m)
+		}
+	}
+	if len(pkg.methods) == 0 {
+		return nil, fmt.Errorf("no method of %s in %s has a %s directive", typeName, dir, directivePrefix)
+	}
+	return pkg, nil
+}
+
+// generated tells whether file is generated code, like the output of a previous run
+func generated(file *ast.File) bool {
+	for _, group := range file.Comments {
+		if group.Pos() > file.Package {
+			return false
+		}
+		for _, c := range group.List {
+			if strings.HasPrefix(c.Text, "// Code generated ") && strings.HasSuffix(c.Text, " DO NOT EDIT.") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// receiverType return the name of the type of a receiver and whether it's a pointer
+func receiverType(expr ast.Expr) (string, bool) {
+	pointer := false
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr, pointer = star.X, true
+	}
+	// generic receivers aren't matched
+	if ident, ok := expr.(*ast.Ident); ok {
+		return ident.Name, pointer
+	}
+	return "", false
+}
+
+// directiveOf return the directive of a doc comment, empty if there is none
+func directiveOf(doc *ast.CommentGroup) string {
+	for _, c := range doc.List {
+		if strings.HasPrefix(c.Text, directivePrefix) {
+			return strings.TrimSpace(strings.TrimPrefix(c.Text, directivePrefix))
+		}
+	}
+	return ""
+}
+
+func parseMethod(fset *token.FileSet, file *ast.File, fn *ast.FuncDecl, directive string, imports map[string]string) (*txMethod, error) {
+	m := &txMethod{name: fn.Name.Name, directive: directive}
+	options, err := parseDirective(directive)
+	if err != nil {
+		return nil, err
+	}
+	m.options = options
+
+	var params []ast.Expr
+	for _, field := range fn.Type.Params.List {
+		for i := 0; i < len(field.Names) || i == 0 && len(field.Names) == 0; i++ {
+			params = append(params, field.Type)
+		}
+	}
+	if len(params) == 0 || !isContext(file, params[0]) {
+		return nil, fmt.Errorf("the first parameter must be a context.Context")
+	}
+	var results []ast.Expr
+	if fn.Type.Results != nil {
+		for _, field := range fn.Type.Results.List {
+			for i := 0; i < len(field.Names) || i == 0 && len(field.Names) == 0; i++ {
+				results = append(results, field.Type)
+			}
+		}
+	}
+	if len(results) == 0 || !isError(results[len(results)-1]) {
+		return nil, fmt.Errorf("the last result must be an error")
+	}
+
+	for i, expr := range params[1:] {
+		if ellipsis, ok := expr.(*ast.Ellipsis); ok && i == len(params)-2 {
+			m.variadic = true
+			expr = ellipsis.Elt
+		}
+		s, err := typeString(fset, file, expr, imports)
+		if err != nil {
+			return nil, err
+		}
+		m.params = append(m.params, s)
+	}
+	for _, expr := range results[:len(results)-1] {
+		s, err := typeString(fset, file, expr, imports)
+		if err != nil {
+			return nil, err
+		}
+		m.results = append(m.results, s)
+	}
+	return m, nil
+}
+
+// propagations are the propagations of the directives
+var propagations = map[string]string{
+	"required":      "PropagationRequired",
+	"supports":      "PropagationSupports",
+	"mandatory":     "PropagationMandatory",
+	"requires_new":  "PropagationRequiresNew",
+	"not_supported": "PropagationNotSupported",
+	"nested":        "PropagationNested",
+	"never":         "PropagationNever",
+}
+
+var isolationLevels = map[string]string{
+	"read_uncommitted": "LevelReadUncommitted",
+	"read_committed":   "LevelReadCommitted",
+	"repeatable_read":  "LevelRepeatableRead",
+	"serializable":     "LevelSerializable",
+}
+
+// parseDirective return the TxOption expressions of a directive, ptx being propagation-tx/sql and stdsql
+// database/sql
+func parseDirective(directive string) ([]string, error) {
+	var options []string
+	propagation := false
+	for _, item := range strings.Split(directive, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(item), "=")
+		if p, ok := propagations[key]; ok {
+			if propagation {
+				return nil, fmt.Errorf("more than one propagation in %q", directive)
+			}
+			propagation = true
+			options = append(options, "ptx."+p)
+			continue
+		}
+		switch key {
+		case "readonly":
+			options = append(options, "ptx.WithReadOnly(true)")
+		case "isolation":
+			level, ok := isolationLevels[value]
+			if !ok {
+				return nil, fmt.Errorf("unknown isolation %q", value)
+			}
+			options = append(options, "ptx.WithIsolation(stdsql."+level+")")
+		case "name":
+			options = append(options, "ptx.WithName("+strconv.Quote(value)+")")
+		case "statement_timeout", "lock_timeout":
+			d, err := durationExpr(value)
+			if err != nil {
+				return nil, err
+			}
+			if key == "statement_timeout" {
+				options = append(options, "ptx.WithStatementTimeout("+d+")")
+			} else {
+				options = append(options, "ptx.WithLockTimeout("+d+")")
+			}
+		case "read_retry":
+			attempts, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid read_retry %q", value)
+			}
+			options = append(options, "ptx.WithReadRetry("+strconv.Itoa(attempts)+")")
+		default:
+			return nil, fmt.Errorf("unknown directive item %q", item)
+		}
+	}
+	return options, nil
+}
+
+// isContext tells whether expr is context.Context
+func isContext(file *ast.File, expr ast.Expr) bool {
+	sel, ok := expr.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Context" {
+		return false
+	}
+	x, ok := sel.X.(*ast.Ident)
+	return ok && importPath(file, x.Name) == "context"
+}
+
+func isError(expr ast.Expr) bool {
+	ident, ok := expr.(*ast.Ident)
+	return ok && ident.Name == "error"
+}
+
+// importPath return the path of the import of file named name, empty if there is none
+func importPath(file *ast.File, name string) string {
+	for _, spec := range file.Imports {
+		p, _ := strconv.Unquote(spec.Path.Value)
+		if spec.Name != nil && spec.Name.Name == name || spec.Name == nil && importName(p) == name {
+			return p
+		}
+	}
+	return ""
+}
+
+// importName return the package name assumed for an import path without name: its last element, without the
+// major version suffix
+func importName(p string) string {
+	base := path.Base(p)
+	if strings.HasPrefix(base, "v") {
+		if _, err := strconv.Atoi(base[1:]); err == nil && path.Dir(p) != "." {
+			base = path.Base(path.Dir(p))
+		}
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(base, "go-"), ".go")
+}
+
+// typeString return the source of expr, recording in imports the paths of the packages it refers to
+func typeString(fset *token.FileSet, file *ast.File, expr ast.Expr, imports map[string]string) (string, error) {
+	var err error
+	ast.Inspect(expr, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if x, ok := sel.X.(*ast.Ident); ok {
+			p := importPath(file, x.Name)
+			if p == "" {
+				err = fmt.Errorf("no import for %s", x.Name)
+			} else if name, ok := imports[p]; ok && name != x.Name {
+				err = fmt.Errorf("%s is imported as %s and %s", p, name, x.Name)
+			} else {
+				imports[p] = x.Name
+			}
+		}
+		return false
+	})
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, fset, expr); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
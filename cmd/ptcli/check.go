@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"propagation-tx/sql"
+	"strings"
+)
+
+// requiredPrivileges are the privileges a business account needs on its database
+var requiredPrivileges = []string{"SELECT", "INSERT", "UPDATE", "DELETE"}
+
+var errDryRun = errors.New("dry run, rollback")
+
+type checkResult struct {
+	name   string
+	ok     bool
+	detail string
+}
+
+func (r checkResult) String() string {
+	status := "OK"
+	if !r.ok {
+		status = "FAIL"
+	}
+	return fmt.Sprintf("[%s] %s: %s", status, r.name, r.detail)
+}
+
+func checkDatasource(config *sql.ConnConfig) []checkResult {
+	if config.Database == "" {
+		return []checkResult{{name: "config", detail: "database must be set"}}
+	}
+	factory, err := sql.NewConfigDBFactory(config)
+	if err == nil {
+		err = ping(factory.GetOriginDB())
+	}
+	if err != nil {
+		return []checkResult{{name: "connect", detail: err.Error()}}
+	}
+	db := factory.GetOriginDB()
+	results := []checkResult{
+		{name: "connect", ok: true, detail: fmt.Sprintf("%s:%d/%s", config.Host, config.Port, config.Database)},
+		checkPrivileges(db),
+		checkSavepoint(db),
+		checkIsolation(db),
+	}
+	return append(results, checkPropagationMatrix(sql.NewTransactionManager(factory))...)
+}
+
+func ping(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Ping()
+}
+
+func checkPrivileges(db *gorm.DB) checkResult {
+	var grants []string
+	if err := db.Raw("SHOW GRANTS").Scan(&grants).Error; err != nil {
+		return checkResult{name: "privileges", detail: err.Error()}
+	}
+	granted := strings.ToUpper(strings.Join(grants, "\n"))
+	if strings.Contains(granted, "ALL PRIVILEGES") {
+		return checkResult{name: "privileges", ok: true, detail: "ALL PRIVILEGES"}
+	}
+	var missing []string
+	for _, privilege := range requiredPrivileges {
+		if !strings.Contains(granted, privilege) {
+			missing = append(missing, privilege)
+		}
+	}
+	if len(missing) > 0 {
+		return checkResult{name: "privileges", detail: "missing " + strings.Join(missing, ", ")}
+	}
+	return checkResult{name: "privileges", ok: true, detail: strings.Join(requiredPrivileges, ", ")}
+}
+
+func checkSavepoint(db *gorm.DB) checkResult {
+	tx := db.Begin()
+	if tx.Error != nil {
+		return checkResult{name: "savepoint", detail: tx.Error.Error()}
+	}
+	defer tx.Rollback()
+	if err := tx.SavePoint("ptcli_check").Error; err != nil {
+		return checkResult{name: "savepoint", detail: err.Error()}
+	}
+	if err := tx.RollbackTo("ptcli_check").Error; err != nil {
+		return checkResult{name: "savepoint", detail: err.Error()}
+	}
+	return checkResult{name: "savepoint", ok: true, detail: "supported"}
+}
+
+func checkIsolation(db *gorm.DB) checkResult {
+	var isolation string
+	// transaction_isolation since MySQL 5.7.20, tx_isolation before
+	err := db.Raw("SELECT @@transaction_isolation").Scan(&isolation).Error
+	if err != nil {
+		err = db.Raw("SELECT @@tx_isolation").Scan(&isolation).Error
+	}
+	if err != nil {
+		return checkResult{name: "isolation", detail: err.Error()}
+	}
+	return checkResult{name: "isolation", ok: true, detail: "default " + isolation}
+}
+
+type matrixCase struct {
+	propagation sql.TransactionPropagation
+	nested      bool
+	wantErr     error
+	wantTx      bool
+}
+
+var propagationMatrix = []matrixCase{
+	{propagation: sql.PropagationRequired, wantTx: true},
+	{propagation: sql.PropagationRequired, nested: true, wantTx: true},
+	{propagation: sql.PropagationSupports},
+	{propagation: sql.PropagationSupports, nested: true, wantTx: true},
+	{propagation: sql.PropagationMandatory, wantErr: sql.ErrMandatoryPropWithoutTransaction},
+	{propagation: sql.PropagationMandatory, nested: true, wantTx: true},
+	{propagation: sql.PropagationRequiresNew, wantTx: true},
+	{propagation: sql.PropagationRequiresNew, nested: true, wantTx: true},
+	{propagation: sql.PropagationNotSupported},
+	{propagation: sql.PropagationNotSupported, nested: true},
+	{propagation: sql.PropagationNested, wantTx: true},
+	{propagation: sql.PropagationNested, nested: true, wantTx: true},
+	{propagation: sql.PropagationNever},
+	{propagation: sql.PropagationNever, nested: true, wantErr: sql.ErrNeverPropInTransaction},
+}
+
+// checkPropagationMatrix runs every propagation with and without an outer transaction, only reading
+// and rolling the outer transaction back, and compares the outcome with the expected one
+func checkPropagationMatrix(tm sql.TransactionManager) []checkResult {
+	results := make([]checkResult, 0, len(propagationMatrix))
+	for _, c := range propagationMatrix {
+		name := "propagation " + c.propagation.String()
+		if c.nested {
+			name += " in transaction"
+		}
+		inTx, err := runMatrixCase(tm, c)
+		switch {
+		case !errors.Is(err, c.wantErr):
+			results = append(results, checkResult{name: name, detail: fmt.Sprintf("got error %v, want %v", err, c.wantErr)})
+		case c.wantErr == nil && inTx != c.wantTx:
+			results = append(results, checkResult{name: name, detail: fmt.Sprintf("got in transaction %t, want %t", inTx, c.wantTx)})
+		default:
+			results = append(results, checkResult{name: name, ok: true, detail: "as expected"})
+		}
+	}
+	return results
+}
+
+func runMatrixCase(tm sql.TransactionManager, c matrixCase) (inTx bool, err error) {
+	inner := func(ctx context.Context) error {
+		return tm.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+			_, inTx = tx.Statement.ConnPool.(gorm.TxCommitter)
+			return tx.Exec("SELECT 1").Error
+		}, c.propagation)
+	}
+	if !c.nested {
+		return inTx, inner(context.Background())
+	}
+	err = tm.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+		if err := inner(ctx); err != nil {
+			return err
+		}
+		return errDryRun
+	}, sql.PropagationRequired)
+	if errors.Is(err, errDryRun) {
+		err = nil
+	}
+	return inTx, err
+}
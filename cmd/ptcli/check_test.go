@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	stdsql "database/sql"
+	"database/sql/driver"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"io"
+	"os"
+	"path/filepath"
+	"propagation-tx/sql"
+	"sync"
+	"testing"
+)
+
+// scriptedDriver is a database/sql driver answering the queries with the rows of a single column scripted for
+// them, the statements scripted with an error fail
+type scriptedDriver struct {
+	mu     sync.Mutex
+	rows   map[string][]string
+	errs   map[string]error
+	execed []string
+}
+
+type scriptedConn struct {
+	d *scriptedDriver
+}
+
+type scriptedTx struct{}
+
+type scriptedRows struct {
+	values []string
+}
+
+func (d *scriptedDriver) Open(string) (driver.Conn, error) { return scriptedConn{d: d}, nil }
+
+func (c scriptedConn) Prepare(string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (c scriptedConn) Close() error                        { return nil }
+func (c scriptedConn) Begin() (driver.Tx, error)           { return scriptedTx{}, nil }
+func (c scriptedConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	c.d.execed = append(c.d.execed, query)
+	return driver.RowsAffected(0), c.d.errs[query]
+}
+func (c scriptedConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	if err := c.d.errs[query]; err != nil {
+		return nil, err
+	}
+	return &scriptedRows{values: c.d.rows[query]}, nil
+}
+
+func (scriptedTx) Commit() error   { return nil }
+func (scriptedTx) Rollback() error { return nil }
+
+func (r *scriptedRows) Columns() []string { return []string{"value"} }
+func (r *scriptedRows) Close() error      { return nil }
+func (r *scriptedRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	dest[0], r.values = r.values[0], r.values[1:]
+	return nil
+}
+
+// openScriptedDB return a gorm.DB of the mysql dialect on d
+func openScriptedDB(t *testing.T, d *scriptedDriver) *gorm.DB {
+	name := "ptcli-scripted-" + t.Name()
+	stdsql.Register(name, d)
+	conn, err := stdsql.Open(name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: conn, SkipInitializeWithVersion: true}), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// dbFactory is the sql.DBFactory of a gorm.DB
+type dbFactory struct {
+	db *gorm.DB
+}
+
+func (f dbFactory) GetDB(ctx context.Context) *gorm.DB {
+	return f.db.WithContext(ctx)
+}
+
+func (f dbFactory) GetOriginDB() *gorm.DB {
+	return f.db
+}
+
+var mockErr = errors.New("mock error")
+
+func TestCheckPrivileges(t *testing.T) {
+	d := &scriptedDriver{rows: map[string][]string{}}
+	db := openScriptedDB(t, d)
+	for grants, want := range map[string]checkResult{
+		"GRANT ALL PRIVILEGES ON *.* TO 'root'@'%'": {name: "privileges", ok: true, detail: "ALL PRIVILEGES"},
+		"GRANT SELECT, INSERT, UPDATE, DELETE ON `pt`.* TO 'app'@'%'": {name: "privileges", ok: true,
+			detail: "SELECT, INSERT, UPDATE, DELETE"},
+		"GRANT SELECT ON `pt`.* TO 'report'@'%'": {name: "privileges", detail: "missing INSERT, UPDATE, DELETE"},
+	} {
+		d.rows["SHOW GRANTS"] = []string{"GRANT USAGE ON *.* TO 'app'@'%'", grants}
+		assert.Equal(t, want, checkPrivileges(db), grants)
+	}
+	d.errs = map[string]error{"SHOW GRANTS": mockErr}
+	assert.Equal(t, checkResult{name: "privileges", detail: mockErr.Error()}, checkPrivileges(db))
+}
+
+func TestCheckIsolation(t *testing.T) {
+	d := &scriptedDriver{rows: map[string][]string{
+		"SELECT @@transaction_isolation": {"REPEATABLE-READ"},
+		"SELECT @@tx_isolation":          {"READ-COMMITTED"},
+	}}
+	db := openScriptedDB(t, d)
+	assert.Equal(t, checkResult{name: "isolation", ok: true, detail: "default REPEATABLE-READ"}, checkIsolation(db))
+
+	// MySQL before 5.7.20
+	d.errs = map[string]error{"SELECT @@transaction_isolation": mockErr}
+	assert.Equal(t, checkResult{name: "isolation", ok: true, detail: "default READ-COMMITTED"}, checkIsolation(db))
+}
+
+func TestCheckSavepoint(t *testing.T) {
+	d := &scriptedDriver{}
+	db := openScriptedDB(t, d)
+	assert.Equal(t, checkResult{name: "savepoint", ok: true, detail: "supported"}, checkSavepoint(db))
+	assert.Equal(t, []string{"SAVEPOINT ptcli_check", "ROLLBACK TO SAVEPOINT ptcli_check"}, d.execed)
+
+	d.errs = map[string]error{"SAVEPOINT ptcli_check": mockErr}
+	assert.Equal(t, checkResult{name: "savepoint", detail: mockErr.Error()}, checkSavepoint(db))
+}
+
+func TestCheckPropagationMatrix(t *testing.T) {
+	d := &scriptedDriver{}
+	tm := sql.NewTransactionManager(dbFactory{db: openScriptedDB(t, d)})
+	results := checkPropagationMatrix(tm)
+	assert.Len(t, results, len(propagationMatrix))
+	for _, result := range results {
+		assert.True(t, result.ok, result.String())
+	}
+
+	// the cases expecting an error fail before the statement
+	d.errs = map[string]error{"SELECT 1": mockErr}
+	for i, result := range checkPropagationMatrix(tm) {
+		assert.Equal(t, propagationMatrix[i].wantErr != nil, result.ok, result.name)
+	}
+}
+
+func TestCheckDatasource(t *testing.T) {
+	assert.Equal(t, []checkResult{{name: "config", detail: "database must be set"}},
+		checkDatasource(&sql.ConnConfig{Host: "localhost", Port: 3306}))
+}
+
+func TestCheckResult_String(t *testing.T) {
+	assert.Equal(t, "[OK] savepoint: supported", checkResult{name: "savepoint", ok: true, detail: "supported"}.String())
+	assert.Equal(t, "[FAIL] connect: refused", checkResult{name: "connect", detail: "refused"}.String())
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	configs, err := loadConfig(write("ptcli.json", `{"DEFAULT": {"host": "localhost", "port": 3306, "database": "pt"}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "localhost", configs["DEFAULT"].Host)
+	assert.Equal(t, 3306, configs["DEFAULT"].Port)
+	assert.Equal(t, "pt", configs["DEFAULT"].Database)
+
+	_, err = loadConfig(write("empty.json", `{}`))
+	assert.Error(t, err)
+	_, err = loadConfig(write("invalid.json", `[`))
+	assert.Error(t, err)
+	_, err = loadConfig(filepath.Join(dir, "missing.json"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"propagation-tx/sql"
+	"propagation-tx/sql/txtest"
+)
+
+// conformanceTable holds the writes of the conformance scenarios, it's created and dropped by ptcli
+const conformanceTable = "ptcli_conformance"
+
+// runConformance runs the conformance scenarios on the datasource of config, it needs the CREATE and DROP
+// privileges for its scratch table
+func runConformance(config *sql.ConnConfig) (txtest.ConformanceReport, error) {
+	factory, err := sql.NewConfigDBFactory(config)
+	if err != nil {
+		return txtest.ConformanceReport{}, err
+	}
+	db := factory.GetOriginDB()
+	if err = db.Exec("CREATE TABLE IF NOT EXISTS " + conformanceTable + " (k VARCHAR(64) PRIMARY KEY)").Error; err != nil {
+		return txtest.ConformanceReport{}, err
+	}
+	defer db.Exec("DROP TABLE " + conformanceTable)
+	return txtest.Conformance(sql.NewTransactionManager(factory), txtest.Env{
+		Reset: func() error {
+			return db.Exec("DELETE FROM " + conformanceTable).Error
+		},
+		Write: func(ctx context.Context, tx *gorm.DB, key string) error {
+			return tx.Exec("INSERT INTO "+conformanceTable+" (k) VALUES (?)", key).Error
+		},
+		Visible: func() ([]string, error) {
+			var keys []string
+			err := db.Raw("SELECT k FROM " + conformanceTable).Scan(&keys).Error
+			return keys, err
+		},
+	})
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"propagation-tx/sql/txtest"
+	"testing"
+)
+
+func TestWriteReports(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "conformance.json")
+	reports := map[string]txtest.ConformanceReport{"DEFAULT": {Passed: true}}
+	assert.NoError(t, writeReports(path, reports))
+
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	var read map[string]txtest.ConformanceReport
+	assert.NoError(t, json.Unmarshal(content, &read))
+	assert.Equal(t, reports, read)
+}
@@ -0,0 +1,95 @@
+// Command ptcli checks that the datasources of a config file are usable by propagation-tx:
+// connectivity, privileges, savepoint support, isolation defaults and a dry-run of the propagation matrix.
+//
+// The config file is a JSON object of datasource name to sql.ConnConfig:
+//
+//	{"DEFAULT": {"host": "localhost", "port": 3306, "user": "root", "password": "123456", "database": "pt"}}
+//
+// ptcli exits with status 1 if any check fails, so it can gate CI jobs.
+//
+// With -conformance, ptcli also runs the canonical propagation scenarios of txtest on every datasource and writes
+// the JSON conformance reports, by datasource name, to the given path. Other implementations of the propagation
+// can be validated against them.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"propagation-tx/sql"
+	"propagation-tx/sql/txtest"
+	"sort"
+)
+
+func main() {
+	configPath := flag.String("config", "ptcli.json", "path of the datasources config file")
+	conformancePath := flag.String("conformance", "", "path of the conformance reports to write, none if empty")
+	flag.Parse()
+
+	configs, err := loadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "load config:", err)
+		os.Exit(2)
+	}
+
+	names := make([]string, 0, len(configs))
+	for name := range configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	failed := false
+	reports := make(map[string]txtest.ConformanceReport)
+	for _, name := range names {
+		fmt.Printf("== %s\n", name)
+		config := configs[name]
+		for _, result := range checkDatasource(&config) {
+			fmt.Println(result)
+			failed = failed || !result.ok
+		}
+		if *conformancePath == "" {
+			continue
+		}
+		report, err := runConformance(&config)
+		result := checkResult{name: "conformance", ok: err == nil && report.Passed, detail: fmt.Sprintf("%d cases", len(report.Cases))}
+		if err != nil {
+			result.detail = err.Error()
+		}
+		fmt.Println(result)
+		failed = failed || !result.ok
+		reports[name] = report
+	}
+	if *conformancePath != "" {
+		if err := writeReports(*conformancePath, reports); err != nil {
+			fmt.Fprintln(os.Stderr, "write conformance reports:", err)
+			os.Exit(2)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func writeReports(path string, reports map[string]txtest.ConformanceReport) error {
+	content, err := json.MarshalIndent(reports, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0644)
+}
+
+func loadConfig(path string) (map[string]sql.ConnConfig, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	configs := make(map[string]sql.ConnConfig)
+	if err = json.Unmarshal(content, &configs); err != nil {
+		return nil, err
+	}
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("no datasource in %s", path)
+	}
+	return configs, nil
+}
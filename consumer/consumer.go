@@ -0,0 +1,146 @@
+// Package consumer processes the messages of a broker in transactions: a message is handled in a transaction
+// committed on success, retried with backoff when it fails, and dead-lettered once out of attempts. It's broker
+// agnostic, the consume loop of the client (kafka-go, sarama, amqp091...) builds a Message and calls Handle, then
+// acks the message when Handle succeeded:
+//
+//	c := consumer.New(tm, handle, consumer.Config{Group: "billing", ExactlyOnce: true, DeadLetter: dlq})
+//	for {
+//		m, err := reader.FetchMessage(ctx)
+//		...
+//		if err := c.Handle(ctx, &consumer.Message{ID: fmt.Sprintf("%d/%d", m.Partition, m.Offset), Payload: m.Value}); err == nil {
+//			_ = reader.CommitMessages(ctx, m)
+//		}
+//	}
+package consumer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"log"
+	"propagation-tx/sql"
+	"time"
+)
+
+// ErrNoMessageID is returned by Handle for a message without ID when ExactlyOnce is set
+var ErrNoMessageID = errors.New("message without ID")
+
+// Message is a message of a broker
+type Message struct {
+	// ID identifies the message across redeliveries for ExactlyOnce, e.g. the partition and offset of a kafka message
+	// or the message id of an AMQP one
+	ID      string
+	Topic   string
+	Key     []byte
+	Payload []byte
+	Headers map[string]string
+	// Attempt is the number of the processing attempt, from 1
+	Attempt int
+}
+
+// Handler processes a message in the transaction of tx
+type Handler func(ctx context.Context, tx *gorm.DB, msg *Message) error
+
+// DeadLetterSink receives the messages which failed all their attempts, with the error of the last one
+type DeadLetterSink interface {
+	DeadLetter(ctx context.Context, msg *Message, cause error) error
+}
+
+type DeadLetterFunc func(ctx context.Context, msg *Message, cause error) error
+
+func (f DeadLetterFunc) DeadLetter(ctx context.Context, msg *Message, cause error) error {
+	return f(ctx, msg, cause)
+}
+
+// Config configures the processing of a Consumer
+type Config struct {
+	// Group prefixes the idempotency keys of the messages, consumers of a topic in different groups must differ
+	Group string
+	// Options are the options of the transactions, PropagationRequired by default
+	Options []sql.TxOption
+	// MaxAttempts is the number of attempts of a message before it's dead-lettered, 3 by default
+	MaxAttempts int
+	// Backoff return the wait before the attempt following attempt, 100ms doubled per attempt by default
+	Backoff func(attempt int) time.Duration
+	// DeadLetter receives the messages out of attempts, Handle returns their error if nil
+	DeadLetter DeadLetterSink
+	// ExactlyOnce records the ID of the processed messages in the idempotency table (see
+	// sql.TransactionManager.Idempotent) in their transaction, so a redelivered message isn't processed again
+	ExactlyOnce bool
+}
+
+// Consumer processes messages with a Handler in transactions of a TransactionManager
+type Consumer struct {
+	tm      sql.TransactionManager
+	handler Handler
+	config  Config
+}
+
+// New return the Consumer processing messages with handler in transactions of tm
+func New(tm sql.TransactionManager, handler Handler, config Config) *Consumer {
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 3
+	}
+	if config.Backoff == nil {
+		config.Backoff = func(attempt int) time.Duration {
+			return 100 * time.Millisecond << (attempt - 1)
+		}
+	}
+	return &Consumer{tm: tm, handler: handler, config: config}
+}
+
+// Handle processes msg until an attempt succeeds, or dead-letters it once out of attempts. It return nil when the
+// message can be acked: processed, processed already with ExactlyOnce, or dead-lettered. A panic of the handler
+// fails its attempt.
+func (c *Consumer) Handle(ctx context.Context, msg *Message) error {
+	if c.config.ExactlyOnce && msg.ID == "" {
+		return ErrNoMessageID
+	}
+	for attempt := 1; ; attempt++ {
+		msg.Attempt = attempt
+		err := c.process(ctx, msg)
+		if err == nil || errors.Is(err, sql.ErrDuplicateRequest) {
+			return nil
+		}
+		if attempt >= c.config.MaxAttempts || ctx.Err() != nil {
+			return c.deadLetter(ctx, msg, err)
+		}
+		log.Printf("[TX] message %s attempt %d error: %v", msg.ID, attempt, err)
+		select {
+		case <-ctx.Done():
+			return c.deadLetter(ctx, msg, err)
+		case <-time.After(c.config.Backoff(attempt)):
+		}
+	}
+}
+
+// process runs an attempt of msg
+func (c *Consumer) process(ctx context.Context, msg *Message) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	if !c.config.ExactlyOnce {
+		return c.tm.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+			return c.handler(ctx, tx, msg)
+		}, c.config.Options...)
+	}
+	_, err = c.tm.Idempotent(ctx, "consumer:"+c.config.Group+":"+msg.ID, func(ctx context.Context, tx *gorm.DB) ([]byte, error) {
+		return nil, c.handler(ctx, tx, msg)
+	}, c.config.Options...)
+	return err
+}
+
+// deadLetter hands msg which failed with cause to the dead letter sink
+func (c *Consumer) deadLetter(ctx context.Context, msg *Message, cause error) error {
+	if c.config.DeadLetter == nil || ctx.Err() != nil {
+		return cause
+	}
+	if err := c.config.DeadLetter.DeadLetter(ctx, msg, cause); err != nil {
+		return fmt.Errorf("dead letter: %v, processing: %w", err, cause)
+	}
+	log.Printf("[TX] message %s dead-lettered after %d attempts: %v", msg.ID, msg.Attempt, cause)
+	return nil
+}
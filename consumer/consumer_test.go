@@ -0,0 +1,84 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"propagation-tx/sql"
+	"testing"
+	"time"
+)
+
+// recordingManager records the outcome of the transactions and the idempotency keys processed, the other methods
+// of the manager aren't used
+type recordingManager struct {
+	sql.TransactionManager
+	outcomes  []string
+	processed map[string]bool
+}
+
+func (m *recordingManager) Transaction(ctx context.Context, bizFn func(ctx context.Context, tx *gorm.DB) error, opts ...sql.TxOption) error {
+	outcome := "rollback"
+	defer func() {
+		m.outcomes = append(m.outcomes, outcome)
+	}()
+	err := bizFn(ctx, nil)
+	if err == nil {
+		outcome = "commit"
+	}
+	return err
+}
+
+func (m *recordingManager) Idempotent(ctx context.Context, key string, fn func(ctx context.Context, tx *gorm.DB) ([]byte, error), opts ...sql.TxOption) ([]byte, error) {
+	if m.processed[key] {
+		return nil, sql.ErrDuplicateRequest
+	}
+	var result []byte
+	err := m.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) (err error) {
+		result, err = fn(ctx, tx)
+		return err
+	}, opts...)
+	if err == nil {
+		m.processed[key] = true
+	}
+	return result, err
+}
+
+func TestConsumer_Handle(t *testing.T) {
+	tm := &recordingManager{processed: make(map[string]bool)}
+	failure := errors.New("failure")
+	var deadLetters []string
+	c := New(tm, func(ctx context.Context, tx *gorm.DB, msg *Message) error {
+		switch string(msg.Payload) {
+		case "panic":
+			panic(failure)
+		case "flaky":
+			if msg.Attempt < 2 {
+				return failure
+			}
+		}
+		return nil
+	}, Config{
+		Group:       "test",
+		MaxAttempts: 2,
+		Backoff:     func(int) time.Duration { return time.Millisecond },
+		DeadLetter: DeadLetterFunc(func(ctx context.Context, msg *Message, cause error) error {
+			deadLetters = append(deadLetters, msg.ID+": "+cause.Error())
+			return nil
+		}),
+		ExactlyOnce: true,
+	})
+	ctx := context.Background()
+
+	assert.NoError(t, c.Handle(ctx, &Message{ID: "1", Payload: []byte("flaky")}))
+	assert.Equal(t, []string{"rollback", "commit"}, tm.outcomes)
+	assert.NoError(t, c.Handle(ctx, &Message{ID: "1", Payload: []byte("flaky")}))
+	assert.Equal(t, []string{"rollback", "commit"}, tm.outcomes)
+
+	assert.NoError(t, c.Handle(ctx, &Message{ID: "2", Payload: []byte("panic")}))
+	assert.Equal(t, []string{"rollback", "commit", "rollback", "rollback"}, tm.outcomes)
+	assert.Equal(t, []string{"2: panic: failure"}, deadLetters)
+
+	assert.ErrorIs(t, c.Handle(ctx, &Message{Payload: []byte("ok")}), ErrNoMessageID)
+}
@@ -0,0 +1,84 @@
+// Package entx lets ent repositories take part in the transactions of a sql.TransactionManager, alongside gorm
+// repositories on the same datasource:
+//
+//	err := entx.Transaction(ctx, tm, func(ctx context.Context, drv dialect.Driver) (*ent.Tx, error) {
+//		return ent.NewClient(ent.Driver(drv)).Tx(ctx)
+//	}, func(ctx context.Context, tx *ent.Tx) error {
+//		return tx.Order.Create().SetID(id).Exec(ctx)
+//	}, sql.PropagationRequired)
+//
+// The *ent.Tx runs on the *sql.Tx of the gorm transaction, so it joins a transaction started by a gorm repository
+// and the other way around. Its Commit and Rollback are no-ops: the transaction ends with the bizFn of the manager.
+package entx
+
+import (
+	"context"
+	stdsql "database/sql"
+	"entgo.io/ent/dialect"
+	entsql "entgo.io/ent/dialect/sql"
+	"errors"
+	"gorm.io/gorm"
+	"propagation-tx/sql"
+)
+
+// ErrUnsupportedConnPool is returned when the tx of the manager isn't run by database/sql
+var ErrUnsupportedConnPool = errors.New("ent needs a database/sql connection pool")
+
+// dialects are the ent dialects of the gorm dialectors
+var dialects = map[string]string{
+	"mysql":    dialect.MySQL,
+	"postgres": dialect.Postgres,
+	"sqlite":   dialect.SQLite,
+}
+
+// Transaction runs bizFn in tm.Transaction with the ent tx opened by open on the driver of the transaction
+func Transaction[T any](ctx context.Context, tm sql.TransactionManager, open func(ctx context.Context, drv dialect.Driver) (T, error), bizFn func(ctx context.Context, tx T) error, opts ...sql.TxOption) error {
+	return tm.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+		drv, err := Driver(tx)
+		if err != nil {
+			return err
+		}
+		entTx, err := open(ctx, drv)
+		if err != nil {
+			return err
+		}
+		return bizFn(ctx, entTx)
+	}, opts...)
+}
+
+// Driver return the ent driver running on the tx given to a bizFn: its *sql.Tx, or the *sql.DB when bizFn runs
+// without transaction. The transactions it opens join the one of tx.
+func Driver(tx *gorm.DB) (dialect.Driver, error) {
+	name, ok := dialects[tx.Dialector.Name()]
+	if !ok {
+		return nil, errors.New("no ent dialect for " + tx.Dialector.Name())
+	}
+	if sqlTx := sql.WrapTx(tx).SQLTx(); sqlTx != nil {
+		return &txDriver{Conn: entsql.Conn{ExecQuerier: sqlTx}, dialect: name}, nil
+	}
+	db, ok := tx.Statement.ConnPool.(*stdsql.DB)
+	if !ok {
+		return nil, ErrUnsupportedConnPool
+	}
+	return entsql.OpenDB(name, db), nil
+}
+
+// txDriver is the ent driver of a transaction of the manager
+type txDriver struct {
+	entsql.Conn
+	dialect string
+}
+
+func (d *txDriver) Dialect() string {
+	return d.dialect
+}
+
+// Tx return the transaction itself, committed or rolled back by the manager
+func (d *txDriver) Tx(context.Context) (dialect.Tx, error) {
+	return dialect.NopTx(d), nil
+}
+
+// Close leaves the *sql.Tx to the manager
+func (d *txDriver) Close() error {
+	return nil
+}
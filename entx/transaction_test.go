@@ -0,0 +1,63 @@
+package entx
+
+import (
+	"context"
+	"entgo.io/ent/dialect"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"propagation-tx/internal/recordingdriver"
+	"propagation-tx/sql"
+	"strings"
+	"testing"
+)
+
+var mockErr = errors.New("mock error")
+
+func newRecordingManager(t *testing.T) (sql.TransactionManager, *recordingdriver.Driver) {
+	d := &recordingdriver.Driver{}
+	factory, err := sql.NewCachedDBFactory(recordingdriver.Creator{Name: "entx-recording-" + t.Name(), Source: "entx", Driver: d})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sql.NewTransactionManager(factory), d
+}
+
+// openTx opens the ent tx of drv like ent.NewClient(ent.Driver(drv)).Tx(ctx)
+func openTx(ctx context.Context, drv dialect.Driver) (dialect.Tx, error) {
+	return drv.Tx(ctx)
+}
+
+func TestTransaction(t *testing.T) {
+	tm, d := newRecordingManager(t)
+	ctx := context.Background()
+
+	err := tm.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+		tx.Exec("gorm")
+		return Transaction(ctx, tm, openTx, func(ctx context.Context, tx dialect.Tx) error {
+			assert.NoError(t, tx.Exec(ctx, "ent", []interface{}{}, nil))
+			// the transaction is committed by the manager
+			return tx.Commit()
+		}, sql.PropagationRequired)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "BEGIN,gorm,ent,COMMIT", strings.Join(d.Statements(), ","))
+
+	d.Reset()
+	err = Transaction(ctx, tm, openTx, func(ctx context.Context, tx dialect.Tx) error {
+		assert.NoError(t, tx.Exec(ctx, "ent", []interface{}{}, nil))
+		return mockErr
+	})
+	assert.ErrorIs(t, err, mockErr)
+	assert.Equal(t, "BEGIN,ent,ROLLBACK", strings.Join(d.Statements(), ","))
+
+	d.Reset()
+	err = Transaction(ctx, tm, func(ctx context.Context, drv dialect.Driver) (dialect.Driver, error) {
+		assert.Equal(t, dialect.MySQL, drv.Dialect())
+		return drv, nil
+	}, func(ctx context.Context, drv dialect.Driver) error {
+		return drv.Exec(ctx, "ent", []interface{}{}, nil)
+	}, sql.PropagationNotSupported)
+	assert.NoError(t, err)
+	assert.Equal(t, "ent", strings.Join(d.Statements(), ","))
+}
@@ -0,0 +1,98 @@
+package envelope
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// Keys of the envelope fields in transport metadata (gRPC metadata, HTTP headers)
+const (
+	KeySagaID        = "x-tx-saga-id"
+	KeyBranchID      = "x-tx-branch-id"
+	KeyCorrelationID = "x-tx-correlation-id"
+	KeyBudgetMillis  = "x-tx-budget-ms"
+)
+
+// Envelope is the transaction intent carried across services so distributed transactions can correlate
+// their local branches. It never carries the database transaction itself.
+type Envelope struct {
+	SagaID        string
+	BranchID      string
+	CorrelationID string
+	// Deadline of the whole distributed transaction, zero means no deadline.
+	// It travels as the remaining budget to be immune to clock skew between services.
+	Deadline time.Time
+}
+
+func (e Envelope) IsZero() bool {
+	return e.SagaID == "" && e.BranchID == "" && e.CorrelationID == "" && e.Deadline.IsZero()
+}
+
+// Marshal writes the non-empty fields of e with set
+func (e Envelope) Marshal(set func(key, value string)) {
+	if e.SagaID != "" {
+		set(KeySagaID, e.SagaID)
+	}
+	if e.BranchID != "" {
+		set(KeyBranchID, e.BranchID)
+	}
+	if e.CorrelationID != "" {
+		set(KeyCorrelationID, e.CorrelationID)
+	}
+	if !e.Deadline.IsZero() {
+		budget := time.Until(e.Deadline).Milliseconds()
+		if budget < 0 {
+			budget = 0
+		}
+		set(KeyBudgetMillis, strconv.FormatInt(budget, 10))
+	}
+}
+
+// Unmarshal reads an Envelope with get, ok is false if none of the fields is present
+func Unmarshal(get func(key string) string) (env Envelope, ok bool) {
+	env = Envelope{
+		SagaID:        get(KeySagaID),
+		BranchID:      get(KeyBranchID),
+		CorrelationID: get(KeyCorrelationID),
+	}
+	if budget, err := strconv.ParseInt(get(KeyBudgetMillis), 10, 64); err == nil {
+		env.Deadline = time.Now().Add(time.Duration(budget) * time.Millisecond)
+	}
+	return env, !env.IsZero()
+}
+
+type envelopeKey struct{}
+
+// NewContext return a copy of ctx carrying env
+func NewContext(ctx context.Context, env Envelope) context.Context {
+	return context.WithValue(ctx, envelopeKey{}, env)
+}
+
+// FromContext return the Envelope carried by ctx
+func FromContext(ctx context.Context) (Envelope, bool) {
+	env, ok := ctx.Value(envelopeKey{}).(Envelope)
+	return env, ok
+}
+
+// Outgoing return the Envelope of ctx to send downstream, its deadline is shortened to the deadline of ctx
+func Outgoing(ctx context.Context) (Envelope, bool) {
+	env, ok := FromContext(ctx)
+	if !ok {
+		return env, false
+	}
+	if deadline, has := ctx.Deadline(); has && (env.Deadline.IsZero() || deadline.Before(env.Deadline)) {
+		env.Deadline = deadline
+	}
+	return env, true
+}
+
+// Restore return a copy of ctx carrying the Envelope received from upstream, bounded by its deadline.
+// The returned CancelFunc must be called once the request is handled.
+func Restore(ctx context.Context, env Envelope) (context.Context, context.CancelFunc) {
+	ctx = NewContext(ctx, env)
+	if env.Deadline.IsZero() {
+		return context.WithCancel(ctx)
+	}
+	return context.WithDeadline(ctx, env.Deadline)
+}
@@ -0,0 +1,40 @@
+package envelope
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestEnvelope_MarshalUnmarshal(t *testing.T) {
+	env := Envelope{
+		SagaID:        "saga-1",
+		BranchID:      "branch-1",
+		CorrelationID: "corr-1",
+		Deadline:      time.Now().Add(time.Minute),
+	}
+	md := map[string]string{}
+	env.Marshal(func(key, value string) { md[key] = value })
+
+	got, ok := Unmarshal(func(key string) string { return md[key] })
+	assert.True(t, ok)
+	assert.Equal(t, env.SagaID, got.SagaID)
+	assert.Equal(t, env.BranchID, got.BranchID)
+	assert.Equal(t, env.CorrelationID, got.CorrelationID)
+	assert.WithinDuration(t, env.Deadline, got.Deadline, time.Second)
+
+	_, ok = Unmarshal(func(key string) string { return "" })
+	assert.False(t, ok)
+}
+
+func TestOutgoing_ShortensDeadline(t *testing.T) {
+	ctx := NewContext(context.Background(), Envelope{SagaID: "saga-1", Deadline: time.Now().Add(time.Hour)})
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	env, ok := Outgoing(ctx)
+	assert.True(t, ok)
+	deadline, _ := ctx.Deadline()
+	assert.Equal(t, deadline, env.Deadline)
+}
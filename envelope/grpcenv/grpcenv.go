@@ -0,0 +1,55 @@
+package grpcenv
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"propagation-tx/envelope"
+)
+
+// AppendToOutgoingContext return a copy of ctx whose outgoing metadata carries the envelope of ctx
+func AppendToOutgoingContext(ctx context.Context) context.Context {
+	env, ok := envelope.Outgoing(ctx)
+	if !ok {
+		return ctx
+	}
+	var kv []string
+	env.Marshal(func(key, value string) {
+		kv = append(kv, key, value)
+	})
+	return metadata.AppendToOutgoingContext(ctx, kv...)
+}
+
+// FromIncomingContext return the envelope carried by the incoming metadata of ctx
+func FromIncomingContext(ctx context.Context) (envelope.Envelope, bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return envelope.Envelope{}, false
+	}
+	return envelope.Unmarshal(func(key string) string {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	})
+}
+
+// UnaryClientInterceptor sends the envelope of the ctx of every call to the server
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(AppendToOutgoingContext(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+// UnaryServerInterceptor restores the envelope sent by the client into the ctx of the handler
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		env, ok := FromIncomingContext(ctx)
+		if !ok {
+			return handler(ctx, req)
+		}
+		ctx, cancel := envelope.Restore(ctx, env)
+		defer cancel()
+		return handler(ctx, req)
+	}
+}
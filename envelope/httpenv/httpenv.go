@@ -0,0 +1,41 @@
+package httpenv
+
+import (
+	"net/http"
+	"propagation-tx/envelope"
+)
+
+// Transport is a http.RoundTripper sending the envelope of the request ctx downstream as headers
+type Transport struct {
+	// Base is the RoundTripper doing the request, http.DefaultTransport if nil
+	Base http.RoundTripper
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	env, ok := envelope.Outgoing(req.Context())
+	if !ok {
+		return base.RoundTrip(req)
+	}
+	// RoundTripper must not modify the request
+	req = req.Clone(req.Context())
+	env.Marshal(req.Header.Set)
+	return base.RoundTrip(req)
+}
+
+// Middleware restores the envelope sent by upstream into the ctx of the request
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		env, ok := envelope.Unmarshal(r.Header.Get)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx, cancel := envelope.Restore(r.Context(), env)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,125 @@
+// Package globaltx enlists the transactions of a sql.TransactionManager as branches of a global transaction of an
+// external coordinator (DTM, Seata AT mode...), through a Coordinator adapter of its client.
+//
+// The global XID travels in the ctx: WithXID binds it (e.g. from Extract in a server middleware), Inject writes it
+// to the metadata of an outgoing call. A root transaction begun with a ctx carrying an XID registers a branch with
+// the Coordinator and reports its status once it committed or rolled back.
+package globaltx
+
+import (
+	"context"
+	"propagation-tx/sql"
+)
+
+// HeaderXID is the transport metadata key of the global XID, the one of Seata
+const HeaderXID = "TX_XID"
+
+// BranchStatus is the outcome of a branch reported to the Coordinator
+type BranchStatus int8
+
+const (
+	BranchCommitted  BranchStatus = iota // 本地事务已提交
+	BranchRolledBack                     // 本地事务已回滚
+)
+
+func (s BranchStatus) String() string {
+	if s == BranchCommitted {
+		return "Committed"
+	}
+	return "RolledBack"
+}
+
+// Coordinator is the client of the external coordinator of the global transactions
+type Coordinator interface {
+	// RegisterBranch registers a branch of the global transaction xid on resourceID, it return the id of the branch
+	RegisterBranch(ctx context.Context, xid, resourceID string) (branchID string, err error)
+	// ReportBranch reports the status of the branch of xid once the local transaction completed
+	ReportBranch(ctx context.Context, xid, branchID string, status BranchStatus) error
+}
+
+type xidKey struct{}
+
+// WithXID return a copy of ctx in the global transaction xid
+func WithXID(ctx context.Context, xid string) context.Context {
+	return context.WithValue(ctx, xidKey{}, xid)
+}
+
+// XIDOf return the global XID of ctx
+func XIDOf(ctx context.Context) (string, bool) {
+	xid, ok := ctx.Value(xidKey{}).(string)
+	return xid, ok && xid != ""
+}
+
+// Inject writes the global XID of ctx with set, if any
+func Inject(ctx context.Context, set func(key, value string)) {
+	if xid, ok := XIDOf(ctx); ok {
+		set(HeaderXID, xid)
+	}
+}
+
+// Extract return a copy of ctx in the global transaction read with get, ctx as it is if there is none
+func Extract(ctx context.Context, get func(key string) string) context.Context {
+	if xid := get(HeaderXID); xid != "" {
+		return WithXID(ctx, xid)
+	}
+	return ctx
+}
+
+// Resource enlists the root transactions of a sql.TransactionManager begun in a global transaction as its
+// branches, with sql.WithResources(globaltx.NewResource(coordinator, resourceID)). Root transactions outside of a
+// global transaction don't involve the Coordinator.
+//
+// The branch is registered when the root transaction begins, a registration failure fails the call. Its status is
+// reported after the local commit or rollback, a report failure can't change the outcome and is returned (after
+// the commit) or ignored (after the rollback), the coordinator is expected to query the branch in that case.
+type Resource struct {
+	coordinator Coordinator
+	resourceID  string
+}
+
+// NewResource return a Resource registering the branches on resourceID, e.g. the name of the datasource
+func NewResource(coordinator Coordinator, resourceID string) *Resource {
+	return &Resource{coordinator: coordinator, resourceID: resourceID}
+}
+
+func (r *Resource) Begin(ctx context.Context) (sql.ResourceTransaction, error) {
+	xid, ok := XIDOf(ctx)
+	if !ok {
+		return &branch{}, nil
+	}
+	branchID, err := r.coordinator.RegisterBranch(ctx, xid, r.resourceID)
+	if err != nil {
+		return nil, err
+	}
+	return &branch{coordinator: r.coordinator, xid: xid, id: branchID}, nil
+}
+
+// BranchID return the id of the branch of the transaction of ctx, false if it isn't a branch of a global transaction
+func (r *Resource) BranchID(ctx context.Context) (string, bool) {
+	b, ok := sql.ResourceTx(ctx, r).(*branch)
+	if !ok || b.coordinator == nil {
+		return "", false
+	}
+	return b.id, true
+}
+
+// branch is a root transaction enlisted in a global transaction, or a no-op without coordinator
+type branch struct {
+	coordinator Coordinator
+	xid         string
+	id          string
+}
+
+func (b *branch) Commit(ctx context.Context) error {
+	if b.coordinator == nil {
+		return nil
+	}
+	return b.coordinator.ReportBranch(ctx, b.xid, b.id, BranchCommitted)
+}
+
+func (b *branch) Rollback(ctx context.Context) error {
+	if b.coordinator == nil {
+		return nil
+	}
+	return b.coordinator.ReportBranch(ctx, b.xid, b.id, BranchRolledBack)
+}
@@ -0,0 +1,45 @@
+package globaltx
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type recordingCoordinator struct {
+	reports []string
+}
+
+func (c *recordingCoordinator) RegisterBranch(ctx context.Context, xid, resourceID string) (string, error) {
+	return xid + "/" + resourceID, nil
+}
+
+func (c *recordingCoordinator) ReportBranch(ctx context.Context, xid, branchID string, status BranchStatus) error {
+	c.reports = append(c.reports, branchID+":"+status.String())
+	return nil
+}
+
+func TestResource(t *testing.T) {
+	coordinator := &recordingCoordinator{}
+	resource := NewResource(coordinator, "orders")
+
+	md := map[string]string{}
+	Inject(WithXID(context.Background(), "xid-1"), func(key, value string) { md[key] = value })
+	ctx := Extract(context.Background(), func(key string) string { return md[key] })
+	xid, ok := XIDOf(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "xid-1", xid)
+
+	committed, err := resource.Begin(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, committed.Commit(ctx))
+	rolledBack, err := resource.Begin(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, rolledBack.Rollback(ctx))
+	assert.Equal(t, []string{"xid-1/orders:Committed", "xid-1/orders:RolledBack"}, coordinator.reports)
+
+	local, err := resource.Begin(context.Background())
+	assert.NoError(t, err)
+	assert.NoError(t, local.Commit(context.Background()))
+	assert.Len(t, coordinator.reports, 2)
+}
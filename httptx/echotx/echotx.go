@@ -0,0 +1,42 @@
+// Package echotx is the echo middleware of httptx
+package echotx
+
+import (
+	"context"
+	"github.com/labstack/echo/v4"
+	"log"
+	"net/http"
+	"propagation-tx/httptx"
+	"propagation-tx/sql"
+)
+
+// Middleware runs the requests in transactions of tm, the ctx of c.Request() carrying the transaction. The response
+// is buffered until the transaction completed like with httptx.Middleware. The error of the handler goes to the
+// HTTPErrorHandler of echo, so does a failure of the transaction, e.g. of its commit, as a 500 *echo.HTTPError
+// replacing the response of the handler.
+func Middleware(tm sql.TransactionManager, config httptx.Config) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req, res := c.Request(), c.Response()
+			writer := res.Writer
+			buffer := httptx.NewResponseBuffer(writer)
+			res.Writer = buffer
+			var handlerErr error
+			err := config.Run(req.Context(), tm, req.Method, c.Path(), func(ctx context.Context) (int, error) {
+				c.SetRequest(req.WithContext(ctx))
+				defer c.SetRequest(req)
+				handlerErr = next(c)
+				return res.Status, handlerErr
+			})
+			res.Writer = writer
+			if err != nil && err != handlerErr {
+				// the response of the handler is dropped, the HTTPErrorHandler answers instead
+				res.Committed, res.Status, res.Size = false, http.StatusOK, 0
+				log.Printf("[TX] %s %s transaction error: %v", req.Method, req.URL.Path, err)
+				return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
+			}
+			buffer.Send(writer)
+			return err
+		}
+	}
+}
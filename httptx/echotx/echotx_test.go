@@ -0,0 +1,73 @@
+package echotx
+
+import (
+	"context"
+	"errors"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"net/http"
+	"net/http/httptest"
+	"propagation-tx/httptx"
+	"propagation-tx/sql"
+	"testing"
+)
+
+// recordingManager records the outcome of the transactions, failing their commit with commitErr if set. The other
+// methods of the manager aren't used.
+type recordingManager struct {
+	sql.TransactionManager
+	commitErr error
+	outcomes  []string
+}
+
+func (m *recordingManager) Transaction(ctx context.Context, bizFn func(ctx context.Context, tx *gorm.DB) error, opts ...sql.TxOption) error {
+	err := bizFn(ctx, nil)
+	if err == nil && m.commitErr != nil {
+		err = &sql.CommitError{Cause: m.commitErr}
+	}
+	if err != nil {
+		m.outcomes = append(m.outcomes, "rollback")
+	} else {
+		m.outcomes = append(m.outcomes, "commit")
+	}
+	return err
+}
+
+func newServer(tm sql.TransactionManager) *echo.Echo {
+	e := echo.New()
+	e.Use(Middleware(tm, httptx.Config{}))
+	e.POST("/orders", func(c echo.Context) error {
+		c.Response().Header().Set("Location", "/orders/1")
+		return c.String(http.StatusCreated, "created")
+	})
+	e.POST("/invalid", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid")
+	})
+	return e
+}
+
+func TestMiddleware(t *testing.T) {
+	tm := &recordingManager{}
+	e := newServer(tm)
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/orders", nil))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "created", w.Body.String())
+	assert.Equal(t, "/orders/1", w.Header().Get("Location"))
+
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/invalid", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, []string{"commit", "rollback"}, tm.outcomes)
+}
+
+func TestMiddleware_CommitError(t *testing.T) {
+	tm := &recordingManager{commitErr: errors.New("connection lost")}
+	w := httptest.NewRecorder()
+	newServer(tm).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/orders", nil))
+	assert.Equal(t, []string{"rollback"}, tm.outcomes)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.NotContains(t, w.Body.String(), "created")
+	assert.Empty(t, w.Header().Get("Location"))
+}
@@ -0,0 +1,34 @@
+// Package fibertx is the fiber middleware of httptx
+package fibertx
+
+import (
+	"context"
+	"github.com/gofiber/fiber/v2"
+	"log"
+	"propagation-tx/httptx"
+	"propagation-tx/sql"
+)
+
+// Middleware runs the requests in transactions of tm, c.UserContext() carrying the transaction. fasthttp sends the
+// response once the handlers returned, so after the transaction completed. The error of the handler goes to the
+// ErrorHandler of fiber, so does a failure of the transaction, e.g. of its commit, as fiber.ErrInternalServerError
+// replacing the response of the handler.
+func Middleware(tm sql.TransactionManager, config httptx.Config) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userCtx := c.UserContext()
+		var handlerErr error
+		err := config.Run(userCtx, tm, c.Method(), c.Path(), func(ctx context.Context) (int, error) {
+			c.SetUserContext(ctx)
+			defer c.SetUserContext(userCtx)
+			handlerErr = c.Next()
+			return c.Response().StatusCode(), handlerErr
+		})
+		if err != nil && err != handlerErr {
+			// the response of the handler is dropped, the ErrorHandler answers instead
+			c.Response().Reset()
+			log.Printf("[TX] %s %s transaction error: %v", c.Method(), c.Path(), err)
+			return fiber.ErrInternalServerError
+		}
+		return err
+	}
+}
@@ -0,0 +1,76 @@
+package fibertx
+
+import (
+	"context"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"propagation-tx/httptx"
+	"propagation-tx/sql"
+	"testing"
+)
+
+// recordingManager records the outcome of the transactions, failing their commit with commitErr if set. The other
+// methods of the manager aren't used.
+type recordingManager struct {
+	sql.TransactionManager
+	commitErr error
+	outcomes  []string
+}
+
+func (m *recordingManager) Transaction(ctx context.Context, bizFn func(ctx context.Context, tx *gorm.DB) error, opts ...sql.TxOption) error {
+	err := bizFn(ctx, nil)
+	if err == nil && m.commitErr != nil {
+		err = &sql.CommitError{Cause: m.commitErr}
+	}
+	if err != nil {
+		m.outcomes = append(m.outcomes, "rollback")
+	} else {
+		m.outcomes = append(m.outcomes, "commit")
+	}
+	return err
+}
+
+func newApp(tm sql.TransactionManager) *fiber.App {
+	app := fiber.New()
+	app.Use(Middleware(tm, httptx.Config{}))
+	app.Post("/orders", func(c *fiber.Ctx) error {
+		c.Set("Location", "/orders/1")
+		return c.Status(http.StatusCreated).SendString("created")
+	})
+	app.Post("/invalid", func(c *fiber.Ctx) error {
+		return fiber.NewError(http.StatusBadRequest, "invalid")
+	})
+	return app
+}
+
+func TestMiddleware(t *testing.T) {
+	tm := &recordingManager{}
+	app := newApp(tm)
+	res, err := app.Test(httptest.NewRequest(http.MethodPost, "/orders", nil))
+	assert.NoError(t, err)
+	body, _ := io.ReadAll(res.Body)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+	assert.Equal(t, "created", string(body))
+	assert.Equal(t, "/orders/1", res.Header.Get("Location"))
+
+	res, err = app.Test(httptest.NewRequest(http.MethodPost, "/invalid", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	assert.Equal(t, []string{"commit", "rollback"}, tm.outcomes)
+}
+
+func TestMiddleware_CommitError(t *testing.T) {
+	tm := &recordingManager{commitErr: errors.New("connection lost")}
+	res, err := newApp(tm).Test(httptest.NewRequest(http.MethodPost, "/orders", nil))
+	assert.NoError(t, err)
+	body, _ := io.ReadAll(res.Body)
+	assert.Equal(t, []string{"rollback"}, tm.outcomes)
+	assert.Equal(t, http.StatusInternalServerError, res.StatusCode)
+	assert.NotContains(t, string(body), "created")
+	assert.Empty(t, res.Header.Get("Location"))
+}
@@ -0,0 +1,140 @@
+// Package httptx runs each HTTP request in a transaction of a sql.TransactionManager: the handlers and the
+// repositories they call join it through the ctx of the request. Middleware is the net/http middleware, echotx and
+// fibertx are the ones of echo and fiber, all sharing the Config of this package.
+package httptx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"log"
+	"net/http"
+	"propagation-tx/sql"
+)
+
+// errRollbackStatus rolls back the transaction of a request whose response status asks for it
+var errRollbackStatus = errors.New("rollback for the response status")
+
+// Config is the transaction of the requests of a middleware
+type Config struct {
+	// Options are the options of the transactions, PropagationRequired by default
+	Options []sql.TxOption
+	// Skip tells whether a request runs without transaction, e.g. health checks
+	Skip func(method, path string) bool
+	// RollbackStatus tells whether the status of a response rolls its transaction back, status >= 400 if nil
+	RollbackStatus func(status int) bool
+}
+
+// Run runs serve in a transaction of tm for the request method path, serve returning the status of the response
+// and the error of the handler. The transaction rolls back when serve returns an error or a status RollbackStatus
+// accepts. Run return the error of serve, or the error of the transaction once the response was served.
+func (c *Config) Run(ctx context.Context, tm sql.TransactionManager, method, path string, serve func(ctx context.Context) (int, error)) error {
+	if c.Skip != nil && c.Skip(method, path) {
+		_, err := serve(ctx)
+		return err
+	}
+	var serveErr error
+	err := tm.Transaction(ctx, func(ctx context.Context, _ *gorm.DB) error {
+		var status int
+		status, serveErr = serve(ctx)
+		if serveErr != nil {
+			return serveErr
+		}
+		if c.rollbackStatus(status) {
+			return errRollbackStatus
+		}
+		return nil
+	}, c.Options...)
+	if serveErr != nil || errors.Is(err, errRollbackStatus) {
+		return serveErr
+	}
+	return err
+}
+
+func (c *Config) rollbackStatus(status int) bool {
+	if c.RollbackStatus != nil {
+		return c.RollbackStatus(status)
+	}
+	return status >= http.StatusBadRequest
+}
+
+// Middleware return the net/http middleware running the requests in transactions of tm. The response is buffered
+// until the transaction completed: it's sent once the transaction committed, or rolled back for its status, and
+// replaced with a 500 if the transaction failed, e.g. its commit. Handlers streaming their response (http.Flusher,
+// http.Hijacker) need to be skipped.
+func Middleware(tm sql.TransactionManager, config Config) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			buffer := NewResponseBuffer(w)
+			err := config.Run(r.Context(), tm, r.Method, r.URL.Path, func(ctx context.Context) (int, error) {
+				next.ServeHTTP(buffer, r.WithContext(ctx))
+				return buffer.Status(), nil
+			})
+			if err != nil {
+				log.Printf("[TX] %s %s transaction error: %v", r.Method, r.URL.Path, err)
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			buffer.Send(w)
+		})
+	}
+}
+
+// ResponseBuffer is an http.ResponseWriter holding a response until the transaction of its request completed
+type ResponseBuffer struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+// NewResponseBuffer return an empty ResponseBuffer of the response of w, starting with the headers of w
+func NewResponseBuffer(w http.ResponseWriter) *ResponseBuffer {
+	return &ResponseBuffer{header: w.Header().Clone()}
+}
+
+func (b *ResponseBuffer) Header() http.Header {
+	return b.header
+}
+
+func (b *ResponseBuffer) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+func (b *ResponseBuffer) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(p)
+}
+
+// Status return the status of the response, 200 if the handler wrote nothing
+func (b *ResponseBuffer) Status() int {
+	if b.status == 0 {
+		return http.StatusOK
+	}
+	return b.status
+}
+
+// Send writes the buffered response to w. Only the headers are set if the handler wrote nothing, so w can still
+// answer.
+func (b *ResponseBuffer) Send(w http.ResponseWriter) {
+	header := w.Header()
+	for key := range header {
+		if _, ok := b.header[key]; !ok {
+			delete(header, key)
+		}
+	}
+	for key, values := range b.header {
+		header[key] = values
+	}
+	if b.status == 0 {
+		return
+	}
+	w.WriteHeader(b.status)
+	if _, err := w.Write(b.body.Bytes()); err != nil {
+		log.Printf("[TX] write response error: %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package httptx
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"net/http"
+	"net/http/httptest"
+	"propagation-tx/sql"
+	"testing"
+)
+
+// recordingManager records the outcome of the transactions, failing their commit with commitErr if set. The other
+// methods of the manager aren't used.
+type recordingManager struct {
+	sql.TransactionManager
+	commitErr error
+	outcomes  []string
+}
+
+func (m *recordingManager) Transaction(ctx context.Context, bizFn func(ctx context.Context, tx *gorm.DB) error, opts ...sql.TxOption) error {
+	err := bizFn(ctx, nil)
+	if err == nil && m.commitErr != nil {
+		err = &sql.CommitError{Cause: m.commitErr}
+	}
+	if err != nil {
+		m.outcomes = append(m.outcomes, "rollback")
+	} else {
+		m.outcomes = append(m.outcomes, "commit")
+	}
+	return err
+}
+
+func TestMiddleware(t *testing.T) {
+	tm := &recordingManager{}
+	handler := Middleware(tm, Config{Skip: func(method, path string) bool {
+		return path == "/health"
+	}})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/created":
+			w.WriteHeader(http.StatusCreated)
+		case "/invalid":
+			http.Error(w, "invalid", http.StatusBadRequest)
+		default:
+			_, _ = w.Write([]byte("ok"))
+		}
+	}))
+	statuses := make(map[string]int)
+	for _, path := range []string{"/created", "/invalid", "/ok", "/health"} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, nil))
+		statuses[path] = w.Code
+		if path == "/ok" {
+			assert.Equal(t, "ok", w.Body.String())
+		}
+	}
+	assert.Equal(t, []string{"commit", "rollback", "commit"}, tm.outcomes)
+	assert.Equal(t, map[string]int{"/created": 201, "/invalid": 400, "/ok": 200, "/health": 200}, statuses)
+}
+
+func TestMiddleware_CommitError(t *testing.T) {
+	tm := &recordingManager{commitErr: errors.New("connection lost")}
+	handler := Middleware(tm, Config{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Location", "/orders/1")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("created"))
+	}))
+	w := httptest.NewRecorder()
+	w.Header().Set("X-Request-Id", "1")
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/orders", nil))
+	assert.Equal(t, []string{"rollback"}, tm.outcomes)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.NotContains(t, w.Body.String(), "created")
+	assert.Empty(t, w.Header().Get("Location"))
+	assert.Equal(t, "1", w.Header().Get("X-Request-Id"))
+}
+
+func TestConfig_Run(t *testing.T) {
+	tm := &recordingManager{}
+	config := Config{RollbackStatus: func(status int) bool { return status >= http.StatusInternalServerError }}
+	handlerErr := errors.New("handler error")
+	assert.NoError(t, config.Run(context.Background(), tm, http.MethodGet, "/", func(ctx context.Context) (int, error) {
+		return http.StatusNotFound, nil
+	}))
+	assert.NoError(t, config.Run(context.Background(), tm, http.MethodGet, "/", func(ctx context.Context) (int, error) {
+		return http.StatusServiceUnavailable, nil
+	}))
+	assert.ErrorIs(t, config.Run(context.Background(), tm, http.MethodGet, "/", func(ctx context.Context) (int, error) {
+		return http.StatusOK, handlerErr
+	}), handlerErr)
+	assert.Equal(t, []string{"commit", "rollback", "rollback"}, tm.outcomes)
+}
@@ -0,0 +1,158 @@
+// Package propagation is the propagation engine of the stdsql and sqlxtx packages, generic over the transaction
+// type of their driver and the querier type their bizFns take. The propagations, their errors and the joining of
+// the ambient transaction through the ctx are the ones of the sql package, PropagationNested uses SAVEPOINT
+// statements.
+package propagation
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	ptx "propagation-tx/sql"
+)
+
+// Tx is a transaction of a Manager
+type Tx interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	Commit() error
+	Rollback() error
+}
+
+// Manager runs bizFn with the propagations of the sql package, giving it the Q of the transaction T it runs in or
+// the Q of the database without transaction
+type Manager[T Tx, Q any] struct {
+	db Q
+	// key identifies the database in the ctx, it must be comparable
+	key     interface{}
+	begin   func(ctx context.Context) (T, error)
+	querier func(tx T) Q
+}
+
+// New return the Manager of the database whose querier is db and identified by key (e.g. its pool), begin starts
+// its transactions and querier return the querier of one
+func New[T Tx, Q any](db Q, key interface{}, begin func(ctx context.Context) (T, error), querier func(tx T) Q) *Manager[T, Q] {
+	return &Manager[T, Q]{db: db, key: key, begin: begin, querier: querier}
+}
+
+// transactionKey looks up the transaction of a database in a ctx
+type transactionKey struct {
+	key interface{}
+}
+
+// transaction is a root transaction of a Manager
+type transaction[T Tx] struct {
+	tx           T
+	savepointSeq int
+}
+
+// transactionOf return the ambient transaction of m in ctx
+func (m *Manager[T, Q]) transactionOf(ctx context.Context) (*transaction[T], bool) {
+	t, ok := ctx.Value(transactionKey{m.key}).(*transaction[T])
+	return t, ok && t != nil
+}
+
+// Querier return the querier of the ambient transaction of ctx, or the one of the database
+func (m *Manager[T, Q]) Querier(ctx context.Context) Q {
+	if t, ok := m.transactionOf(ctx); ok {
+		return m.querier(t.tx)
+	}
+	return m.db
+}
+
+// Transaction runs bizFn with propagation, PropagationRequired if none is given. An error or a panic of bizFn rolls
+// back the transaction (or the savepoint) it started, the panic is propagated afterwards.
+func (m *Manager[T, Q]) Transaction(ctx context.Context, bizFn func(ctx context.Context, q Q) error, propagation ...ptx.TransactionPropagation) error {
+	p := ptx.PropagationRequired
+	if len(propagation) > 0 {
+		p = propagation[0]
+	}
+	t, inTransaction := m.transactionOf(ctx)
+	switch p {
+	case ptx.PropagationRequired:
+		if inTransaction {
+			return bizFn(ctx, m.querier(t.tx))
+		}
+		return m.runRoot(ctx, bizFn)
+	case ptx.PropagationSupports:
+		return bizFn(ctx, m.Querier(ctx))
+	case ptx.PropagationMandatory:
+		if !inTransaction {
+			return ptx.ErrMandatoryPropWithoutTransaction
+		}
+		return bizFn(ctx, m.querier(t.tx))
+	case ptx.PropagationRequiresNew:
+		return m.runRoot(ctx, bizFn)
+	case ptx.PropagationNotSupported:
+		return bizFn(m.withoutTransaction(ctx), m.db)
+	case ptx.PropagationNested:
+		if inTransaction {
+			return m.runNested(ctx, t, bizFn)
+		}
+		return m.runRoot(ctx, bizFn)
+	case ptx.PropagationNever:
+		if inTransaction {
+			return ptx.ErrNeverPropInTransaction
+		}
+		return bizFn(ctx, m.db)
+	default:
+		panic("not supported propagation")
+	}
+}
+
+// withoutTransaction return ctx hiding the transaction of m
+func (m *Manager[T, Q]) withoutTransaction(ctx context.Context) context.Context {
+	if _, ok := m.transactionOf(ctx); !ok {
+		return ctx
+	}
+	return context.WithValue(ctx, transactionKey{m.key}, (*transaction[T])(nil))
+}
+
+// runRoot runs bizFn in a new transaction, committed if bizFn succeeded
+func (m *Manager[T, Q]) runRoot(ctx context.Context, bizFn func(ctx context.Context, q Q) error) (err error) {
+	tx, err := m.begin(ctx)
+	if err != nil {
+		return err
+	}
+	t := &transaction[T]{tx: tx}
+	panicked := true
+	defer func() {
+		if panicked || err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil && err != nil {
+				err = &ptx.RollbackError{Cause: rollbackErr, Original: err}
+			}
+		}
+	}()
+	err = bizFn(context.WithValue(ctx, transactionKey{m.key}, t), m.querier(tx))
+	panicked = false
+	if err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return &ptx.CommitError{Cause: err}
+	}
+	return nil
+}
+
+// runNested runs bizFn in a savepoint of t, rolled back to if bizFn fails
+func (m *Manager[T, Q]) runNested(ctx context.Context, t *transaction[T], bizFn func(ctx context.Context, q Q) error) (err error) {
+	t.savepointSeq++
+	savepoint := fmt.Sprintf("sp%d", t.savepointSeq)
+	if _, err = t.tx.ExecContext(ctx, "SAVEPOINT "+savepoint); err != nil {
+		return err
+	}
+	panicked := true
+	defer func() {
+		if panicked || err != nil {
+			if _, rollbackErr := t.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+savepoint); rollbackErr != nil && err != nil {
+				err = &ptx.RollbackError{Cause: rollbackErr, Original: err}
+			}
+		}
+	}()
+	err = bizFn(ctx, m.querier(t.tx))
+	panicked = false
+	if err != nil {
+		return err
+	}
+	_, err = t.tx.ExecContext(ctx, "RELEASE SAVEPOINT "+savepoint)
+	return err
+}
@@ -0,0 +1,214 @@
+// Package recordingdriver is a database/sql driver recording the statements and transaction calls of its
+// connections instead of executing them, for the tests of the packages of the module:
+//
+//	d := &recordingdriver.Driver{}
+//	db, _ := recordingdriver.OpenGorm(d)
+//	// ... run transactions on db
+//	assert.Equal(t, []string{"BEGIN", "UPDATE stock SET n = 0", "COMMIT"}, d.Statements())
+package recordingdriver
+
+import (
+	"context"
+	stdsql "database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"io"
+	"sync"
+)
+
+// Driver records the statements of its connections, it's a driver.Driver and a driver.Connector. The fields
+// configure it before its first connection.
+type Driver struct {
+	// CommitErr and RollbackErr fail the commits and the rollbacks of the transactions
+	CommitErr   error
+	RollbackErr error
+	// BrokenReads is the number of the next queries failing with driver.ErrBadConn
+	BrokenReads int
+	// WithArgs records the statements followed by their args
+	WithArgs bool
+	// Columns are the columns of the rows returned by the queries
+	Columns []string
+	// Results return the columns and the rows of a query if set, instead of the Columns and the rows of SetRows
+	Results func(query string) (columns []string, values [][]driver.Value)
+	// Exec return the rows affected by a statement or its error if set, a statement affects 1 row otherwise
+	Exec func(query string) (int64, error)
+
+	mu         sync.Mutex
+	statements []string
+	rows       [][]driver.Value
+}
+
+type conn struct {
+	d *Driver
+}
+
+type tx struct {
+	d *Driver
+}
+
+type result struct {
+	rows int64
+}
+
+type rows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+var _ driver.Connector = (*Driver)(nil)
+
+func (d *Driver) Connect(context.Context) (driver.Conn, error) {
+	return conn{d}, nil
+}
+
+func (d *Driver) Driver() driver.Driver {
+	return d
+}
+
+func (d *Driver) Open(string) (driver.Conn, error) {
+	return conn{d}, nil
+}
+
+func (d *Driver) record(statement string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.statements = append(d.statements, statement)
+}
+
+// Statements return the statements recorded so far
+func (d *Driver) Statements() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.statements...)
+}
+
+// Reset forgets the statements recorded so far
+func (d *Driver) Reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.statements = nil
+}
+
+// SetRows sets the rows returned by the next queries, their values follow the Columns
+func (d *Driver) SetRows(values [][]driver.Value) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.rows = values
+}
+
+func (c conn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("recordingdriver doesn't prepare statements")
+}
+
+func (c conn) Close() error {
+	return nil
+}
+
+func (c conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c conn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	c.d.record("BEGIN")
+	return tx(c), nil
+}
+
+func (c conn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.d.record(c.statement(query, args))
+	if c.d.Exec != nil {
+		rows, err := c.d.Exec(query)
+		if err != nil {
+			return nil, err
+		}
+		return result{rows: rows}, nil
+	}
+	return result{rows: 1}, nil
+}
+
+func (c conn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.d.record(c.statement(query, args))
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	if c.d.BrokenReads > 0 {
+		c.d.BrokenReads--
+		return nil, driver.ErrBadConn
+	}
+	if c.d.Results != nil {
+		columns, values := c.d.Results(query)
+		return &rows{columns: columns, values: values}, nil
+	}
+	return &rows{columns: c.d.Columns, values: c.d.rows}, nil
+}
+
+func (c conn) statement(query string, args []driver.NamedValue) string {
+	if c.d.WithArgs {
+		for _, arg := range args {
+			query += fmt.Sprintf(" %v", arg.Value)
+		}
+	}
+	return query
+}
+
+func (t tx) Commit() error {
+	t.d.record("COMMIT")
+	return t.d.CommitErr
+}
+
+func (t tx) Rollback() error {
+	t.d.record("ROLLBACK")
+	return t.d.RollbackErr
+}
+
+func (result) LastInsertId() (int64, error) {
+	return 1, nil
+}
+
+func (r result) RowsAffected() (int64, error) {
+	return r.rows, nil
+}
+
+func (r *rows) Columns() []string {
+	return r.columns
+}
+
+func (r *rows) Close() error {
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+// OpenGorm return a *gorm.DB of the mysql dialect on d
+func OpenGorm(d *Driver) (*gorm.DB, error) {
+	return gorm.Open(mysql.New(mysql.Config{Conn: stdsql.OpenDB(d), SkipInitializeWithVersion: true}),
+		&gorm.Config{Logger: logger.Discard})
+}
+
+// Creator is a sql.CacheableDBCreator of the mysql dialect on Driver, cached by Name
+type Creator struct {
+	Name   string
+	Source string
+	Driver *Driver
+}
+
+func (c Creator) CreateDB() (*gorm.DB, error) {
+	return OpenGorm(c.Driver)
+}
+
+func (c Creator) CacheKey() string {
+	return c.Name
+}
+
+func (c Creator) CacheSource() string {
+	return c.Source
+}
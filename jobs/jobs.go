@@ -0,0 +1,140 @@
+// Package jobs runs scheduled jobs in transactions: each run of a job holds the row of the job in the job lock table
+// for the length of its transaction, so a run overlapping another one, in this process or another, is skipped. The
+// skip relies on SELECT ... FOR UPDATE SKIP LOCKED of MySQL and Postgres: on other dialects the lock is a plain
+// FOR UPDATE, an overlapping run then waits for the running one to complete and runs after it. It works with any
+// scheduler:
+//
+//	runner, err := jobs.NewRunner(tm)
+//	c.AddFunc("@every 1m", runner.Func(ctx, jobs.Job{Name: "expire-orders", Timeout: 30 * time.Second, Fn: expireOrders}))
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log"
+	"propagation-tx/sql"
+	"sync"
+	"time"
+)
+
+// ErrJobRunning is returned by Run when the job is already running
+var ErrJobRunning = errors.New("job running")
+
+// jobLock is a row of the job lock table, locked by the transaction of a run of its job
+type jobLock struct {
+	Name      string     `gorm:"column:name;type:varchar(191);primaryKey"`
+	StartedAt *time.Time `gorm:"column:started_at"`
+}
+
+func (l *jobLock) TableName() string {
+	return "ptx_job_locks"
+}
+
+// Job is a scheduled job
+type Job struct {
+	Name string
+	Fn   func(ctx context.Context, tx *gorm.DB) error
+	// Options are the options of the transaction of the runs, PropagationRequired by default. The lock of the job
+	// needs a transaction, propagations running without one must set AllowOverlap.
+	Options []sql.TxOption
+	// Timeout bounds a run through its ctx, none if 0
+	Timeout time.Duration
+	// AllowOverlap runs the job without taking its lock
+	AllowOverlap bool
+}
+
+// Runner runs jobs in transactions of a sql.TransactionManager
+type Runner struct {
+	tm sql.TransactionManager
+	// locks are the names of the jobs whose row is known to exist
+	locks sync.Map
+}
+
+// NewRunner return the Runner of tm, creating or migrating the job lock table
+func NewRunner(tm sql.TransactionManager) (*Runner, error) {
+	if err := tm.GetOriginDB().AutoMigrate(&jobLock{}); err != nil {
+		return nil, err
+	}
+	return &Runner{tm: tm}, nil
+}
+
+// Run runs job once in a transaction, rolled back if Fn fails, panics or outlives the Timeout of the job. It return
+// ErrJobRunning without running Fn when the job is running already.
+func (r *Runner) Run(ctx context.Context, job Job) (err error) {
+	if job.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, job.Timeout)
+		defer cancel()
+	}
+	if !job.AllowOverlap {
+		if err := r.ensureLock(ctx, job.Name); err != nil {
+			return err
+		}
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("job %s panic: %v", job.Name, p)
+		}
+	}()
+	return r.tm.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+		if !job.AllowOverlap {
+			if err := lock(tx, job.Name); err != nil {
+				return err
+			}
+		}
+		return job.Fn(ctx, tx)
+	}, job.Options...)
+}
+
+// Func return the func of a scheduler running job with ctx, logging its failures
+func (r *Runner) Func(ctx context.Context, job Job) func() {
+	return func() {
+		start := time.Now()
+		if err := r.Run(ctx, job); errors.Is(err, ErrJobRunning) {
+			log.Printf("[TX] job %s skipped: running already", job.Name)
+		} else if err != nil {
+			log.Printf("[TX] job %s failed after %v: %v", job.Name, time.Since(start), err)
+		}
+	}
+}
+
+// ensureLock creates the row of the job name if it doesn't exist, outside of the transaction of the run: an insert
+// would wait for a run holding the row. A plain read doesn't.
+func (r *Runner) ensureLock(ctx context.Context, name string) error {
+	if _, ok := r.locks.Load(name); ok {
+		return nil
+	}
+	db := r.tm.GetOriginDB().WithContext(ctx)
+	var count int64
+	if err := db.Model(&jobLock{}).Where("name = ?", name).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&jobLock{Name: name}).Error; err != nil {
+			return err
+		}
+	}
+	r.locks.Store(name, struct{}{})
+	return nil
+}
+
+// lock locks the row of the job name in tx, or return ErrJobRunning if another run holds it. Without SKIP LOCKED
+// (dialects other than MySQL and Postgres) it waits for the other run instead.
+func lock(tx *gorm.DB, name string) error {
+	locking := clause.Locking{Strength: "UPDATE"}
+	if dialect := tx.Dialector.Name(); dialect == "mysql" || dialect == "postgres" {
+		locking.Options = "SKIP LOCKED"
+	}
+	var locks []jobLock
+	if err := tx.Clauses(locking).Where("name = ?", name).Limit(1).Find(&locks).Error; err != nil {
+		return err
+	}
+	if len(locks) == 0 {
+		return ErrJobRunning
+	}
+	now := time.Now()
+	return tx.Model(&locks[0]).UpdateColumn("started_at", &now).Error
+}
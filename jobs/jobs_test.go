@@ -0,0 +1,114 @@
+package jobs
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"propagation-tx/internal/recordingdriver"
+	"propagation-tx/sql"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordingManager records the outcome of the transactions, the other methods of the manager aren't used
+type recordingManager struct {
+	sql.TransactionManager
+	outcomes []string
+}
+
+func (m *recordingManager) Transaction(ctx context.Context, bizFn func(ctx context.Context, tx *gorm.DB) error, opts ...sql.TxOption) error {
+	outcome := "rollback"
+	defer func() {
+		m.outcomes = append(m.outcomes, outcome)
+	}()
+	err := bizFn(ctx, nil)
+	if err == nil {
+		outcome = "commit"
+	}
+	return err
+}
+
+func TestRunner_Run(t *testing.T) {
+	tm := &recordingManager{}
+	r := &Runner{tm: tm}
+	ctx := context.Background()
+	failure := errors.New("failure")
+
+	assert.NoError(t, r.Run(ctx, Job{Name: "ok", AllowOverlap: true, Fn: func(ctx context.Context, tx *gorm.DB) error {
+		return nil
+	}}))
+	err := r.Run(ctx, Job{Name: "explode", AllowOverlap: true, Fn: func(ctx context.Context, tx *gorm.DB) error {
+		panic(failure)
+	}})
+	assert.EqualError(t, err, "job explode panic: failure")
+	assert.ErrorIs(t, r.Run(ctx, Job{Name: "timeout", AllowOverlap: true, Timeout: time.Millisecond, Fn: func(ctx context.Context, tx *gorm.DB) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}}), context.DeadlineExceeded)
+	assert.Equal(t, []string{"commit", "rollback", "rollback"}, tm.outcomes)
+}
+
+// newRecordingRunner return the Runner of a manager on the recordingdriver.Driver of the datasource name, the row of
+// a job exists if exists tells so and is free if free does
+func newRecordingRunner(t *testing.T, name string, exists, free *bool) (*Runner, *recordingdriver.Driver) {
+	d := &recordingdriver.Driver{Results: func(query string) ([]string, [][]driver.Value) {
+		switch {
+		case strings.HasPrefix(query, "SELECT count(*)") && *exists:
+			return []string{"count"}, [][]driver.Value{{int64(1)}}
+		case strings.HasPrefix(query, "SELECT count(*)"):
+			return []string{"count"}, [][]driver.Value{{int64(0)}}
+		case *free:
+			return []string{"name", "started_at"}, [][]driver.Value{{"nightly", nil}}
+		}
+		return []string{"name", "started_at"}, nil
+	}}
+	factory, err := sql.NewCachedDBFactory(recordingdriver.Creator{Name: "jobs-recording-" + name, Source: "jobs", Driver: d})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Runner{tm: sql.NewTransactionManager(factory)}, d
+}
+
+const (
+	countLock  = "SELECT count(*) FROM `ptx_job_locks` WHERE name = ?"
+	createLock = "INSERT INTO `ptx_job_locks` (`name`,`started_at`) VALUES (?,?) ON DUPLICATE KEY UPDATE `name`=`name`"
+	lockJob    = "SELECT * FROM `ptx_job_locks` WHERE name = ? LIMIT 1 FOR UPDATE SKIP LOCKED"
+	startJob   = "UPDATE `ptx_job_locks` SET `started_at`=? WHERE `name` = ?"
+)
+
+func TestRunner_Run_Lock(t *testing.T) {
+	exists, free := false, true
+	r, d := newRecordingRunner(t, "lock", &exists, &free)
+	ctx := context.Background()
+	runs := 0
+	job := Job{Name: "nightly", Fn: func(ctx context.Context, tx *gorm.DB) error {
+		runs++
+		return nil
+	}}
+
+	// the row of the job is created on its first run
+	assert.NoError(t, r.Run(ctx, job))
+	assert.Equal(t, []string{countLock, "BEGIN", createLock, "COMMIT", "BEGIN", lockJob, startJob, "COMMIT"}, d.Statements())
+
+	// a run overlapping another one is skipped
+	d.Reset()
+	exists, free = true, false
+	assert.ErrorIs(t, r.Run(ctx, job), ErrJobRunning)
+	assert.Equal(t, []string{"BEGIN", lockJob, "ROLLBACK"}, d.Statements())
+	assert.Equal(t, 1, runs)
+
+	// the row of a job known to exist isn't counted again
+	d.Reset()
+	free = true
+	assert.NoError(t, r.Run(ctx, job))
+	assert.Equal(t, []string{"BEGIN", lockJob, startJob, "COMMIT"}, d.Statements())
+	assert.Equal(t, 2, runs)
+
+	// a row created by another process isn't created again
+	r, d = newRecordingRunner(t, "lock-created", &exists, &free)
+	assert.NoError(t, r.Run(ctx, job))
+	assert.Equal(t, []string{countLock, "BEGIN", lockJob, startJob, "COMMIT"}, d.Statements())
+}
@@ -0,0 +1,61 @@
+package mongotx
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"propagation-tx/sql"
+)
+
+// Resource enlists MongoDB multi-document transactions in the transactions of a sql.TransactionManager,
+// so services mixing MySQL and MongoDB use one propagation API.
+//
+// The MongoDB transaction is committed after the gorm transaction, atomicity is guaranteed per resource only.
+type Resource struct {
+	client *mongo.Client
+	opts   []*options.TransactionOptions
+}
+
+// NewResource return a Resource starting sessions on client
+func NewResource(client *mongo.Client, opts ...*options.TransactionOptions) *Resource {
+	return &Resource{
+		client: client,
+		opts:   opts,
+	}
+}
+
+func (r *Resource) Begin(ctx context.Context) (sql.ResourceTransaction, error) {
+	session, err := r.client.StartSession()
+	if err != nil {
+		return nil, err
+	}
+	if err = session.StartTransaction(r.opts...); err != nil {
+		session.EndSession(ctx)
+		return nil, err
+	}
+	return &sessionTransaction{session: session}, nil
+}
+
+// Context return a ctx bound to the session of the ambient transaction, mongo operations must use it to take
+// part in the transaction. ctx is returned as it is when there is no ambient transaction.
+func (r *Resource) Context(ctx context.Context) context.Context {
+	if tx, ok := sql.ResourceTx(ctx, r).(*sessionTransaction); ok {
+		return mongo.NewSessionContext(ctx, tx.session)
+	}
+	return ctx
+}
+
+// sessionTransaction is a transaction on a dedicated mongo session
+type sessionTransaction struct {
+	session mongo.Session
+}
+
+func (t *sessionTransaction) Commit(ctx context.Context) error {
+	defer t.session.EndSession(ctx)
+	return t.session.CommitTransaction(ctx)
+}
+
+func (t *sessionTransaction) Rollback(ctx context.Context) error {
+	defer t.session.EndSession(ctx)
+	return t.session.AbortTransaction(ctx)
+}
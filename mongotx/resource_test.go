@@ -0,0 +1,94 @@
+package mongotx
+
+import (
+	"context"
+	stdsql "database/sql"
+	"database/sql/driver"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"propagation-tx/sql"
+	"sync"
+	"testing"
+)
+
+// stubDriver is a database/sql driver whose connections execute any statement successfully
+type stubDriver struct{}
+
+type stubConn struct{}
+
+type stubTx struct{}
+
+func (stubDriver) Open(string) (driver.Conn, error) { return stubConn{}, nil }
+
+func (stubConn) Prepare(string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (stubConn) Close() error                        { return nil }
+func (stubConn) Begin() (driver.Tx, error)           { return stubTx{}, nil }
+
+func (stubTx) Commit() error   { return nil }
+func (stubTx) Rollback() error { return nil }
+
+var registerStub sync.Once
+
+// stubCreator is a sql.CacheableDBCreator of the mysql dialect on stubDriver
+type stubCreator struct {
+	key string
+}
+
+func (c stubCreator) CreateDB() (*gorm.DB, error) {
+	registerStub.Do(func() {
+		stdsql.Register("mongotx-stub", stubDriver{})
+	})
+	db, err := stdsql.Open("mongotx-stub", "")
+	if err != nil {
+		return nil, err
+	}
+	return gorm.Open(mysql.New(mysql.Config{Conn: db, SkipInitializeWithVersion: true}), &gorm.Config{Logger: logger.Discard})
+}
+func (c stubCreator) CacheKey() string    { return c.key }
+func (c stubCreator) CacheSource() string { return "mongotx" }
+
+func TestResource(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	newManager := func(mt *mtest.T) (sql.TransactionManager, *Resource) {
+		factory, err := sql.NewCachedDBFactory(stubCreator{key: mt.Name()})
+		if err != nil {
+			mt.Fatal(err)
+		}
+		resource := NewResource(mt.Client)
+		return sql.NewTransactionManager(factory, sql.WithResources(resource)), resource
+	}
+
+	mt.Run("commit", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse())
+		tm, resource := newManager(mt)
+		err := tm.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+			assert.NotNil(mt, mongo.SessionFromContext(resource.Context(ctx)))
+			return insert(mt)(resource.Context(ctx))
+		})
+		assert.NoError(mt, err)
+		assert.Equal(mt, []string{"tx:insert", "tx:commitTransaction"}, commands(mt))
+	})
+
+	mt.Run("abort", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse())
+		tm, resource := newManager(mt)
+		err := tm.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+			_ = insert(mt)(resource.Context(ctx))
+			return mockErr
+		})
+		assert.ErrorIs(mt, err, mockErr)
+		assert.Equal(mt, []string{"tx:insert", "tx:abortTransaction"}, commands(mt))
+	})
+
+	mt.Run("without transaction", func(mt *mtest.T) {
+		_, resource := newManager(mt)
+		ctx := context.Background()
+		assert.Equal(mt, ctx, resource.Context(ctx))
+	})
+}
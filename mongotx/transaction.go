@@ -0,0 +1,118 @@
+package mongotx
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"propagation-tx/sql"
+)
+
+// ErrNestedUnsupported is returned by PropagationNested inside a transaction, MongoDB has no savepoints
+var ErrNestedUnsupported = errors.New("PropagationNested isn't supported inside a MongoDB transaction")
+
+// TransactionManager runs bizFn in multi-document transactions of a mongo.Client with the propagations of the sql
+// package, for services storing in MongoDB only. Resource enlists MongoDB in the transactions of a
+// sql.TransactionManager instead.
+//
+// The ctx given to bizFn carries the session of the transaction, mongo operations must use it to take part in it.
+// PropagationNested starts a transaction like PropagationRequired outside of one, and fails with
+// ErrNestedUnsupported inside.
+type TransactionManager struct {
+	client *mongo.Client
+	opts   []*options.TransactionOptions
+}
+
+// NewTransactionManager return the TransactionManager starting sessions on client, opts apply to its transactions
+func NewTransactionManager(client *mongo.Client, opts ...*options.TransactionOptions) *TransactionManager {
+	return &TransactionManager{
+		client: client,
+		opts:   opts,
+	}
+}
+
+// transactionKey looks up the session of the transaction of client in a ctx
+type transactionKey struct {
+	client *mongo.Client
+}
+
+// sessionOf return the session of the ambient transaction of m in ctx
+func (m *TransactionManager) sessionOf(ctx context.Context) (mongo.Session, bool) {
+	session, ok := ctx.Value(transactionKey{m.client}).(mongo.Session)
+	return session, ok && session != nil
+}
+
+// Transaction runs bizFn with propagation, PropagationRequired if none is given. An error or a panic of bizFn aborts
+// the transaction it started, the panic is propagated afterwards.
+func (m *TransactionManager) Transaction(ctx context.Context, bizFn func(ctx context.Context) error, propagation ...sql.TransactionPropagation) error {
+	p := sql.PropagationRequired
+	if len(propagation) > 0 {
+		p = propagation[0]
+	}
+	_, inTransaction := m.sessionOf(ctx)
+	switch p {
+	case sql.PropagationRequired:
+		if inTransaction {
+			return bizFn(ctx)
+		}
+		return m.runRoot(ctx, bizFn)
+	case sql.PropagationSupports:
+		return bizFn(ctx)
+	case sql.PropagationMandatory:
+		if !inTransaction {
+			return sql.ErrMandatoryPropWithoutTransaction
+		}
+		return bizFn(ctx)
+	case sql.PropagationRequiresNew:
+		return m.runRoot(ctx, bizFn)
+	case sql.PropagationNotSupported:
+		if inTransaction {
+			// the nil session hides the one of the transaction from the mongo operations as well
+			ctx = mongo.NewSessionContext(context.WithValue(ctx, transactionKey{m.client}, mongo.Session(nil)), nil)
+		}
+		return bizFn(ctx)
+	case sql.PropagationNested:
+		if inTransaction {
+			return ErrNestedUnsupported
+		}
+		return m.runRoot(ctx, bizFn)
+	case sql.PropagationNever:
+		if inTransaction {
+			return sql.ErrNeverPropInTransaction
+		}
+		return bizFn(ctx)
+	default:
+		panic("not supported propagation")
+	}
+}
+
+// runRoot runs bizFn in a transaction on a new session, committed if bizFn succeeded
+func (m *TransactionManager) runRoot(ctx context.Context, bizFn func(ctx context.Context) error) (err error) {
+	session, err := m.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+	if err = session.StartTransaction(m.opts...); err != nil {
+		return err
+	}
+	txCtx := mongo.NewSessionContext(context.WithValue(ctx, transactionKey{m.client}, session), session)
+	panicked, committing := true, false
+	defer func() {
+		if panicked || err != nil && !committing {
+			if abortErr := session.AbortTransaction(ctx); abortErr != nil && err != nil {
+				err = &sql.RollbackError{Cause: abortErr, Original: err}
+			}
+		}
+	}()
+	err = bizFn(txCtx)
+	panicked = false
+	if err != nil {
+		return err
+	}
+	committing = true
+	if err = session.CommitTransaction(txCtx); err != nil {
+		return &sql.CommitError{Cause: err}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package mongotx
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"propagation-tx/sql"
+	"testing"
+)
+
+var mockErr = errors.New("mock error")
+
+// commands return the names of the commands started by the client of mt, the ones run in a transaction prefixed with
+// "tx:"
+func commands(mt *mtest.T) []string {
+	var names []string
+	for _, event := range mt.GetAllStartedEvents() {
+		name := event.CommandName
+		if _, err := event.Command.LookupErr("autocommit"); err == nil {
+			name = "tx:" + name
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func insert(mt *mtest.T) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		_, err := mt.Coll.InsertOne(ctx, bson.D{{Key: "x", Value: 1}})
+		return err
+	}
+}
+
+func TestTransactionManager_Transaction(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("commit", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse())
+		tm := NewTransactionManager(mt.Client)
+		err := tm.Transaction(context.Background(), func(ctx context.Context) error {
+			session := mongo.SessionFromContext(ctx)
+			assert.NotNil(mt, session)
+			_ = insert(mt)(ctx)
+			_ = tm.Transaction(ctx, func(ctx context.Context) error {
+				assert.Same(mt, session, mongo.SessionFromContext(ctx))
+				return insert(mt)(ctx)
+			}, sql.PropagationMandatory)
+			_ = tm.Transaction(ctx, func(ctx context.Context) error {
+				assert.Nil(mt, mongo.SessionFromContext(ctx))
+				return insert(mt)(ctx)
+			}, sql.PropagationNotSupported)
+			assert.ErrorIs(mt, tm.Transaction(ctx, insert(mt), sql.PropagationNested), ErrNestedUnsupported)
+			assert.ErrorIs(mt, tm.Transaction(ctx, insert(mt), sql.PropagationNever), sql.ErrNeverPropInTransaction)
+			return nil
+		})
+		assert.NoError(mt, err)
+		assert.Equal(mt, []string{"tx:insert", "tx:insert", "insert", "tx:commitTransaction"}, commands(mt))
+	})
+
+	mt.Run("abort", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse())
+		tm := NewTransactionManager(mt.Client)
+		err := tm.Transaction(context.Background(), func(ctx context.Context) error {
+			_ = insert(mt)(ctx)
+			return mockErr
+		})
+		assert.ErrorIs(mt, err, mockErr)
+		assert.Equal(mt, []string{"tx:insert", "tx:abortTransaction"}, commands(mt))
+	})
+
+	mt.Run("requires new", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse())
+		tm := NewTransactionManager(mt.Client)
+		err := tm.Transaction(context.Background(), func(ctx context.Context) error {
+			_ = insert(mt)(ctx)
+			outer := mongo.SessionFromContext(ctx)
+			return tm.Transaction(ctx, func(ctx context.Context) error {
+				assert.NotSame(mt, outer, mongo.SessionFromContext(ctx))
+				return insert(mt)(ctx)
+			}, sql.PropagationRequiresNew)
+		})
+		assert.NoError(mt, err)
+		assert.Equal(mt, []string{"tx:insert", "tx:insert", "tx:commitTransaction", "tx:commitTransaction"}, commands(mt))
+	})
+
+	mt.Run("commit error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(), mtest.CreateCommandErrorResponse(mtest.CommandError{
+			Code: 251, Name: "NoSuchTransaction", Message: "transaction aborted",
+		}))
+		tm := NewTransactionManager(mt.Client)
+		err := tm.Transaction(context.Background(), insert(mt))
+		var commitErr *sql.CommitError
+		assert.ErrorAs(mt, err, &commitErr)
+	})
+
+	mt.Run("without transaction", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+		tm := NewTransactionManager(mt.Client)
+		assert.ErrorIs(mt, tm.Transaction(context.Background(), insert(mt), sql.PropagationMandatory),
+			sql.ErrMandatoryPropWithoutTransaction)
+		assert.NoError(mt, tm.Transaction(context.Background(), insert(mt), sql.PropagationNever))
+		assert.Equal(mt, []string{"insert"}, commands(mt))
+	})
+}
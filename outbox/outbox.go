@@ -0,0 +1,133 @@
+// Package outbox implements the transactional outbox: messages are written to the outbox table in the
+// transaction of the caller, so they're only published if it commits, and a relay delivers them to a Sink
+// afterwards with at-least-once semantics.
+package outbox
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log"
+	"propagation-tx/sql"
+	"time"
+)
+
+var ErrNoSink = errors.New("outbox relay without sink")
+
+// Message is a row of the outbox table
+type Message struct {
+	ID           uint64     `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	Topic        string     `gorm:"column:topic;type:varchar(255);not null" json:"topic"`
+	Payload      []byte     `gorm:"column:payload;not null" json:"payload"`
+	CreatedAt    time.Time  `gorm:"column:created_at;not null" json:"createdAt"`
+	DispatchedAt *time.Time `gorm:"column:dispatched_at;index" json:"dispatchedAt,omitempty"`
+	// Attempts counts the failed deliveries of the message
+	Attempts int `gorm:"column:attempts;not null;default:0" json:"attempts"`
+}
+
+func (m *Message) TableName() string {
+	return "outbox"
+}
+
+// Sink delivers the messages of the outbox, e.g. to a Kafka topic or a NATS subject. A message may be delivered
+// more than once if the relay fails to record its delivery, consumers must be idempotent.
+type Sink interface {
+	Send(ctx context.Context, message Message) error
+}
+
+// SinkFunc is a func implementing Sink
+type SinkFunc func(ctx context.Context, message Message) error
+
+func (f SinkFunc) Send(ctx context.Context, message Message) error {
+	return f(ctx, message)
+}
+
+// Outbox writes messages in the transactions of a sql.TransactionManager
+type Outbox struct {
+	tm sql.TransactionManager
+}
+
+// New return the Outbox of tm, creating or migrating its table
+func New(tm sql.TransactionManager) (*Outbox, error) {
+	if err := tm.GetOriginDB().AutoMigrate(&Message{}); err != nil {
+		return nil, err
+	}
+	return &Outbox{tm: tm}, nil
+}
+
+// Enqueue writes a message of topic to the outbox in the transaction of ctx, or in a transaction of its own if ctx
+// is not in transaction. It's dispatched by the relay once that transaction committed.
+func (o *Outbox) Enqueue(ctx context.Context, topic string, payload []byte) error {
+	return o.tm.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+		return tx.Create(&Message{Topic: topic, Payload: payload, CreatedAt: time.Now()}).Error
+	}, sql.PropagationRequired)
+}
+
+// Relay configures the delivery of the messages of an Outbox
+type Relay struct {
+	Sink Sink
+	// BatchSize is the maximum number of messages delivered per poll, 100 by default
+	BatchSize int
+	// Interval is the wait between polls once no message is pending, 1s by default
+	Interval time.Duration
+}
+
+// Run delivers the pending messages with relay until ctx is done, in the order they were enqueued. Several relays
+// may run on the same outbox, a message is locked by the relay delivering it.
+func (o *Outbox) Run(ctx context.Context, relay Relay) error {
+	if relay.Sink == nil {
+		return ErrNoSink
+	}
+	if relay.BatchSize <= 0 {
+		relay.BatchSize = 100
+	}
+	if relay.Interval <= 0 {
+		relay.Interval = time.Second
+	}
+	for {
+		dispatched, err := o.Dispatch(ctx, relay.Sink, relay.BatchSize)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("[TX] outbox relay error: %v", err)
+		}
+		if dispatched == relay.BatchSize {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(relay.Interval):
+		}
+	}
+}
+
+// Dispatch delivers up to limit pending messages to sink and return how many were delivered. It stops at the first
+// failed delivery, so later messages don't overtake it.
+func (o *Outbox) Dispatch(ctx context.Context, sink Sink, limit int) (dispatched int, err error) {
+	var sendErr error
+	err = o.tm.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+		var messages []Message
+		query := tx.Where("dispatched_at IS NULL").Order("id").Limit(limit)
+		if name := tx.Dialector.Name(); name == "mysql" || name == "postgres" {
+			query = query.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+		}
+		if err := query.Find(&messages).Error; err != nil {
+			return err
+		}
+		for _, message := range messages {
+			if sendErr = sink.Send(ctx, message); sendErr != nil {
+				// the failed attempt is committed with the deliveries before it
+				return tx.Model(&message).UpdateColumn("attempts", gorm.Expr("attempts + 1")).Error
+			}
+			if err := tx.Model(&message).UpdateColumn("dispatched_at", time.Now()).Error; err != nil {
+				return err
+			}
+			dispatched++
+		}
+		return nil
+	}, sql.PropagationRequiresNew)
+	if err != nil {
+		return 0, err
+	}
+	return dispatched, sendErr
+}
@@ -0,0 +1,100 @@
+package outbox
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"propagation-tx/internal/recordingdriver"
+	"propagation-tx/sql"
+	"strings"
+	"testing"
+	"time"
+)
+
+var mockErr = errors.New("mock error")
+
+// newRecordingOutbox return the Outbox of a manager on a recordingdriver.Driver whose queries return the rows of
+// messages, its table isn't migrated
+func newRecordingOutbox(t *testing.T) (*Outbox, *recordingdriver.Driver) {
+	d := &recordingdriver.Driver{Columns: []string{"id", "topic", "payload", "created_at", "dispatched_at", "attempts"}}
+	factory, err := sql.NewCachedDBFactory(recordingdriver.Creator{Name: "outbox-recording-" + t.Name(), Source: "outbox", Driver: d})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Outbox{tm: sql.NewTransactionManager(factory)}, d
+}
+
+// messageRows return the rows of messages
+func messageRows(messages ...Message) [][]driver.Value {
+	rows := make([][]driver.Value, len(messages))
+	for i, m := range messages {
+		rows[i] = []driver.Value{int64(m.ID), m.Topic, m.Payload, m.CreatedAt, nil, int64(m.Attempts)}
+	}
+	return rows
+}
+
+const (
+	insertMessage  = "INSERT INTO `outbox` (`topic`,`payload`,`created_at`,`dispatched_at`,`attempts`) VALUES (?,?,?,?,?)"
+	selectPending  = "SELECT * FROM `outbox` WHERE dispatched_at IS NULL ORDER BY id LIMIT 10 FOR UPDATE SKIP LOCKED"
+	markDispatched = "UPDATE `outbox` SET `dispatched_at`=? WHERE `id` = ?"
+	countAttempt   = "UPDATE `outbox` SET `attempts`=attempts + 1 WHERE `id` = ?"
+)
+
+func TestOutbox_Enqueue(t *testing.T) {
+	o, d := newRecordingOutbox(t)
+	ctx := context.Background()
+
+	err := o.tm.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+		assert.NoError(t, o.Enqueue(ctx, "orders", []byte("1")))
+		assert.NoError(t, o.Enqueue(ctx, "orders", []byte("2")))
+		return mockErr
+	})
+	assert.ErrorIs(t, err, mockErr)
+	assert.NoError(t, o.Enqueue(ctx, "orders", []byte("3")))
+	assert.Equal(t, strings.Join([]string{"BEGIN", insertMessage, insertMessage, "ROLLBACK", "BEGIN", insertMessage, "COMMIT"}, "\n"),
+		strings.Join(d.Statements(), "\n"))
+}
+
+func TestOutbox_Dispatch(t *testing.T) {
+	o, d := newRecordingOutbox(t)
+	d.SetRows(messageRows(Message{ID: 1, Topic: "orders"}, Message{ID: 2, Topic: "orders"}, Message{ID: 3, Topic: "orders"}))
+	var sent []uint64
+	sink := SinkFunc(func(ctx context.Context, message Message) error {
+		if message.ID == 2 {
+			return mockErr
+		}
+		sent = append(sent, message.ID)
+		return nil
+	})
+
+	// the dispatch runs in a transaction of its own, even called in one
+	err := o.tm.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+		dispatched, err := o.Dispatch(ctx, sink, 10)
+		assert.ErrorIs(t, err, mockErr)
+		assert.Equal(t, 1, dispatched)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{1}, sent)
+	assert.Equal(t, strings.Join([]string{"BEGIN", "BEGIN", selectPending, markDispatched, countAttempt, "COMMIT", "COMMIT"}, "\n"),
+		strings.Join(d.Statements(), "\n"))
+}
+
+func TestOutbox_Run(t *testing.T) {
+	o, d := newRecordingOutbox(t)
+	assert.ErrorIs(t, o.Run(context.Background(), Relay{}), ErrNoSink)
+
+	d.SetRows(messageRows(Message{ID: 1, Topic: "orders"}))
+	ctx, cancel := context.WithCancel(context.Background())
+	var sent []uint64
+	err := o.Run(ctx, Relay{BatchSize: 10, Interval: time.Millisecond, Sink: SinkFunc(func(ctx context.Context, message Message) error {
+		sent = append(sent, message.ID)
+		d.SetRows(nil)
+		cancel()
+		return nil
+	})})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, []uint64{1}, sent)
+}
@@ -0,0 +1,151 @@
+// Package pgxtx implements the propagations of propagation-tx natively on a pgx pool, for Postgres services not
+// using gorm:
+//
+//	tm := pgxtx.NewPgxTransactionManager(pool)
+//	err := tm.Transaction(ctx, func(ctx context.Context, q pgxtx.Querier) error {
+//		_, err := q.Exec(ctx, "INSERT INTO orders (id) VALUES ($1)", id)
+//		return err
+//	}, ptx.PropagationRequired) // ptx "propagation-tx/sql"
+//
+// PropagationNested runs in a sub-transaction of pgx (tx.Begin), i.e. a savepoint of the enclosing transaction.
+package pgxtx
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	ptx "propagation-tx/sql"
+)
+
+// Querier runs the statements of a bizFn: the pgx.Tx of its transaction, or the pool without transaction
+type Querier interface {
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
+	CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error)
+}
+
+// TransactionManager runs bizFn with the propagations of the sql package on a *pgxpool.Pool
+type TransactionManager struct {
+	pool *pgxpool.Pool
+	// txOptions are the options of the root transactions begun by Transaction
+	txOptions pgx.TxOptions
+}
+
+// NewPgxTransactionManager return the TransactionManager of pool, its root transactions begin with txOptions if
+// given (isolation level, access mode...), the defaults of the server otherwise
+func NewPgxTransactionManager(pool *pgxpool.Pool, txOptions ...pgx.TxOptions) *TransactionManager {
+	m := &TransactionManager{pool: pool}
+	if len(txOptions) > 0 {
+		m.txOptions = txOptions[0]
+	}
+	return m
+}
+
+// transactionKey looks up the transaction of pool in a ctx
+type transactionKey struct {
+	pool *pgxpool.Pool
+}
+
+// transactionOf return the innermost transaction of m in ctx, the sub-transaction of a Nested block included
+func (m *TransactionManager) transactionOf(ctx context.Context) (pgx.Tx, bool) {
+	tx, ok := ctx.Value(transactionKey{m.pool}).(pgx.Tx)
+	return tx, ok && tx != nil
+}
+
+// Querier return the pgx.Tx of the ambient transaction of ctx, or the pool
+func (m *TransactionManager) Querier(ctx context.Context) Querier {
+	if tx, ok := m.transactionOf(ctx); ok {
+		return tx
+	}
+	return m.pool
+}
+
+// Transaction runs bizFn with propagation, PropagationRequired if none is given. An error or a panic of bizFn rolls
+// back the transaction (or the sub-transaction) it started, the panic is propagated afterwards.
+func (m *TransactionManager) Transaction(ctx context.Context, bizFn func(ctx context.Context, q Querier) error, propagation ...ptx.TransactionPropagation) error {
+	return m.TransactionWithOptions(ctx, m.txOptions, bizFn, propagation...)
+}
+
+// TransactionWithOptions is Transaction beginning a root transaction with txOptions instead of the ones of the
+// manager. Calls joining an ambient transaction keep its options.
+func (m *TransactionManager) TransactionWithOptions(ctx context.Context, txOptions pgx.TxOptions, bizFn func(ctx context.Context, q Querier) error, propagation ...ptx.TransactionPropagation) error {
+	p := ptx.PropagationRequired
+	if len(propagation) > 0 {
+		p = propagation[0]
+	}
+	tx, inTransaction := m.transactionOf(ctx)
+	switch p {
+	case ptx.PropagationRequired:
+		if inTransaction {
+			return bizFn(ctx, tx)
+		}
+		return m.runRoot(ctx, txOptions, bizFn)
+	case ptx.PropagationSupports:
+		return bizFn(ctx, m.Querier(ctx))
+	case ptx.PropagationMandatory:
+		if !inTransaction {
+			return ptx.ErrMandatoryPropWithoutTransaction
+		}
+		return bizFn(ctx, tx)
+	case ptx.PropagationRequiresNew:
+		return m.runRoot(ctx, txOptions, bizFn)
+	case ptx.PropagationNotSupported:
+		return bizFn(m.withoutTransaction(ctx), m.pool)
+	case ptx.PropagationNested:
+		if inTransaction {
+			return m.run(ctx, func(ctx context.Context) (pgx.Tx, error) { return tx.Begin(ctx) }, bizFn)
+		}
+		return m.runRoot(ctx, txOptions, bizFn)
+	case ptx.PropagationNever:
+		if inTransaction {
+			return ptx.ErrNeverPropInTransaction
+		}
+		return bizFn(ctx, m.pool)
+	default:
+		panic("not supported propagation")
+	}
+}
+
+// withoutTransaction return ctx hiding the transaction of m
+func (m *TransactionManager) withoutTransaction(ctx context.Context) context.Context {
+	if _, ok := m.transactionOf(ctx); !ok {
+		return ctx
+	}
+	return context.WithValue(ctx, transactionKey{m.pool}, pgx.Tx(nil))
+}
+
+// runRoot runs bizFn in a new transaction of the pool, committed if bizFn succeeded
+func (m *TransactionManager) runRoot(ctx context.Context, txOptions pgx.TxOptions, bizFn func(ctx context.Context, q Querier) error) error {
+	return m.run(ctx, func(ctx context.Context) (pgx.Tx, error) { return m.pool.BeginTx(ctx, txOptions) }, bizFn)
+}
+
+// run runs bizFn in the transaction begun by begin: committed (or released for a sub-transaction) if bizFn
+// succeeded, rolled back otherwise
+func (m *TransactionManager) run(ctx context.Context, begin func(ctx context.Context) (pgx.Tx, error), bizFn func(ctx context.Context, q Querier) error) (err error) {
+	tx, err := begin(ctx)
+	if err != nil {
+		return err
+	}
+	panicked, committing := true, false
+	defer func() {
+		// a failed commit already ended the transaction
+		if panicked || err != nil && !committing {
+			if rollbackErr := tx.Rollback(ctx); rollbackErr != nil && err != nil {
+				err = &ptx.RollbackError{Cause: rollbackErr, Original: err}
+			}
+		}
+	}()
+	err = bizFn(context.WithValue(ctx, transactionKey{m.pool}, tx), tx)
+	panicked = false
+	if err != nil {
+		return err
+	}
+	committing = true
+	if err = tx.Commit(ctx); err != nil {
+		return &ptx.CommitError{Cause: err}
+	}
+	return nil
+}
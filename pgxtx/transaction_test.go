@@ -0,0 +1,201 @@
+package pgxtx
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"net"
+	ptx "propagation-tx/sql"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordingServer is a Postgres server recording the simple queries of its connections and answering all of them
+// successfully, it fails the commits when failCommit is set
+type recordingServer struct {
+	listener   net.Listener
+	mu         sync.Mutex
+	log        []string
+	failCommit bool
+}
+
+func newRecordingServer(t *testing.T) *recordingServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &recordingServer{listener: listener}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { _ = listener.Close() })
+	return s
+}
+
+func (s *recordingServer) serve(conn net.Conn) {
+	defer conn.Close()
+	backend := pgproto3.NewBackend(conn, conn)
+	if _, err := backend.ReceiveStartupMessage(); err != nil {
+		return
+	}
+	backend.Send(&pgproto3.AuthenticationOk{})
+	backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+	if backend.Flush() != nil {
+		return
+	}
+	txStatus := byte('I')
+	for {
+		msg, err := backend.Receive()
+		if err != nil {
+			return
+		}
+		query, ok := msg.(*pgproto3.Query)
+		if !ok {
+			return
+		}
+		s.mu.Lock()
+		s.log = append(s.log, query.String)
+		failCommit := s.failCommit
+		s.mu.Unlock()
+		statement := strings.ToLower(query.String)
+		switch {
+		case statement == "commit" && failCommit:
+			backend.Send(&pgproto3.ErrorResponse{Severity: "ERROR", Code: "40001", Message: "could not serialize access"})
+			txStatus = 'I'
+		case strings.HasPrefix(statement, "begin"):
+			backend.Send(&pgproto3.CommandComplete{CommandTag: []byte("BEGIN")})
+			txStatus = 'T'
+		case statement == "commit" || statement == "rollback":
+			backend.Send(&pgproto3.CommandComplete{CommandTag: []byte(strings.ToUpper(statement))})
+			txStatus = 'I'
+		default:
+			backend.Send(&pgproto3.CommandComplete{CommandTag: []byte("INSERT 0 1")})
+		}
+		backend.Send(&pgproto3.ReadyForQuery{TxStatus: txStatus})
+		if backend.Flush() != nil {
+			return
+		}
+	}
+}
+
+// Log return the queries recorded so far, separated by commas
+func (s *recordingServer) Log() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return strings.Join(s.log, ",")
+}
+
+func (s *recordingServer) reset(failCommit bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.log, s.failCommit = nil, failCommit
+}
+
+var mockErr = errors.New("mock error")
+
+func newRecordingManager(t *testing.T, txOptions ...pgx.TxOptions) (*TransactionManager, *recordingServer) {
+	s := newRecordingServer(t)
+	pool, err := pgxpool.New(context.Background(), "postgres://test@"+s.listener.Addr().String()+"/test?sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	return NewPgxTransactionManager(pool, txOptions...), s
+}
+
+func exec(statement string) func(ctx context.Context, q Querier) error {
+	return func(ctx context.Context, q Querier) error {
+		_, err := q.Exec(ctx, statement)
+		return err
+	}
+}
+
+func TestTransactionManager_Transaction(t *testing.T) {
+	tm, s := newRecordingManager(t)
+	ctx := context.Background()
+
+	err := tm.Transaction(ctx, func(ctx context.Context, q Querier) error {
+		_ = exec("a")(ctx, q)
+		_ = tm.Transaction(ctx, exec("b"), ptx.PropagationRequired)
+		_ = tm.Transaction(ctx, exec("c"), ptx.PropagationMandatory)
+		_ = tm.Transaction(ctx, func(ctx context.Context, q Querier) error {
+			_ = exec("d")(ctx, q)
+			return mockErr
+		}, ptx.PropagationNested)
+		_ = tm.Transaction(ctx, exec("e"), ptx.PropagationNested)
+		assert.ErrorIs(t, tm.Transaction(ctx, exec("f"), ptx.PropagationNever), ptx.ErrNeverPropInTransaction)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "begin,a,b,c,savepoint sp_1,d,rollback to savepoint sp_1,savepoint sp_2,e,release savepoint sp_2,commit",
+		s.Log())
+
+	s.reset(false)
+	err = tm.Transaction(ctx, func(ctx context.Context, q Querier) error {
+		_ = exec("a")(ctx, q)
+		_ = tm.Transaction(ctx, func(ctx context.Context, q Querier) error {
+			_, inTransaction := tm.transactionOf(ctx)
+			assert.False(t, inTransaction)
+			return exec("b")(ctx, q)
+		}, ptx.PropagationNotSupported)
+		return mockErr
+	})
+	assert.ErrorIs(t, err, mockErr)
+	assert.Equal(t, "begin,a,b,rollback", s.Log())
+
+	s.reset(false)
+	assert.ErrorIs(t, tm.Transaction(ctx, exec("a"), ptx.PropagationMandatory), ptx.ErrMandatoryPropWithoutTransaction)
+	assert.NoError(t, tm.Transaction(ctx, exec("a"), ptx.PropagationNever))
+	assert.NoError(t, tm.Transaction(ctx, exec("b"), ptx.PropagationSupports))
+	assert.NoError(t, tm.Transaction(ctx, exec("c"), ptx.PropagationNested))
+	assert.Panics(t, func() {
+		_ = tm.Transaction(ctx, func(ctx context.Context, q Querier) error {
+			panic(mockErr)
+		})
+	})
+	assert.Equal(t, "a,b,begin,c,commit,begin,rollback", s.Log())
+}
+
+func TestTransactionManager_RequiresNew(t *testing.T) {
+	tm, s := newRecordingManager(t)
+	ctx := context.Background()
+
+	err := tm.Transaction(ctx, func(ctx context.Context, q Querier) error {
+		_ = exec("a")(ctx, q)
+		_ = tm.Transaction(ctx, exec("b"), ptx.PropagationRequiresNew)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "begin,a,begin,b,commit,commit", s.Log())
+}
+
+func TestTransactionManager_TxOptions(t *testing.T) {
+	tm, s := newRecordingManager(t, pgx.TxOptions{IsoLevel: pgx.Serializable, AccessMode: pgx.ReadOnly})
+	ctx := context.Background()
+
+	assert.NoError(t, tm.Transaction(ctx, exec("a")))
+	assert.NoError(t, tm.TransactionWithOptions(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead}, func(ctx context.Context, q Querier) error {
+		return tm.TransactionWithOptions(ctx, pgx.TxOptions{IsoLevel: pgx.Serializable}, exec("b"))
+	}))
+	assert.Equal(t, "begin isolation level serializable read only,a,commit,begin isolation level repeatable read,b,commit", s.Log())
+}
+
+func TestTransactionManager_CommitError(t *testing.T) {
+	tm, s := newRecordingManager(t)
+	s.reset(true)
+
+	err := tm.Transaction(context.Background(), exec("a"))
+	var commitErr *ptx.CommitError
+	assert.ErrorAs(t, err, &commitErr)
+	assert.Equal(t, "begin,a,commit", s.Log())
+}
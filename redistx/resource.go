@@ -0,0 +1,150 @@
+package redistx
+
+import (
+	"context"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"net"
+	"propagation-tx/sql"
+)
+
+// Resource enlists a redis MULTI/EXEC pipeline in the transactions of a sql.TransactionManager.
+//
+// Commands issued through Cmdable during a transaction are buffered and sent as one MULTI/EXEC after the
+// gorm transaction committed, or discarded when it rolls back, so redis never sees changes of a rolled back
+// transaction. The commands of a failed PropagationNested block are discarded with its savepoint. Results of
+// buffered commands are only available after the commit.
+type Resource struct {
+	client redis.UniversalClient
+	multi  bool
+}
+
+// buffer builds the pipelines handed out by Cmdable, its pipelines never reach a server. It's shared by the
+// resources since it holds no connection.
+var buffer = newBuffer()
+
+func newBuffer() *redis.Client {
+	client := redis.NewClient(&redis.Options{})
+	client.AddHook(bufferHook{})
+	return client
+}
+
+// ResourceOption configures a Resource
+type ResourceOption func(r *Resource)
+
+// WithoutMulti sends the buffered commands as a plain pipeline rather than MULTI/EXEC: other clients may see the
+// commands applied partially, but the pipeline can span the slots of a redis cluster
+func WithoutMulti() ResourceOption {
+	return func(r *Resource) {
+		r.multi = false
+	}
+}
+
+// NewResource return a Resource queueing commands of client
+func NewResource(client redis.UniversalClient, opts ...ResourceOption) *Resource {
+	r := &Resource{client: client, multi: true}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+func (r *Resource) Begin(ctx context.Context) (sql.ResourceTransaction, error) {
+	return &pipelineTransaction{resource: r, pipe: buffer.Pipeline()}, nil
+}
+
+// Cmdable return the pipeline buffering the commands of the ambient transaction, or the client itself
+// executing commands immediately when there is no ambient transaction
+func (r *Resource) Cmdable(ctx context.Context) redis.Cmdable {
+	if tx, ok := sql.ResourceTx(ctx, r).(*pipelineTransaction); ok {
+		return tx.pipe
+	}
+	return r.client
+}
+
+// bufferHook keeps the pipelines of the buffer client from being sent, Exec only hands their commands back
+type bufferHook struct{}
+
+func (bufferHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(context.Context, string, string) (net.Conn, error) {
+		return nil, errors.New("the redistx buffer doesn't connect")
+	}
+}
+
+func (bufferHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return next
+}
+
+func (bufferHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(context.Context, []redis.Cmder) error {
+		return nil
+	}
+}
+
+// pipelineTransaction buffers the commands of a transaction, sent in a MULTI/EXEC pipeline on commit
+type pipelineTransaction struct {
+	resource *Resource
+	// pipe queues the commands issued since the last savepoint
+	pipe redis.Pipeliner
+	// cmds are the commands queued before the last savepoint
+	cmds []redis.Cmder
+	// savepoints are the live savepoints, in the order they were created
+	savepoints []savepoint
+}
+
+// savepoint is the number of commands queued before a savepoint
+type savepoint struct {
+	name string
+	cmds int
+}
+
+// flush moves the commands of pipe to cmds
+func (t *pipelineTransaction) flush(ctx context.Context) {
+	cmds, _ := t.pipe.Exec(ctx)
+	t.cmds = append(t.cmds, cmds...)
+}
+
+func (t *pipelineTransaction) Savepoint(ctx context.Context, name string) error {
+	t.flush(ctx)
+	t.savepoints = append(t.savepoints, savepoint{name: name, cmds: len(t.cmds)})
+	return nil
+}
+
+// RollbackTo discards the commands queued after the savepoint name, and the savepoints created after it like SQL
+// does: they can't be rolled back to anymore
+func (t *pipelineTransaction) RollbackTo(ctx context.Context, name string) error {
+	for i := len(t.savepoints) - 1; i >= 0; i-- {
+		if sp := t.savepoints[i]; sp.name == name {
+			t.pipe.Discard()
+			t.cmds = t.cmds[:sp.cmds]
+			t.savepoints = t.savepoints[:i+1]
+			return nil
+		}
+	}
+	return errors.New("unknown savepoint " + name)
+}
+
+func (t *pipelineTransaction) Commit(ctx context.Context) error {
+	t.flush(ctx)
+	if len(t.cmds) == 0 {
+		return nil
+	}
+	pipe := t.resource.client.Pipeline()
+	if t.resource.multi {
+		pipe = t.resource.client.TxPipeline()
+	}
+	for _, cmd := range t.cmds {
+		_ = pipe.Process(ctx, cmd)
+	}
+	// redis.Nil only means a queued read found nothing, the EXEC itself succeeded
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return err
+	}
+	return nil
+}
+
+func (t *pipelineTransaction) Rollback(ctx context.Context) error {
+	t.pipe.Discard()
+	t.cmds, t.savepoints = nil, nil
+	return nil
+}
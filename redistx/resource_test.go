@@ -0,0 +1,114 @@
+package redistx
+
+import (
+	"context"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"strings"
+	"testing"
+)
+
+// recordingHook records the pipelines of a client instead of sending them, one line per command
+type recordingHook struct {
+	pipelines *[][]string
+}
+
+func (h recordingHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return nil, fmt.Errorf("dial %s: recording client", addr)
+	}
+}
+
+func (h recordingHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return next
+}
+
+func (h recordingHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		var lines []string
+		for _, cmd := range cmds {
+			args := make([]string, len(cmd.Args()))
+			for i, arg := range cmd.Args() {
+				args[i] = fmt.Sprint(arg)
+			}
+			lines = append(lines, strings.Join(args, " "))
+		}
+		*h.pipelines = append(*h.pipelines, lines)
+		return nil
+	}
+}
+
+// newRecordingResource return a Resource on a client recording its pipelines in the returned slice
+func newRecordingResource(opts ...ResourceOption) (*Resource, *[][]string) {
+	pipelines := &[][]string{}
+	client := redis.NewClient(&redis.Options{Addr: "localhost:1"})
+	client.AddHook(recordingHook{pipelines: pipelines})
+	return NewResource(client, opts...), pipelines
+}
+
+// begin return a pipelineTransaction of resource
+func begin(t *testing.T, resource *Resource) *pipelineTransaction {
+	tx, err := resource.Begin(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tx.(*pipelineTransaction)
+}
+
+func TestPipelineTransaction_Commit(t *testing.T) {
+	ctx := context.Background()
+	resource, pipelines := newRecordingResource()
+	tx := begin(t, resource)
+	tx.pipe.Set(ctx, "a", 1, 0)
+	tx.pipe.Incr(ctx, "b")
+	assert.Empty(t, *pipelines)
+	assert.NoError(t, tx.Commit(ctx))
+	assert.Equal(t, [][]string{{"multi", "set a 1", "incr b", "exec"}}, *pipelines)
+
+	resource, pipelines = newRecordingResource(WithoutMulti())
+	tx = begin(t, resource)
+	tx.pipe.Set(ctx, "a", 1, 0)
+	assert.NoError(t, tx.Commit(ctx))
+	assert.Equal(t, [][]string{{"set a 1"}}, *pipelines)
+}
+
+func TestPipelineTransaction_Rollback(t *testing.T) {
+	ctx := context.Background()
+	resource, pipelines := newRecordingResource()
+	tx := begin(t, resource)
+	tx.pipe.Set(ctx, "a", 1, 0)
+	assert.NoError(t, tx.Savepoint(ctx, "sp1"))
+	tx.pipe.Set(ctx, "b", 1, 0)
+	assert.NoError(t, tx.Rollback(ctx))
+	assert.NoError(t, tx.Commit(ctx))
+	assert.Empty(t, *pipelines)
+}
+
+func TestPipelineTransaction_RollbackTo(t *testing.T) {
+	ctx := context.Background()
+	resource, pipelines := newRecordingResource()
+	tx := begin(t, resource)
+	tx.pipe.Set(ctx, "a", 1, 0)
+	assert.NoError(t, tx.Savepoint(ctx, "sp1"))
+	tx.pipe.Set(ctx, "b", 1, 0)
+	assert.NoError(t, tx.Savepoint(ctx, "sp2"))
+	tx.pipe.Set(ctx, "c", 1, 0)
+	assert.NoError(t, tx.RollbackTo(ctx, "sp1"))
+	// sp2 was created after sp1, it went with the rollback
+	assert.Error(t, tx.RollbackTo(ctx, "sp2"))
+	tx.pipe.Set(ctx, "d", 1, 0)
+	assert.NoError(t, tx.Savepoint(ctx, "sp3"))
+	tx.pipe.Set(ctx, "e", 1, 0)
+	assert.NoError(t, tx.RollbackTo(ctx, "sp3"))
+	assert.NoError(t, tx.RollbackTo(ctx, "sp1"))
+	tx.pipe.Set(ctx, "f", 1, 0)
+	assert.NoError(t, tx.Commit(ctx))
+	assert.Equal(t, [][]string{{"multi", "set a 1", "set f 1", "exec"}}, *pipelines)
+}
+
+func TestResource_Cmdable(t *testing.T) {
+	resource, _ := newRecordingResource()
+	assert.Equal(t, resource.client, resource.Cmdable(context.Background()))
+}
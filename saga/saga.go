@@ -0,0 +1,154 @@
+// Package saga runs a sequence of steps which can't share a database transaction (calls to other services, local
+// transactions of several datasources) as a saga: once a step fails, the steps completed before it are undone by
+// their compensations in reverse order.
+//
+//	err := saga.New(tm).
+//		LocalStep("order", createOrder, cancelOrder).
+//		Step("payment", charge, refund).
+//		Run(ctx)
+package saga
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"gorm.io/gorm"
+	"propagation-tx/envelope"
+	"propagation-tx/sql"
+	"strings"
+)
+
+// Saga is an ordered list of steps with their compensations, built with Step and LocalStep
+type Saga struct {
+	tm    sql.TransactionManager
+	steps []step
+}
+
+type step struct {
+	name       string
+	action     func(ctx context.Context) error
+	compensate func(ctx context.Context) error
+}
+
+// New return an empty Saga, tm runs its local steps and may be nil if there is none
+func New(tm sql.TransactionManager) *Saga {
+	return &Saga{tm: tm}
+}
+
+// Step appends a step running action, compensate undoes it once a later step failed (it may be nil for a step
+// without side effect, e.g. a validation)
+func (s *Saga) Step(name string, action, compensate func(ctx context.Context) error) *Saga {
+	s.steps = append(s.steps, step{name: name, action: action, compensate: compensate})
+	return s
+}
+
+// LocalStep appends a step whose action and compensation run each in a transaction of their own
+// (PropagationRequiresNew) of the manager of the Saga, so the action is committed once the step completed
+func (s *Saga) LocalStep(name string, action, compensate func(ctx context.Context, tx *gorm.DB) error) *Saga {
+	local := func(fn func(ctx context.Context, tx *gorm.DB) error) func(ctx context.Context) error {
+		if fn == nil {
+			return nil
+		}
+		return func(ctx context.Context) error {
+			return s.tm.Transaction(ctx, fn, sql.PropagationRequiresNew)
+		}
+	}
+	return s.Step(name, local(action), local(compensate))
+}
+
+// Run runs the steps in order. If one fails, the compensations of the steps completed before it run in reverse
+// order and Run return an *Error; the failed step is expected to leave no side effect.
+//
+// The steps run with the envelope.Envelope of ctx, whose SagaID is generated if missing and whose BranchID is the
+// name of the step, so the services called by a step can correlate their branches.
+func (s *Saga) Run(ctx context.Context) error {
+	env, _ := envelope.FromContext(ctx)
+	if env.SagaID == "" {
+		env.SagaID = newSagaID()
+	}
+	for i, st := range s.steps {
+		if err := st.action(branch(ctx, env, st.name)); err != nil {
+			return &Error{
+				SagaID:        env.SagaID,
+				Step:          st.name,
+				Cause:         err,
+				Compensations: s.compensate(ctx, env, i),
+			}
+		}
+	}
+	return nil
+}
+
+// compensate runs the compensations of the steps before failed in reverse order, it return their failures
+func (s *Saga) compensate(ctx context.Context, env envelope.Envelope, failed int) []CompensationError {
+	var errs []CompensationError
+	for i := failed - 1; i >= 0; i-- {
+		st := s.steps[i]
+		if st.compensate == nil {
+			continue
+		}
+		// a failed compensation doesn't stop the others, each step is undone as far as possible
+		if err := st.compensate(branch(ctx, env, st.name)); err != nil {
+			errs = append(errs, CompensationError{Step: st.name, Cause: err})
+		}
+	}
+	return errs
+}
+
+// branch return the ctx of the step name
+func branch(ctx context.Context, env envelope.Envelope, name string) context.Context {
+	env.BranchID = name
+	return envelope.NewContext(ctx, env)
+}
+
+func newSagaID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Error is returned by Run when a step failed, after the compensations of the steps before it ran
+type Error struct {
+	SagaID string
+	// Step is the name of the failed step
+	Step  string
+	Cause error
+	// Compensations are the failed compensations, the saga is only partially undone if there is any
+	Compensations []CompensationError
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("saga %s: step %s failed: %v", e.SagaID, e.Step, e.Cause)
+	if len(e.Compensations) > 0 {
+		failures := make([]string, len(e.Compensations))
+		for i, c := range e.Compensations {
+			failures[i] = c.Error()
+		}
+		msg += " (" + strings.Join(failures, ", ") + ")"
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+// Compensated tells whether every step before the failed one was undone
+func (e *Error) Compensated() bool {
+	return len(e.Compensations) == 0
+}
+
+// CompensationError is the failure of the compensation of Step
+type CompensationError struct {
+	Step  string
+	Cause error
+}
+
+func (e CompensationError) Error() string {
+	return fmt.Sprintf("compensation of %s failed: %v", e.Step, e.Cause)
+}
+
+func (e CompensationError) Unwrap() error {
+	return e.Cause
+}
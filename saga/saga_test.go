@@ -0,0 +1,41 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"propagation-tx/envelope"
+	"testing"
+)
+
+func TestSaga_Run(t *testing.T) {
+	var called []string
+	record := func(name string, err error) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			env, _ := envelope.FromContext(ctx)
+			assert.Equal(t, "saga-1", env.SagaID)
+			called = append(called, name+"@"+env.BranchID)
+			return err
+		}
+	}
+	ctx := envelope.NewContext(context.Background(), envelope.Envelope{SagaID: "saga-1"})
+	failure, compensationFailure := errors.New("failure"), errors.New("compensation failure")
+
+	err := New(nil).
+		Step("a", record("do", nil), record("undo", nil)).
+		Step("b", record("do", nil), record("undo", compensationFailure)).
+		Step("c", record("do", nil), nil).
+		Step("d", record("do", failure), record("undo", nil)).
+		Run(ctx)
+	assert.Equal(t, []string{"do@a", "do@b", "do@c", "do@d", "undo@b", "undo@a"}, called)
+	assert.ErrorIs(t, err, failure)
+	var sagaErr *Error
+	assert.ErrorAs(t, err, &sagaErr)
+	assert.Equal(t, "d", sagaErr.Step)
+	assert.False(t, sagaErr.Compensated())
+	assert.Equal(t, []CompensationError{{Step: "b", Cause: compensationFailure}}, sagaErr.Compensations)
+
+	called = nil
+	assert.NoError(t, New(nil).Step("a", record("do", nil), record("undo", nil)).Run(ctx))
+	assert.Equal(t, []string{"do@a"}, called)
+}
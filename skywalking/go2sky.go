@@ -0,0 +1,51 @@
+package skywalking
+
+import (
+	"context"
+	"github.com/SkyAPM/go2sky"
+	agentv3 "skywalking.apache.org/repo/goapi/collect/language/agent/v3"
+	"time"
+)
+
+// go2skyTracer is the Tracer of a go2sky.Tracer
+type go2skyTracer struct {
+	tracer *go2sky.Tracer
+}
+
+// NewGo2SkyTracer return the Tracer creating the spans with tracer
+func NewGo2SkyTracer(tracer *go2sky.Tracer) Tracer {
+	return go2skyTracer{tracer: tracer}
+}
+
+func (t go2skyTracer) CreateExitSpan(ctx context.Context, operationName string, peer string) (Span, context.Context, error) {
+	// a database doesn't continue the trace, there's no header to inject its context into
+	span, spanCtx, err := t.tracer.CreateExitSpanWithContext(ctx, operationName, peer, func(string, string) error {
+		return nil
+	})
+	if err != nil {
+		return nil, ctx, err
+	}
+	span.SetSpanLayer(agentv3.SpanLayer_Database)
+	return go2skySpan{span: span}, spanCtx, nil
+}
+
+// go2skySpan is the Span of a go2sky.Span
+type go2skySpan struct {
+	span go2sky.Span
+}
+
+func (s go2skySpan) SetComponent(componentID int32) {
+	s.span.SetComponent(componentID)
+}
+
+func (s go2skySpan) Tag(key string, value string) {
+	s.span.Tag(go2sky.Tag(key), value)
+}
+
+func (s go2skySpan) Error(err error) {
+	s.span.Error(time.Now(), err.Error())
+}
+
+func (s go2skySpan) End() {
+	s.span.End()
+}
@@ -0,0 +1,167 @@
+// Package skywalking reports the transactions and statements of propagation-tx to SkyWalking as exit spans on the
+// Database layer, with the go2sky tracer of the service:
+//
+//	tracer := skywalking.NewGo2SkyTracer(go2skyTracer)
+//	config := skywalking.Config{Peer: "localhost:3306", DBInstance: "orders"}
+//	tm := sql.NewTransactionManager(factory, sql.WithObservers(skywalking.NewTransactionObserver(tracer, config)))
+//	_ = db.Use(skywalking.NewPlugin(tracer, config))
+//
+// The spans are created through the small Tracer interface, the services on another SkyWalking client (e.g. the
+// skywalking-go toolkit) adapt it to Tracer like NewGo2SkyTracer does for go2sky.
+package skywalking
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"propagation-tx/sql"
+)
+
+// Component IDs of SkyWalking component-libraries.yml
+const (
+	ComponentIDGoMysql int32 = 5012
+)
+
+// Tags of database spans
+const (
+	TagDBType      = "db.type"
+	TagDBInstance  = "db.instance"
+	TagDBStatement = "db.statement"
+)
+
+// Tracer creates SkyWalking exit spans on the Database layer
+type Tracer interface {
+	CreateExitSpan(ctx context.Context, operationName string, peer string) (Span, context.Context, error)
+}
+
+// Span is a SkyWalking span
+type Span interface {
+	SetComponent(componentID int32)
+	Tag(key string, value string)
+	Error(err error)
+	End()
+}
+
+// Config describes the datasource the spans are about
+type Config struct {
+	// Peer is the address of the database, e.g. localhost:3306
+	Peer string
+	// ComponentID defaults to ComponentIDGoMysql
+	ComponentID int32
+	// DBType is the value of the db.type tag, defaults to Mysql
+	DBType string
+	// DBInstance is the value of the db.instance tag, usually the database name
+	DBInstance string
+}
+
+func (c Config) withDefaults() Config {
+	if c.ComponentID == 0 {
+		c.ComponentID = ComponentIDGoMysql
+	}
+	if c.DBType == "" {
+		c.DBType = "Mysql"
+	}
+	return c
+}
+
+type spanKey struct{}
+
+// TransactionObserver is a sql.TransactionObserver creating an exit span for every root transaction,
+// register it with sql.WithObservers
+type TransactionObserver struct {
+	tracer Tracer
+	config Config
+}
+
+func NewTransactionObserver(tracer Tracer, config Config) *TransactionObserver {
+	return &TransactionObserver{tracer: tracer, config: config.withDefaults()}
+}
+
+func (o *TransactionObserver) TransactionStarted(ctx context.Context, info sql.TransactionInfo) context.Context {
+	span, spanCtx, err := o.tracer.CreateExitSpan(ctx, "propagation-tx/Transaction/"+info.Propagation.String(), o.config.Peer)
+	if err != nil {
+		return ctx
+	}
+	o.config.decorate(span)
+	return context.WithValue(spanCtx, spanKey{}, span)
+}
+
+func (o *TransactionObserver) TransactionFinished(ctx context.Context, info sql.TransactionInfo, err error) {
+	span, ok := ctx.Value(spanKey{}).(Span)
+	if !ok {
+		return
+	}
+	if err != nil {
+		span.Error(err)
+	}
+	span.End()
+}
+
+func (c Config) decorate(span Span) {
+	span.SetComponent(c.ComponentID)
+	span.Tag(TagDBType, c.DBType)
+	if c.DBInstance != "" {
+		span.Tag(TagDBInstance, c.DBInstance)
+	}
+}
+
+// Plugin is a gorm plugin creating an exit span for every statement, register it with db.Use
+type Plugin struct {
+	tracer Tracer
+	config Config
+}
+
+func NewPlugin(tracer Tracer, config Config) *Plugin {
+	return &Plugin{tracer: tracer, config: config.withDefaults()}
+}
+
+func (p *Plugin) Name() string {
+	return "propagation-tx:skywalking"
+}
+
+func (p *Plugin) Initialize(db *gorm.DB) error {
+	callbacks := db.Callback()
+	for _, err := range []error{
+		callbacks.Create().Before("gorm:create").Register(p.Name()+":before_create", p.before("Create")),
+		callbacks.Create().After("gorm:create").Register(p.Name()+":after_create", p.after),
+		callbacks.Query().Before("gorm:query").Register(p.Name()+":before_query", p.before("Query")),
+		callbacks.Query().After("gorm:query").Register(p.Name()+":after_query", p.after),
+		callbacks.Update().Before("gorm:update").Register(p.Name()+":before_update", p.before("Update")),
+		callbacks.Update().After("gorm:update").Register(p.Name()+":after_update", p.after),
+		callbacks.Delete().Before("gorm:delete").Register(p.Name()+":before_delete", p.before("Delete")),
+		callbacks.Delete().After("gorm:delete").Register(p.Name()+":after_delete", p.after),
+		callbacks.Row().Before("gorm:row").Register(p.Name()+":before_row", p.before("Row")),
+		callbacks.Row().After("gorm:row").Register(p.Name()+":after_row", p.after),
+		callbacks.Raw().Before("gorm:raw").Register(p.Name()+":before_raw", p.before("Raw")),
+		callbacks.Raw().After("gorm:raw").Register(p.Name()+":after_raw", p.after),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Plugin) before(operation string) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		// the ctx of the statement is kept, it may carry the transaction context of propagation-tx
+		span, _, err := p.tracer.CreateExitSpan(db.Statement.Context, "gorm/"+operation, p.config.Peer)
+		if err != nil {
+			return
+		}
+		p.config.decorate(span)
+		db.InstanceSet(p.Name(), span)
+	}
+}
+
+func (p *Plugin) after(db *gorm.DB) {
+	value, ok := db.InstanceGet(p.Name())
+	if !ok {
+		return
+	}
+	span := value.(Span)
+	span.Tag(TagDBStatement, db.Statement.SQL.String())
+	if db.Error != nil {
+		span.Error(db.Error)
+	}
+	span.End()
+}
@@ -0,0 +1,117 @@
+package skywalking
+
+import (
+	"context"
+	stdsql "database/sql"
+	"database/sql/driver"
+	"errors"
+	"github.com/SkyAPM/go2sky"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"propagation-tx/sql"
+	agentv3 "skywalking.apache.org/repo/goapi/collect/language/agent/v3"
+	"testing"
+	"time"
+)
+
+// recordingReporter is a go2sky.Reporter handing the spans of the segments it's sent to spans
+type recordingReporter struct {
+	spans chan go2sky.ReportedSpan
+}
+
+func (r *recordingReporter) Boot(string, string, []go2sky.AgentConfigChangeWatcher) {}
+
+func (r *recordingReporter) Send(spans []go2sky.ReportedSpan) {
+	for _, span := range spans {
+		r.spans <- span
+	}
+}
+
+func (r *recordingReporter) Close() {}
+
+// next return the next span reported to r
+func (r *recordingReporter) next(t *testing.T) go2sky.ReportedSpan {
+	select {
+	case span := <-r.spans:
+		return span
+	case <-time.After(5 * time.Second):
+		t.Fatal("no span reported")
+		return nil
+	}
+}
+
+// tags return the tags of span by key
+func tags(span go2sky.ReportedSpan) map[string]string {
+	tags := make(map[string]string)
+	for _, tag := range span.Tags() {
+		tags[tag.Key] = tag.Value
+	}
+	return tags
+}
+
+func newGo2SkyTracer(t *testing.T) (Tracer, *recordingReporter) {
+	reporter := &recordingReporter{spans: make(chan go2sky.ReportedSpan, 16)}
+	tracer, err := go2sky.NewTracer("propagation-tx-test", go2sky.WithReporter(reporter))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewGo2SkyTracer(tracer), reporter
+}
+
+var mockErr = errors.New("mock error")
+
+func TestTransactionObserver(t *testing.T) {
+	tracer, reporter := newGo2SkyTracer(t)
+	observer := NewTransactionObserver(tracer, Config{Peer: "localhost:3306", DBInstance: "orders"})
+	info := sql.TransactionInfo{ID: "1", Propagation: sql.PropagationRequiresNew}
+	ctx := observer.TransactionStarted(context.Background(), info)
+	observer.TransactionFinished(ctx, info, mockErr)
+
+	span := reporter.next(t)
+	assert.Equal(t, "propagation-tx/Transaction/RequiresNew", span.OperationName())
+	assert.Equal(t, "localhost:3306", span.Peer())
+	assert.Equal(t, agentv3.SpanType_Exit, span.SpanType())
+	assert.Equal(t, agentv3.SpanLayer_Database, span.SpanLayer())
+	assert.Equal(t, ComponentIDGoMysql, span.ComponentID())
+	assert.True(t, span.IsError())
+	assert.Equal(t, map[string]string{TagDBType: "Mysql", TagDBInstance: "orders"}, tags(span))
+}
+
+// execDriver is a database/sql driver whose connections execute any statement successfully
+type execDriver struct{}
+
+type execConn struct{}
+
+type execTx struct{}
+
+func (execDriver) Open(string) (driver.Conn, error) { return execConn{}, nil }
+
+func (execConn) Prepare(string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (execConn) Close() error                        { return nil }
+func (execConn) Begin() (driver.Tx, error)           { return execTx{}, nil }
+func (execConn) ExecContext(context.Context, string, []driver.NamedValue) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+
+func (execTx) Commit() error   { return nil }
+func (execTx) Rollback() error { return nil }
+
+func TestPlugin(t *testing.T) {
+	stdsql.Register("skywalking-exec", execDriver{})
+	conn, err := stdsql.Open("skywalking-exec", "")
+	assert.NoError(t, err)
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: conn, SkipInitializeWithVersion: true}),
+		&gorm.Config{Logger: logger.Discard})
+	assert.NoError(t, err)
+	tracer, reporter := newGo2SkyTracer(t)
+	assert.NoError(t, db.Use(NewPlugin(tracer, Config{Peer: "localhost:3306", DBType: "Postgresql"})))
+
+	assert.NoError(t, db.Exec("UPDATE users SET age = ?", 1).Error)
+	span := reporter.next(t)
+	assert.Equal(t, "gorm/Raw", span.OperationName())
+	assert.Equal(t, agentv3.SpanLayer_Database, span.SpanLayer())
+	assert.False(t, span.IsError())
+	assert.Equal(t, map[string]string{TagDBType: "Postgresql", TagDBStatement: "UPDATE users SET age = ?"}, tags(span))
+}
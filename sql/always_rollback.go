@@ -0,0 +1,46 @@
+package sql
+
+import (
+	"context"
+	"gorm.io/gorm"
+)
+
+// WithAlwaysRollback makes every transaction of the manager roll back at the end even on success, e.g. for
+// production dry runs or test isolation. The calls run normally otherwise, and the ones which would run outside of
+// transaction (Supports without transaction, NotSupported, Never) run in a transaction rolled back as well, so
+// nothing they write is kept. AfterCommit hooks never run.
+func WithAlwaysRollback() ManagerOption {
+	return func(m *transactionManager) {
+		m.alwaysRollback = true
+	}
+}
+
+// AlwaysRollback rolls back what the call wrote even if it succeeds: its root transaction if it begins one, its
+// savepoint with PropagationNested in a transaction, and the whole enclosing transaction if it joins one.
+// Calls which would run outside of transaction run in a transaction rolled back at the end.
+func AlwaysRollback() TxOption {
+	return txOptionFunc(func(o *txOptions) {
+		o.alwaysRollback = true
+	})
+}
+
+// rollsBackAlways tells whether the call with o must roll back what it writes
+func (m *transactionManager) rollsBackAlways(o *txOptions) bool {
+	return m.alwaysRollback || o.alwaysRollback
+}
+
+// markAlwaysRollback makes the transaction of ctx roll back at the end if the call with o joins it
+func (m *transactionManager) markAlwaysRollback(ctx context.Context, propagation TransactionPropagation, o *txOptions) {
+	if !o.alwaysRollback || !propagation.joins() || propagation == PropagationNested {
+		return
+	}
+	if txCtx, ok := m.transactionOf(ctx); ok {
+		txCtx.root().alwaysRollback = true
+	}
+}
+
+// withoutTransactionRollback runs bizFn of a call outside of transaction in a root transaction rolled back at the end
+func (m *transactionManager) withoutTransactionRollback(ctx context.Context, bizFn func(ctx context.Context, tx *gorm.DB) error, o *txOptions) error {
+	o.alwaysRollback = true
+	return m.runRoot(ctx, m.getPureDB(ctx), bizFn, o)
+}
@@ -0,0 +1,73 @@
+package sql
+
+import (
+	"context"
+	stdsql "database/sql"
+	"errors"
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+type beginRetry struct {
+	attempts int
+	backoff  time.Duration
+	maxDelay time.Duration
+}
+
+// WithBeginRetry retries beginning a root transaction up to attempts times when Begin fails (pool exhaustion,
+// connection reset, failover), waiting backoff then doubling it up to maxDelay between attempts.
+// Errors of bizFn and of the commit are never retried.
+func WithBeginRetry(attempts int, backoff, maxDelay time.Duration) ManagerOption {
+	return func(m *transactionManager) {
+		m.beginRetry = &beginRetry{attempts: attempts, backoff: backoff, maxDelay: maxDelay}
+	}
+}
+
+// begin begins a transaction on db, retried according to the beginRetry of m. conn is the connection acquired
+// for the transaction with the poolAcquireTimeout of m, to close once the transaction completed.
+func (m *transactionManager) begin(ctx context.Context, db *gorm.DB, opts *stdsql.TxOptions) (tx *gorm.DB, conn *stdsql.Conn) {
+	tx, conn = m.beginOnce(ctx, db, opts)
+	if m.beginRetry == nil {
+		return tx, conn
+	}
+	delay := m.beginRetry.backoff
+	for i := 0; i < m.beginRetry.attempts && tx.Error != nil; i++ {
+		if errors.Is(tx.Error, context.Canceled) || errors.Is(tx.Error, context.DeadlineExceeded) {
+			return tx, conn
+		}
+		log.Printf("[TX] begin transaction error, retry %d/%d in %s: %v", i+1, m.beginRetry.attempts, delay, tx.Error)
+		select {
+		case <-ctx.Done():
+			return tx, conn
+		case <-m.clock.After(delay):
+		}
+		tx, conn = m.beginOnce(ctx, db, opts)
+		if delay *= 2; delay > m.beginRetry.maxDelay {
+			delay = m.beginRetry.maxDelay
+		}
+	}
+	return tx, conn
+}
+
+// beginOnce begins a transaction on db, on a connection acquired within the poolAcquireTimeout of m if any
+func (m *transactionManager) beginOnce(ctx context.Context, db *gorm.DB, opts *stdsql.TxOptions) (*gorm.DB, *stdsql.Conn) {
+	timeout := m.txDefaults.poolAcquireTimeout
+	if timeout <= 0 {
+		return db.Begin(opts), nil
+	}
+	conn, err := acquireConn(ctx, db, timeout)
+	if err != nil {
+		tx := db.Session(&gorm.Session{})
+		_ = tx.AddError(err)
+		return tx, nil
+	}
+	tx := db.Session(&gorm.Session{})
+	tx.Statement.ConnPool = conn
+	tx = tx.Begin(opts)
+	if tx.Error != nil {
+		_ = conn.Close()
+		return tx, nil
+	}
+	return tx, conn
+}
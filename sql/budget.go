@@ -0,0 +1,82 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrTransactionBudgetExceeded = errors.New("transaction budget exceeded")
+
+type budgetKey struct{}
+
+// transactionBudget accumulates the time spent in the root transactions started with a ctx
+type transactionBudget struct {
+	mu      sync.Mutex
+	limit   time.Duration
+	spent   time.Duration
+	active  int
+	startAt time.Time
+	// clock is the clock of the manager of the first transaction
+	clock Clock
+}
+
+// WithTransactionBudget return a ctx accounting the time spent inside transactions, typically one per request.
+// Once the accumulated time reaches limit, starting another root transaction with the ctx fails with
+// ErrTransactionBudgetExceeded; a limit <= 0 only accounts. Overlapping transactions (e.g. RequiresNew) are
+// accounted once.
+func WithTransactionBudget(ctx context.Context, limit time.Duration) context.Context {
+	return context.WithValue(ctx, budgetKey{}, &transactionBudget{limit: limit, clock: systemClock{}})
+}
+
+// TransactionTime return the time spent inside transactions with ctx, ctx must come from WithTransactionBudget
+func TransactionTime(ctx context.Context) time.Duration {
+	budget, _ := ctx.Value(budgetKey{}).(*transactionBudget)
+	if budget == nil {
+		return 0
+	}
+	budget.mu.Lock()
+	defer budget.mu.Unlock()
+	spent := budget.spent
+	if budget.active > 0 {
+		spent += budget.clock.Now().Sub(budget.startAt)
+	}
+	return spent
+}
+
+func budgetOf(ctx context.Context) *transactionBudget {
+	budget, _ := ctx.Value(budgetKey{}).(*transactionBudget)
+	return budget
+}
+
+// enter is called when a root transaction of a manager of clock starts
+func (b *transactionBudget) enter(clock Clock) error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.limit > 0 && b.spent >= b.limit {
+		return ErrTransactionBudgetExceeded
+	}
+	if b.active == 0 {
+		b.clock = clock
+		b.startAt = clock.Now()
+	}
+	b.active++
+	return nil
+}
+
+// exit is called when a root transaction completes
+func (b *transactionBudget) exit() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.active--
+	if b.active == 0 {
+		b.spent += b.clock.Now().Sub(b.startAt)
+	}
+}
@@ -0,0 +1,53 @@
+package sql
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"propagation-tx/internal/recordingdriver"
+	"testing"
+	"time"
+)
+
+func TestWithTransactionBudget(t *testing.T) {
+	clock := newFakeClock()
+	d := &recordingdriver.Driver{}
+	manager := newRecordingManager(t, d, WithClock(clock))
+	ctx := WithTransactionBudget(context.Background(), 2*time.Second)
+	assert.Zero(t, TransactionTime(context.Background()))
+
+	err := manager.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+		clock.Advance(time.Second)
+		assert.Equal(t, time.Second, TransactionTime(ctx))
+		// overlapping transactions are accounted once
+		return manager.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+			clock.Advance(500 * time.Millisecond)
+			return nil
+		}, PropagationRequiresNew)
+	})
+	assert.NoError(t, err)
+	// the time outside of transactions isn't accounted
+	clock.Advance(time.Minute)
+	assert.Equal(t, 1500*time.Millisecond, TransactionTime(ctx))
+
+	assert.NoError(t, manager.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+		clock.Advance(time.Second)
+		return nil
+	}))
+	assert.Equal(t, 2500*time.Millisecond, TransactionTime(ctx))
+	d.Reset()
+	assert.ErrorIs(t, manager.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+		return nil
+	}), ErrTransactionBudgetExceeded)
+	assert.Empty(t, d.Statements())
+
+	// a limit <= 0 only accounts
+	ctx = WithTransactionBudget(context.Background(), 0)
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, manager.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+			clock.Advance(time.Hour)
+			return nil
+		}))
+	}
+	assert.Equal(t, 2*time.Hour, TransactionTime(ctx))
+}
@@ -0,0 +1,105 @@
+package sql
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+)
+
+// QueryCache is the backend of CachedQuery, values are JSON encoded
+type QueryCache interface {
+	// Get return the value of key, ok is false on cache miss
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+	// Set stores value with key for ttl
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+var (
+	queryCacheMu sync.RWMutex
+	queryCache   QueryCache
+)
+
+// SetQueryCache set the backend of CachedQuery, nil to disable caching
+func SetQueryCache(cache QueryCache) {
+	queryCacheMu.Lock()
+	defer queryCacheMu.Unlock()
+	queryCache = cache
+}
+
+// CachedQuery return the result of fetchFn cached with key for ttl.
+// Inside a transaction the cache is bypassed, neither read nor written, so the transaction reads its own writes
+// and uncommitted results never reach the cache. Cache errors are logged and fall back to fetchFn.
+func CachedQuery[T any](ctx context.Context, key string, ttl time.Duration, fetchFn func(ctx context.Context) (T, error)) (T, error) {
+	queryCacheMu.RLock()
+	cache := queryCache
+	queryCacheMu.RUnlock()
+	if _, ok := currentTransaction(ctx); cache == nil || ok {
+		return fetchFn(ctx)
+	}
+
+	if data, ok, err := cache.Get(ctx, key); err != nil {
+		log.Printf("[DB] get cached query %s error: %v", key, err)
+	} else if ok {
+		var value T
+		if err = json.Unmarshal(data, &value); err == nil {
+			return value, nil
+		}
+		log.Printf("[DB] decode cached query %s error: %v", key, err)
+	}
+
+	value, err := fetchFn(ctx)
+	if err != nil {
+		return value, err
+	}
+	if data, err := json.Marshal(value); err != nil {
+		log.Printf("[DB] encode cached query %s error: %v", key, err)
+	} else if err = cache.Set(ctx, key, data, ttl); err != nil {
+		log.Printf("[DB] set cached query %s error: %v", key, err)
+	}
+	return value, nil
+}
+
+// MemoryQueryCache is an in-process QueryCache
+type MemoryQueryCache struct {
+	mu      sync.Mutex
+	entries map[string]memoryCacheEntry
+	clock   Clock
+}
+
+type memoryCacheEntry struct {
+	value    []byte
+	expireAt time.Time
+}
+
+// NewMemoryQueryCache return an empty MemoryQueryCache
+func NewMemoryQueryCache() *MemoryQueryCache {
+	return NewMemoryQueryCacheWithClock(systemClock{})
+}
+
+// NewMemoryQueryCacheWithClock return an empty MemoryQueryCache expiring its entries according to clock
+func NewMemoryQueryCacheWithClock(clock Clock) *MemoryQueryCache {
+	return &MemoryQueryCache{entries: make(map[string]memoryCacheEntry), clock: clock}
+}
+
+func (c *MemoryQueryCache) Get(_ context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	if c.clock.Now().After(entry.expireAt) {
+		delete(c.entries, key)
+		return nil, false, nil
+	}
+	return entry.value, true, nil
+}
+
+func (c *MemoryQueryCache) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = memoryCacheEntry{value: value, expireAt: c.clock.Now().Add(ttl)}
+	return nil
+}
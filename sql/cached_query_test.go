@@ -0,0 +1,54 @@
+package sql
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"testing"
+	"time"
+)
+
+func TestCachedQuery(t *testing.T) {
+	cache := NewMemoryQueryCache()
+	SetQueryCache(cache)
+	defer SetQueryCache(nil)
+	count := func(ctx context.Context) (int64, error) {
+		var n int64
+		err := tm.GetDB(ctx).Model(&User{}).Where("username = ?", user1.Username).Count(&n).Error
+		return n, err
+	}
+
+	DefaultTransactionTest("test-bypass-cache-derived-ctx", t, func() {
+		_ = tm.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+			tx.Create(user1)
+			timeoutCtx, cancel := context.WithTimeout(ctx, time.Minute)
+			defer cancel()
+			n, err := CachedQuery(timeoutCtx, "count-user1", time.Minute, count)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(1), n)
+			return mockErr
+		}, PropagationRequired)
+	}, func(t *testing.T) {
+		_, cached, _ := cache.Get(context.Background(), "count-user1")
+		assert.False(t, cached)
+		n, err := CachedQuery(context.Background(), "count-user1", time.Minute, count)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), n)
+	})
+}
+
+func TestMemoryQueryCache_Expiry(t *testing.T) {
+	clock := newFakeClock()
+	cache := NewMemoryQueryCacheWithClock(clock)
+	ctx := context.Background()
+	assert.NoError(t, cache.Set(ctx, "key", []byte("1"), time.Minute))
+	clock.Advance(time.Minute)
+	value, ok, err := cache.Get(ctx, "key")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []byte("1"), value)
+	clock.Advance(time.Second)
+	_, ok, err = cache.Get(ctx, "key")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
@@ -0,0 +1,142 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	"gorm.io/gorm"
+	"hash/fnv"
+	"sync/atomic"
+	"time"
+)
+
+// routingKey is the key of the routing key of a ctx
+type routingKey struct{}
+
+// WithRoutingKey return a ctx whose transactions are routed by key, e.g. a user id,
+// so the same key always goes to the same datasource for a given percentage
+func WithRoutingKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, routingKey{}, key)
+}
+
+// RouteStats are the metrics of a route of CanaryRouter
+type RouteStats struct {
+	Transactions uint64
+	Errors       uint64
+	Duration     time.Duration
+}
+
+type routeCounters struct {
+	transactions uint64
+	errors       uint64
+	duration     int64
+}
+
+func (c *routeCounters) stats() RouteStats {
+	return RouteStats{
+		Transactions: atomic.LoadUint64(&c.transactions),
+		Errors:       atomic.LoadUint64(&c.errors),
+		Duration:     time.Duration(atomic.LoadInt64(&c.duration)),
+	}
+}
+
+// CanaryRouter is a TransactionManager sending a percentage of the transactions to a canary datasource during a
+// migration, by consistent hash of the routing key of their ctx. Transactions without routing key go to the
+// primary, calls inside an ambient transaction go to the datasource of that transaction.
+type CanaryRouter struct {
+	primary         TransactionManager
+	canary          TransactionManager
+	percent         int32
+	primaryCounters routeCounters
+	canaryCounters  routeCounters
+}
+
+var _ TransactionManager = (*CanaryRouter)(nil)
+
+// NewCanaryRouter return a CanaryRouter sending percent (0~100) of the transactions to canary
+func NewCanaryRouter(primary, canary TransactionManager, percent int) *CanaryRouter {
+	r := &CanaryRouter{primary: primary, canary: canary}
+	r.SetPercent(percent)
+	return r
+}
+
+// SetPercent changes the percentage of the transactions sent to the canary at runtime
+func (r *CanaryRouter) SetPercent(percent int) {
+	if percent < 0 || percent > 100 {
+		panic(fmt.Sprintf("canary percent %d out of 0~100", percent))
+	}
+	atomic.StoreInt32(&r.percent, int32(percent))
+}
+
+// Percent return the percentage of the transactions sent to the canary
+func (r *CanaryRouter) Percent() int {
+	return int(atomic.LoadInt32(&r.percent))
+}
+
+// PrimaryStats return the metrics of the transactions routed to the primary
+func (r *CanaryRouter) PrimaryStats() RouteStats {
+	return r.primaryCounters.stats()
+}
+
+// CanaryStats return the metrics of the transactions routed to the canary
+func (r *CanaryRouter) CanaryStats() RouteStats {
+	return r.canaryCounters.stats()
+}
+
+func (r *CanaryRouter) Transaction(ctx context.Context, bizFn func(ctx context.Context, tx *gorm.DB) error, opts ...TxOption) error {
+	tm, counters := r.route(ctx)
+	clock := clockOf(tm)
+	startAt := clock.Now()
+	err := tm.Transaction(ctx, bizFn, opts...)
+	atomic.AddUint64(&counters.transactions, 1)
+	atomic.AddInt64(&counters.duration, int64(clock.Now().Sub(startAt)))
+	if err != nil {
+		atomic.AddUint64(&counters.errors, 1)
+	}
+	return err
+}
+
+// Begin routes like Transaction, the Txn isn't counted in the RouteStats
+func (r *CanaryRouter) Begin(ctx context.Context, opts ...TxOption) (*Txn, error) {
+	tm, _ := r.route(ctx)
+	return tm.Begin(ctx, opts...)
+}
+
+// Idempotent routes like Transaction, the call isn't counted in the RouteStats
+func (r *CanaryRouter) Idempotent(ctx context.Context, key string, fn func(ctx context.Context, tx *gorm.DB) ([]byte, error), opts ...TxOption) ([]byte, error) {
+	tm, _ := r.route(ctx)
+	return tm.Idempotent(ctx, key, fn, opts...)
+}
+
+func (r *CanaryRouter) GetDB(ctx context.Context) *gorm.DB {
+	tm, _ := r.route(ctx)
+	return tm.GetDB(ctx)
+}
+
+// GetOriginDB return the original gorm.DB of the primary
+func (r *CanaryRouter) GetOriginDB() *gorm.DB {
+	return r.primary.GetOriginDB()
+}
+
+func (r *CanaryRouter) GetNonTxDB(ctx context.Context) *gorm.DB {
+	tm, _ := r.route(ctx)
+	return tm.GetNonTxDB(ctx)
+}
+
+func (r *CanaryRouter) route(ctx context.Context) (TransactionManager, *routeCounters) {
+	if ctx.Value(transactionKeyOf(r.canary.GetOriginDB())) != nil {
+		return r.canary, &r.canaryCounters
+	}
+	if ctx.Value(transactionKeyOf(r.primary.GetOriginDB())) != nil {
+		return r.primary, &r.primaryCounters
+	}
+	key, ok := ctx.Value(routingKey{}).(string)
+	if !ok {
+		return r.primary, &r.primaryCounters
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	if int32(h.Sum32()%100) < atomic.LoadInt32(&r.percent) {
+		return r.canary, &r.canaryCounters
+	}
+	return r.primary, &r.primaryCounters
+}
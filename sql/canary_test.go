@@ -0,0 +1,62 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"propagation-tx/internal/recordingdriver"
+	"testing"
+	"time"
+)
+
+func TestCanaryRouter(t *testing.T) {
+	clock := newFakeClock()
+	primaryDriver, canaryDriver := &recordingdriver.Driver{}, &recordingdriver.Driver{}
+	primary := newRecordingManager(t, primaryDriver, WithClock(clock))
+	canary := newRecordingManager(t, canaryDriver, WithClock(clock))
+	router := NewCanaryRouter(primary, canary, 0)
+	write := func(ctx context.Context, tx *gorm.DB) error {
+		clock.Advance(time.Second)
+		return tx.Exec("UPDATE stock SET n = 0 WHERE id = 1").Error
+	}
+
+	assert.NoError(t, router.Transaction(WithRoutingKey(context.Background(), "user-1"), write))
+	router.SetPercent(100)
+	assert.NoError(t, router.Transaction(WithRoutingKey(context.Background(), "user-1"), write))
+	assert.Error(t, router.Transaction(WithRoutingKey(context.Background(), "user-1"), func(ctx context.Context, tx *gorm.DB) error {
+		return errors.New("failure")
+	}))
+	// without routing key the transactions go to the primary, and the calls inside one to its datasource
+	assert.NoError(t, router.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+		return router.Transaction(WithRoutingKey(ctx, "user-1"), write)
+	}))
+	// the duration of the outer call includes the one of the call inside
+	assert.Equal(t, RouteStats{Transactions: 3, Duration: 3 * time.Second}, router.PrimaryStats())
+	assert.Equal(t, RouteStats{Transactions: 2, Errors: 1, Duration: time.Second}, router.CanaryStats())
+	written := []string{"BEGIN", "UPDATE stock SET n = 0 WHERE id = 1", "COMMIT"}
+	assert.Equal(t, append(written, written...), primaryDriver.Statements())
+	assert.Equal(t, append(written, "BEGIN", "ROLLBACK"), canaryDriver.Statements())
+
+	// a percentage of the keys goes to the canary, always the same ones
+	router = NewCanaryRouter(primary, canary, 30)
+	routed := map[string]bool{}
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("user-%d", i)
+		tm, _ := router.route(WithRoutingKey(context.Background(), key))
+		routed[key] = tm == canary
+		tm, _ = router.route(WithRoutingKey(context.Background(), key))
+		assert.Equal(t, routed[key], tm == canary)
+	}
+	toCanary := 0
+	for _, c := range routed {
+		if c {
+			toCanary++
+		}
+	}
+	assert.InDelta(t, 300, toCanary, 50)
+	assert.Panics(t, func() {
+		router.SetPercent(101)
+	})
+}
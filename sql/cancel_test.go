@@ -0,0 +1,23 @@
+package sql
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"propagation-tx/internal/recordingdriver"
+	"testing"
+)
+
+func TestTransaction_CanceledContext(t *testing.T) {
+	d := &recordingdriver.Driver{}
+	manager := newRecordingManager(t, d)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err := manager.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+		tx.Exec("UPDATE users SET age = 1")
+		cancel()
+		return nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.NotContains(t, d.Statements(), "COMMIT")
+}
@@ -0,0 +1,67 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+)
+
+// ChainedTransactionManager runs a bizFn in transactions of several TransactionManagers (e.g. two MySQL instances)
+// with best-effort 1PC: the transactions begin in the order of the managers and commit in reverse order once bizFn
+// succeeded, so a failure before the last commits rolls everything back. Only a commit failing after the commits
+// of the managers after it leaves the datasources inconsistent, it's reported as a *PartialCommitError.
+//
+// The managers must keep the default CrossDatasourceRequiresNew policy, the calls inside bizFn use each manager as
+// usual and join the transaction of its datasource.
+type ChainedTransactionManager struct {
+	managers []TransactionManager
+}
+
+func NewChainedTransactionManager(managers ...TransactionManager) *ChainedTransactionManager {
+	return &ChainedTransactionManager{managers: managers}
+}
+
+// Transaction runs bizFn with the tx of every manager, in the order of the managers. opts apply to the call of
+// every manager.
+func (c *ChainedTransactionManager) Transaction(ctx context.Context, bizFn func(ctx context.Context, txs []*gorm.DB) error, opts ...TxOption) error {
+	txs := make([]*gorm.DB, len(c.managers))
+	// completed are the managers whose call returned without error, the innermost first
+	var completed []int
+	var chain func(ctx context.Context, i int) error
+	chain = func(ctx context.Context, i int) error {
+		if i == len(c.managers) {
+			return bizFn(ctx, txs)
+		}
+		err := c.managers[i].Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+			txs[i] = tx
+			return chain(ctx, i+1)
+		}, opts...)
+		if err == nil {
+			completed = append(completed, i)
+		}
+		return err
+	}
+	err := chain(ctx, 0)
+	var commitErr *CommitError
+	if len(completed) > 0 && errors.As(err, &commitErr) {
+		return &PartialCommitError{Committed: completed, Cause: err}
+	}
+	return err
+}
+
+// PartialCommitError is returned by ChainedTransactionManager when a commit failed after the transactions of other
+// managers committed, which must be reconciled
+type PartialCommitError struct {
+	// Committed are the indexes of the managers whose transaction committed
+	Committed []int
+	Cause     error
+}
+
+func (e *PartialCommitError) Error() string {
+	return fmt.Sprintf("partial commit of managers %v: %v", e.Committed, e.Cause)
+}
+
+func (e *PartialCommitError) Unwrap() error {
+	return e.Cause
+}
@@ -0,0 +1,103 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"propagation-tx/internal/recordingdriver"
+	"testing"
+)
+
+func TestChainedTransactionManager(t *testing.T) {
+	newChained := func() (*ChainedTransactionManager, *recordingdriver.Driver, *recordingdriver.Driver) {
+		d1, d2 := &recordingdriver.Driver{}, &recordingdriver.Driver{}
+		return NewChainedTransactionManager(newRecordingManager(t, d1), newRecordingManager(t, d2)), d1, d2
+	}
+	write := func(ctx context.Context, txs []*gorm.DB) error {
+		for _, tx := range txs {
+			tx.Exec("UPDATE users SET age = 1")
+		}
+		return nil
+	}
+	committed := []string{"BEGIN", "UPDATE users SET age = 1", "COMMIT"}
+	rolledBack := []string{"BEGIN", "UPDATE users SET age = 1", "ROLLBACK"}
+
+	t.Run("commit", func(t *testing.T) {
+		chained, d1, d2 := newChained()
+		assert.NoError(t, chained.Transaction(context.Background(), write))
+		assert.Equal(t, committed, d1.Statements())
+		assert.Equal(t, committed, d2.Statements())
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		chained, d1, d2 := newChained()
+		err := chained.Transaction(context.Background(), func(ctx context.Context, txs []*gorm.DB) error {
+			_ = write(ctx, txs)
+			return mockErr
+		})
+		assert.ErrorIs(t, err, mockErr)
+		assert.Equal(t, rolledBack, d1.Statements())
+		assert.Equal(t, rolledBack, d2.Statements())
+	})
+
+	// the last manager commits first, its failure rolls back the others
+	t.Run("last commit failed", func(t *testing.T) {
+		chained, d1, d2 := newChained()
+		d2.CommitErr = mockErr
+		err := chained.Transaction(context.Background(), write)
+		var commitErr *CommitError
+		assert.ErrorAs(t, err, &commitErr)
+		var partialErr *PartialCommitError
+		assert.False(t, errors.As(err, &partialErr))
+		assert.Equal(t, rolledBack, d1.Statements())
+		assert.Equal(t, committed, d2.Statements())
+	})
+
+	t.Run("partial commit", func(t *testing.T) {
+		chained, d1, d2 := newChained()
+		d1.CommitErr = mockErr
+		err := chained.Transaction(context.Background(), write)
+		var partialErr *PartialCommitError
+		assert.ErrorAs(t, err, &partialErr)
+		assert.Equal(t, []int{1}, partialErr.Committed)
+		assert.ErrorIs(t, err, mockErr)
+		assert.Equal(t, committed, d1.Statements())
+		assert.Equal(t, committed, d2.Statements())
+	})
+
+	t.Run("propagations", func(t *testing.T) {
+		chained, d1, d2 := newChained()
+		ctx := context.Background()
+		assert.ErrorIs(t, chained.Transaction(ctx, write, PropagationMandatory), ErrMandatoryPropWithoutTransaction)
+		assert.NoError(t, chained.Transaction(ctx, write, PropagationNever))
+		assert.NoError(t, chained.Transaction(ctx, write, PropagationNotSupported))
+		assert.Equal(t, []string{"UPDATE users SET age = 1", "UPDATE users SET age = 1"}, d1.Statements())
+		assert.Equal(t, []string{"UPDATE users SET age = 1", "UPDATE users SET age = 1"}, d2.Statements())
+
+		// the calls join the transactions of their datasource
+		chained, d1, d2 = newChained()
+		err := chained.managers[0].Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+			assert.NoError(t, chained.Transaction(ctx, write, PropagationRequired))
+			assert.ErrorIs(t, chained.Transaction(ctx, write, PropagationNever), ErrNeverPropInTransaction)
+			return chained.Transaction(ctx, func(ctx context.Context, txs []*gorm.DB) error {
+				_ = write(ctx, txs)
+				return mockErr
+			}, PropagationNested)
+		})
+		assert.ErrorIs(t, err, mockErr)
+		assert.Equal(t, []string{"BEGIN", "UPDATE users SET age = 1", "SAVEPOINT sp1", "UPDATE users SET age = 1",
+			"ROLLBACK TO SAVEPOINT sp1", "ROLLBACK"}, d1.Statements())
+		assert.Equal(t, []string{"BEGIN", "UPDATE users SET age = 1", "COMMIT", "BEGIN", "UPDATE users SET age = 1",
+			"ROLLBACK"}, d2.Statements())
+
+		// RequiresNew suspends them
+		chained, d1, d2 = newChained()
+		err = chained.managers[0].Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+			return chained.Transaction(ctx, write, PropagationRequiresNew)
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"BEGIN", "BEGIN", "UPDATE users SET age = 1", "COMMIT", "COMMIT"}, d1.Statements())
+		assert.Equal(t, committed, d2.Statements())
+	})
+}
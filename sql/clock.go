@@ -0,0 +1,82 @@
+package sql
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// Clock is the time source of a manager (timings, timeouts, polling), tests replace it with a fake one to be
+// deterministic
+type Clock interface {
+	Now() time.Time
+	// After return a channel receiving the time once d elapsed
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// clockOf return the Clock of tm, the system clock for other TransactionManager implementations
+func clockOf(tm TransactionManager) Clock {
+	if m, ok := tm.(*transactionManager); ok {
+		return m.clock
+	}
+	return systemClock{}
+}
+
+// IDGenerator generates the IDs of the root transactions of a manager
+type IDGenerator interface {
+	NewID() string
+}
+
+// IDGeneratorFunc is a func implementing IDGenerator
+type IDGeneratorFunc func() string
+
+func (f IDGeneratorFunc) NewID() string {
+	return f()
+}
+
+// randomIDs generates random 128 bits IDs
+type randomIDs struct{}
+
+func (randomIDs) NewID() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// WithClock replaces the time source of the manager
+func WithClock(clock Clock) ManagerOption {
+	return func(m *transactionManager) {
+		m.clock = clock
+	}
+}
+
+// WithIDGenerator replaces the generator of the IDs of the root transactions, random by default
+func WithIDGenerator(generator IDGenerator) ManagerOption {
+	return func(m *transactionManager) {
+		m.idGenerator = generator
+	}
+}
+
+// TxID return the ID of the root transaction of ctx, empty if ctx is not in transaction
+func TxID(ctx context.Context) string {
+	txCtx, ok := currentTransaction(ctx)
+	if !ok {
+		return ""
+	}
+	return txCtx.root().id
+}
+
+func (m *transactionManager) since(t time.Time) time.Duration {
+	return m.clock.Now().Sub(t)
+}
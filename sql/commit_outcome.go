@@ -0,0 +1,57 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"log"
+)
+
+var ErrCommitOutcomeUnknown = errors.New("commit outcome unknown")
+
+// CommitOutcomeUnknownError is returned when the connection broke during the commit: the transaction may or may
+// not have committed. errors.Is(err, ErrCommitOutcomeUnknown) tells it apart.
+type CommitOutcomeUnknownError struct {
+	Err error
+}
+
+func (e *CommitOutcomeUnknownError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrCommitOutcomeUnknown, e.Err)
+}
+
+func (e *CommitOutcomeUnknownError) Unwrap() []error {
+	return []error{ErrCommitOutcomeUnknown, e.Err}
+}
+
+// CommitVerifier resolves the outcome of a commit which failed on a broken connection, e.g. by looking for a row
+// written by the transaction (keyed by TransactionInfo.ID) or for its GTID. db is a new connection.
+type CommitVerifier func(ctx context.Context, db *gorm.DB, info TransactionInfo) (committed bool, err error)
+
+// WithCommitVerifier runs verifier when a commit outcome is unknown, the transaction then succeeds or fails
+// according to its answer. CommitOutcomeUnknownError is still returned if the verifier fails.
+func WithCommitVerifier(verifier CommitVerifier) ManagerOption {
+	return func(m *transactionManager) {
+		m.commitVerifier = verifier
+	}
+}
+
+// resolveCommitOutcome return the error of the commit of txCtx once its outcome is verified,
+// committed tells whether the transaction committed
+func (m *transactionManager) resolveCommitOutcome(ctx context.Context, txCtx *transactionContext, info TransactionInfo, err error) (committed bool, _ error) {
+	var unknown *CommitOutcomeUnknownError
+	if m.commitVerifier == nil || !errors.As(err, &unknown) {
+		return false, err
+	}
+	db := m.GetOriginDB().WithContext(m.withoutTransaction(ctx))
+	committed, verifyErr := m.commitVerifier(ctx, db, info)
+	if verifyErr != nil {
+		log.Printf("[TX] verify commit outcome of %s error: %v", info, verifyErr)
+		return false, err
+	}
+	if !committed {
+		return false, unknown.Err
+	}
+	log.Printf("[TX] commit of %s verified after error: %v", info, unknown.Err)
+	return true, txCtx.completeCommit()
+}
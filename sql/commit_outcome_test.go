@@ -0,0 +1,53 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"io"
+	"propagation-tx/internal/recordingdriver"
+	"testing"
+)
+
+func TestWithCommitVerifier(t *testing.T) {
+	noop := func(ctx context.Context, tx *gorm.DB) error {
+		return nil
+	}
+	err := newRecordingManager(t, &recordingdriver.Driver{CommitErr: io.ErrUnexpectedEOF}).Transaction(context.Background(), noop)
+	assert.ErrorIs(t, err, ErrCommitOutcomeUnknown)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	verifyErr := errors.New("verification failed")
+	for _, outcome := range []struct {
+		committed bool
+		err       error
+	}{{true, nil}, {false, nil}, {false, verifyErr}} {
+		var verified []string
+		manager := newRecordingManager(t, &recordingdriver.Driver{CommitErr: io.ErrUnexpectedEOF},
+			WithCommitVerifier(func(ctx context.Context, db *gorm.DB, info TransactionInfo) (bool, error) {
+				verified = append(verified, info.ID)
+				return outcome.committed, outcome.err
+			}))
+		afterCommit := false
+		var id string
+		err := manager.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+			id = TxID(ctx)
+			AfterCommit(ctx, func(ctx context.Context) {
+				afterCommit = true
+			})
+			return nil
+		})
+		assert.Equal(t, []string{id}, verified)
+		assert.Equal(t, outcome.committed, afterCommit)
+		switch {
+		case outcome.committed:
+			assert.NoError(t, err)
+		case outcome.err != nil:
+			assert.ErrorIs(t, err, ErrCommitOutcomeUnknown)
+		default:
+			assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+			assert.NotErrorIs(t, err, ErrCommitOutcomeUnknown)
+		}
+	}
+}
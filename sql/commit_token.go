@@ -0,0 +1,89 @@
+package sql
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+// CommitToken identifies the point of the database history right after a root transaction committed, for causal
+// consistency, cache versioning or read fencing on replicas
+type CommitToken struct {
+	CommittedAt time.Time
+	// GTIDSet is the gtid_executed of the MySQL server right after the commit, it contains the transaction.
+	// Empty if GTID mode is off.
+	GTIDSet string
+	// LSN is the current WAL position of the Postgres server right after the commit
+	LSN string
+	// BinlogFile and BinlogPosition are the binlog coordinates of the MySQL server right after the commit,
+	// only filled with WithBinlogPosition
+	BinlogFile     string
+	BinlogPosition uint64
+	withBinlog     bool
+}
+
+// commitTokenQueries read the position of the server right after a commit, which includes the commit
+var commitTokenQueries = map[string]string{
+	"mysql":    "SELECT @@GLOBAL.gtid_executed",
+	"postgres": "SELECT pg_current_wal_lsn()::text",
+}
+
+// WithCommitToken fills token once the root transaction the call runs in committed, it stays zero if the call
+// doesn't run in a transaction or the transaction rolls back. When the call joins an outer transaction the token
+// is filled by the commit of the outer transaction, i.e. after the call returned.
+func WithCommitToken(token *CommitToken) TxOption {
+	return txOptionFunc(func(o *txOptions) {
+		o.commitToken = token
+	})
+}
+
+// WithBinlogPosition is WithCommitToken also capturing the binlog coordinates of MySQL (SHOW MASTER STATUS), so CDC
+// consumers can fence on the changes up to the transaction. It requires the REPLICATION CLIENT privilege.
+func WithBinlogPosition(token *CommitToken) TxOption {
+	token.withBinlog = true
+	return WithCommitToken(token)
+}
+
+// binlogStatusQueries read the binlog coordinates, SHOW BINARY LOG STATUS replaces SHOW MASTER STATUS since MySQL 8.4
+var binlogStatusQueries = []string{"SHOW MASTER STATUS", "SHOW BINARY LOG STATUS"}
+
+// registerCommitToken fills token after the commit of the root transaction of txCtx
+func (m *transactionManager) registerCommitToken(txCtx *transactionContext, token *CommitToken) {
+	AfterCommit(txCtx, func(ctx context.Context) {
+		token.CommittedAt = m.clock.Now()
+		db := m.GetOriginDB().WithContext(m.withoutTransaction(ctx))
+		query, ok := commitTokenQueries[db.Dialector.Name()]
+		if !ok {
+			return
+		}
+		var position string
+		if err := db.Raw(query).Scan(&position).Error; err != nil {
+			log.Println("[TX] read commit position error: ", err)
+			return
+		}
+		if db.Dialector.Name() == "postgres" {
+			token.LSN = position
+			return
+		}
+		token.GTIDSet = position
+		if token.withBinlog {
+			readBinlogPosition(db, token)
+		}
+	})
+}
+
+func readBinlogPosition(db *gorm.DB, token *CommitToken) {
+	var status struct {
+		File     string `gorm:"column:File"`
+		Position uint64 `gorm:"column:Position"`
+	}
+	var err error
+	for _, query := range binlogStatusQueries {
+		if err = db.Raw(query).Scan(&status).Error; err == nil {
+			token.BinlogFile, token.BinlogPosition = status.File, status.Position
+			return
+		}
+	}
+	log.Println("[TX] read binlog position error: ", err)
+}
@@ -0,0 +1,28 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"propagation-tx/internal/recordingdriver"
+	"testing"
+)
+
+func TestWithCommitToken_Nested(t *testing.T) {
+	clock := newFakeClock()
+	manager := newRecordingManager(t, &recordingdriver.Driver{}, WithClock(clock))
+	var kept, discarded CommitToken
+	err := manager.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+		assert.NoError(t, manager.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+			return nil
+		}, PropagationNested, WithCommitToken(&kept)))
+		assert.Error(t, manager.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+			return errors.New("rolled back to its savepoint")
+		}, PropagationNested, WithCommitToken(&discarded)))
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, clock.Now(), kept.CommittedAt)
+	assert.Zero(t, discarded)
+}
@@ -0,0 +1,29 @@
+package sql
+
+import (
+	"context"
+	"gorm.io/gorm"
+)
+
+// CommitValidator checks an invariant of the data written by a root transaction right before it commits, e.g.
+// that no balance went negative. An error rolls the transaction back, the call then fails with a *CommitError
+// whose Cause is the error.
+type CommitValidator func(ctx context.Context, tx *gorm.DB) error
+
+// WithCommitValidators runs validators in order before every root transaction of the manager commits, after the
+// BeforeCommit hooks so they see the final state of the transaction
+func WithCommitValidators(validators ...CommitValidator) ManagerOption {
+	return func(m *transactionManager) {
+		m.commitValidators = append(m.commitValidators, validators...)
+	}
+}
+
+// validateCommit runs the commit validators of the root transaction c, the first error stops them
+func (c *transactionContext) validateCommit() error {
+	for _, validate := range c.validators {
+		if err := validate(c, c.tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package sql
+
+import (
+	"bytes"
+	"errors"
+	"gorm.io/gorm"
+	"log"
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+const concurrentUseCallbackName = "propagation-tx:concurrent_use"
+
+// ErrConcurrentTxUse fails a statement run on a transaction while a statement of another goroutine is running on
+// it, see WithConcurrentUseCheck
+var ErrConcurrentTxUse = errors.New("transaction used concurrently by several goroutines")
+
+// WithConcurrentUseCheck fails with ErrConcurrentTxUse the statements of a root transaction overlapping with a
+// statement of another goroutine, e.g. a tx handed to goroutines without a TxGroup. It costs a stack trace per
+// statement, it's meant for tests and staging.
+func WithConcurrentUseCheck() ManagerOption {
+	return func(m *transactionManager) {
+		m.concurrentUseCheck = true
+		registerConcurrentUseCallbacks(m.GetOriginDB())
+	}
+}
+
+// concurrentUseGuard tracks the goroutine running a statement on a root transaction
+type concurrentUseGuard struct {
+	mu sync.Mutex
+	// goroutine runs the statements in flight, nested ones included (e.g. the associations of a Create)
+	goroutine uint64
+	inFlight  int
+}
+
+// enter tells whether the current goroutine may run a statement
+func (g *concurrentUseGuard) enter() bool {
+	id := goroutineID()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.inFlight > 0 && g.goroutine != id {
+		return false
+	}
+	g.goroutine = id
+	g.inFlight++
+	return true
+}
+
+func (g *concurrentUseGuard) exit() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.inFlight > 0 {
+		g.inFlight--
+	}
+}
+
+// goroutineID return the id of the current goroutine, read from its stack trace
+func goroutineID() uint64 {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	buf = bytes.TrimPrefix(buf, []byte("goroutine "))
+	id, _ := strconv.ParseUint(string(buf[:bytes.IndexByte(buf, ' ')]), 10, 64)
+	return id
+}
+
+// concurrentUseKey is the key of the gorm setting marking a statement entered in the concurrentUseGuard
+const concurrentUseKey = "propagation-tx:concurrent_use_entered"
+
+func registerConcurrentUseCallbacks(db *gorm.DB) {
+	callbacks := db.Callback()
+	if callbacks.Raw().Get(concurrentUseCallbackName) != nil {
+		return
+	}
+	enter := func(db *gorm.DB) {
+		root := transactionRootOf(db)
+		if root == nil || root.concurrentUse == nil {
+			return
+		}
+		if !root.concurrentUse.enter() {
+			// the mark may be inherited from the statement the one of db was cloned from
+			db.Statement.Settings.Delete(concurrentUseKey)
+			_ = db.AddError(ErrConcurrentTxUse)
+			return
+		}
+		db.Statement.Settings.Store(concurrentUseKey, true)
+	}
+	exit := func(db *gorm.DB) {
+		if _, entered := db.Statement.Settings.LoadAndDelete(concurrentUseKey); entered {
+			transactionRootOf(db).concurrentUse.exit()
+		}
+	}
+	for _, err := range []error{
+		callbacks.Create().Before("*").Register(concurrentUseCallbackName, enter),
+		callbacks.Query().Before("*").Register(concurrentUseCallbackName, enter),
+		callbacks.Update().Before("*").Register(concurrentUseCallbackName, enter),
+		callbacks.Delete().Before("*").Register(concurrentUseCallbackName, enter),
+		callbacks.Row().Before("*").Register(concurrentUseCallbackName, enter),
+		callbacks.Raw().Before("*").Register(concurrentUseCallbackName, enter),
+		callbacks.Create().After("*").Register(concurrentUseCallbackName+"_after", exit),
+		callbacks.Query().After("*").Register(concurrentUseCallbackName+"_after", exit),
+		callbacks.Update().After("*").Register(concurrentUseCallbackName+"_after", exit),
+		callbacks.Delete().After("*").Register(concurrentUseCallbackName+"_after", exit),
+		callbacks.Row().After("*").Register(concurrentUseCallbackName+"_after", exit),
+		callbacks.Raw().After("*").Register(concurrentUseCallbackName+"_after", exit),
+	} {
+		if err != nil {
+			log.Println("[TX] register concurrent use callback error: ", err)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package sql
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"propagation-tx/internal/recordingdriver"
+	"testing"
+)
+
+func TestWithConcurrentUseCheck(t *testing.T) {
+	d := &recordingdriver.Driver{}
+	db := newRecordingDB(t, d)
+	manager := NewTransactionManager(sessionFactory{db: db}, WithConcurrentUseCheck())
+	// holds the statement "UPDATE slow" in flight until released
+	entered, release := make(chan struct{}), make(chan struct{})
+	assert.NoError(t, db.Callback().Raw().Before("gorm:raw").Register("test:hold", func(db *gorm.DB) {
+		if db.Statement.SQL.String() == "UPDATE slow" {
+			close(entered)
+			<-release
+		}
+	}))
+
+	err := manager.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+		slow := make(chan error)
+		go func() {
+			slow <- tx.Exec("UPDATE slow").Error
+		}()
+		<-entered
+		assert.ErrorIs(t, tx.Exec("UPDATE fast").Error, ErrConcurrentTxUse)
+		close(release)
+		assert.NoError(t, <-slow)
+		// the tx is free again once the statement of the other goroutine completed
+		return tx.Exec("UPDATE after").Error
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"BEGIN", "UPDATE slow", "UPDATE after", "COMMIT"}, d.Statements())
+
+	// the tasks of a shared TxGroup use the tx one at a time
+	err = manager.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+		group := NewTxGroup(ctx, manager, TxGroupShared)
+		for i := 0; i < 8; i++ {
+			group.Go(func(ctx context.Context, tx *gorm.DB) error {
+				return tx.Exec("UPDATE shared").Error
+			})
+		}
+		return group.Wait()
+	})
+	assert.NoError(t, err)
+}
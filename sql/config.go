@@ -12,8 +12,14 @@ type ConnConfig struct {
 	MaxIdleConns       int    `json:"maxIdleConns"`
 	MaxOpenConns       int    `json:"maxOpenConns"`
 	ConnMaxLifetimeSec int    `json:"connMaxLifetimeSec"`
-	DbLog              bool   `json:"dbLog"`
-	Dialect            string `json:"dialect"`
+	// PoolAcquireTimeoutSec bounds the wait for a free connection when beginning a transaction, unbounded if 0
+	PoolAcquireTimeoutSec int    `json:"poolAcquireTimeoutSec"`
+	DbLog                 bool   `json:"dbLog"`
+	Dialect               string `json:"dialect"`
+	// default settings of the transactions of the managers built on this datasource
+	TxIsolation           string `json:"txIsolation"` // READ UNCOMMITTED, READ COMMITTED, REPEATABLE READ or SERIALIZABLE, server default if empty
+	TxReadOnly            bool   `json:"txReadOnly"`  // e.g. for replica groups
+	TxStatementTimeoutSec int    `json:"txStatementTimeoutSec"`
 }
 
 var DefaultConfig = ConnConfig{
@@ -42,6 +42,10 @@ func (c *configDBCreator) CacheSource() string {
 	return "config_db"
 }
 
+func (c *configDBCreator) ConnConfig() *ConnConfig {
+	return c.config
+}
+
 // simpleDBCreator create db by simple params
 type simpleDBCreator struct {
 	host     string
@@ -89,6 +93,11 @@ func GetConfigDB(connConfig *ConnConfig, ctx context.Context) (*gorm.DB, error)
 	return factory.GetDB(ctx), nil
 }
 
+// ConnConfigProvider is implemented by DBCreator and DBFactory created from a ConnConfig
+type ConnConfigProvider interface {
+	ConnConfig() *ConnConfig
+}
+
 // DBFactory get a db object with ctx
 type DBFactory interface {
 	// GetDB return gorm.DB with ctx
@@ -112,6 +121,14 @@ func (g GlobalCachedDBFactory) GetOriginDB() *gorm.DB {
 	return g.db
 }
 
+// ConnConfig return the ConnConfig of the creator, nil if it isn't created from a ConnConfig
+func (g GlobalCachedDBFactory) ConnConfig() *ConnConfig {
+	if provider, ok := g.creator.(ConnConfigProvider); ok {
+		return provider.ConnConfig()
+	}
+	return nil
+}
+
 // NewCachedDBFactory return a new DBFactory by a given CacheableDBCreator
 func NewCachedDBFactory(creator CacheableDBCreator) (DBFactory, error) {
 	source := creator.CacheSource()
@@ -140,6 +157,9 @@ func NewSimpleDBFactory(host string, port int, database string, user string, pas
 }
 
 func NewConfigDBFactory(connConfig *ConnConfig) (DBFactory, error) {
+	if _, err := txDefaultsOf(connConfig); err != nil {
+		return nil, err
+	}
 	return NewCachedDBFactory(&configDBCreator{config: connConfig})
 }
 
@@ -0,0 +1,89 @@
+package sql
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+var ErrInvalidCursor = errors.New("invalid pagination cursor")
+
+// PageCursor is a pagination cursor handed to clients, tied to the snapshot of the database it was read at
+type PageCursor struct {
+	// Position is the application defined position of the next page, e.g. the last id of the page
+	Position string `json:"p"`
+	// Snapshot is the GTID set (MySQL) or LSN (Postgres) the page was read at, replicas serving the next page
+	// must have applied it
+	Snapshot string `json:"s,omitempty"`
+}
+
+// CursorSigner signs PageCursor with HMAC-SHA256, so clients can't forge positions or snapshots
+type CursorSigner struct {
+	key []byte
+}
+
+// NewCursorSigner return a CursorSigner with the secret key
+func NewCursorSigner(key []byte) *CursorSigner {
+	if len(key) == 0 {
+		panic("empty cursor signing key")
+	}
+	return &CursorSigner{key: key}
+}
+
+// Sign return the opaque token of cursor
+func (s *CursorSigner) Sign(cursor PageCursor) (string, error) {
+	payload, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	encoding := base64.RawURLEncoding
+	return encoding.EncodeToString(payload) + "." + encoding.EncodeToString(s.mac(payload)), nil
+}
+
+// Verify return the cursor of a token made by Sign, ErrInvalidCursor if it's malformed or tampered with
+func (s *CursorSigner) Verify(token string) (PageCursor, error) {
+	var cursor PageCursor
+	encodedPayload, encodedMAC, ok := strings.Cut(token, ".")
+	if !ok {
+		return cursor, ErrInvalidCursor
+	}
+	encoding := base64.RawURLEncoding
+	payload, err := encoding.DecodeString(encodedPayload)
+	if err != nil {
+		return cursor, ErrInvalidCursor
+	}
+	mac, err := encoding.DecodeString(encodedMAC)
+	if err != nil || !hmac.Equal(mac, s.mac(payload)) {
+		return cursor, ErrInvalidCursor
+	}
+	if err = json.Unmarshal(payload, &cursor); err != nil {
+		return cursor, ErrInvalidCursor
+	}
+	return cursor, nil
+}
+
+func (s *CursorSigner) mac(payload []byte) []byte {
+	h := hmac.New(sha256.New, s.key)
+	h.Write(payload)
+	return h.Sum(nil)
+}
+
+// ReadSnapshot return the GTID set (MySQL) or LSN (Postgres) of the server within the transaction of ctx,
+// to be embedded in the PageCursor of the pages read by the transaction
+func ReadSnapshot(ctx context.Context) (string, error) {
+	txCtx, ok := currentTransaction(ctx)
+	if !ok {
+		return "", ErrNoTransaction
+	}
+	query, ok := commitTokenQueries[txCtx.tx.Dialector.Name()]
+	if !ok {
+		return "", nil
+	}
+	var snapshot string
+	err := txCtx.tx.Raw(query).Scan(&snapshot).Error
+	return snapshot, err
+}
@@ -0,0 +1,22 @@
+package sql
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCursorSigner(t *testing.T) {
+	signer := NewCursorSigner([]byte("secret"))
+	cursor := PageCursor{Position: "42", Snapshot: "3E11FA47-71CA-11E1-9E33-C80AA9429562:1-5"}
+
+	token, err := signer.Sign(cursor)
+	assert.NoError(t, err)
+	verified, err := signer.Verify(token)
+	assert.NoError(t, err)
+	assert.Equal(t, cursor, verified)
+
+	_, err = NewCursorSigner([]byte("other")).Verify(token)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+	_, err = signer.Verify("x" + token)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
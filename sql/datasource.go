@@ -0,0 +1,38 @@
+package sql
+
+import (
+	"errors"
+	"log"
+)
+
+// CrossDatasourcePolicy decides what a manager does when Transaction is called inside a transaction
+// started on another datasource, which the manager can neither join nor suspend
+type CrossDatasourcePolicy int8
+
+const (
+	CrossDatasourceRequiresNew CrossDatasourcePolicy = iota // 在当前数据源上新建事务，与外层事务互不影响
+	CrossDatasourceError                                    // 直接返回错误
+)
+
+var ErrCrossDatasourceTransaction = errors.New("in transaction of another datasource, can't join it")
+
+// WithCrossDatasourcePolicy set the CrossDatasourcePolicy of the manager, default is CrossDatasourceRequiresNew
+func WithCrossDatasourcePolicy(policy CrossDatasourcePolicy) ManagerOption {
+	return func(m *transactionManager) {
+		m.crossDatasourcePolicy = policy
+	}
+}
+
+// crossDatasourcePropagation return the effective propagation when called inside a transaction of another datasource.
+// Propagations that would join the ambient transaction are handled by the policy, the others are kept.
+func (m *transactionManager) crossDatasourcePropagation(propagation TransactionPropagation) (TransactionPropagation, error) {
+	if !propagation.joins() {
+		return propagation, nil
+	}
+	if m.crossDatasourcePolicy == CrossDatasourceError {
+		log.Printf("[TX] %s called in transaction of another datasource, rejected", propagation)
+		return propagation, ErrCrossDatasourceTransaction
+	}
+	log.Printf("[TX] %s called in transaction of another datasource, run as %s", propagation, PropagationRequiresNew)
+	return PropagationRequiresNew, nil
+}
@@ -0,0 +1,62 @@
+package sql
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"log"
+)
+
+const dryRunCallbackName = "propagation-tx:dry_run"
+
+// dryRunContext collects the statements built by ValidateWrites
+type dryRunContext struct {
+	context.Context
+	statements []string
+}
+
+// ValidateWrites runs fn with a DryRun session of the transaction of ctx and return the SQL fn would have executed,
+// so callers can assert invariants (e.g. every DELETE has a WHERE clause) before running fn for real. Nothing is
+// executed and the statements don't count in the TransactionStats, guardrails nor statement budgets.
+//
+// The gorm hooks of the models (BeforeCreate, AfterCreate...) are skipped, so an AfterCreate doesn't register a
+// DeferToCommit for a row never written. The statements built from fields set by hooks may differ from the real ones.
+func ValidateWrites(ctx context.Context, fn func(tx *gorm.DB) error) ([]string, error) {
+	txCtx, ok := currentTransaction(ctx)
+	if !ok {
+		return nil, ErrNoTransaction
+	}
+	dryRunCtx := &dryRunContext{Context: ctx}
+	if err := fn(txCtx.tx.Session(&gorm.Session{DryRun: true, SkipHooks: true, Context: dryRunCtx})); err != nil {
+		return dryRunCtx.statements, err
+	}
+	return dryRunCtx.statements, nil
+}
+
+// registerDryRunCallbacks collects the statements of the ValidateWrites of the datasource, registered with the manager
+func registerDryRunCallbacks(db *gorm.DB) {
+	callbacks := db.Callback()
+	if callbacks.Raw().Get(dryRunCallbackName) != nil {
+		return
+	}
+	for _, err := range []error{
+		callbacks.Create().After("*").Register(dryRunCallbackName, collectDryRun),
+		callbacks.Query().After("*").Register(dryRunCallbackName, collectDryRun),
+		callbacks.Update().After("*").Register(dryRunCallbackName, collectDryRun),
+		callbacks.Delete().After("*").Register(dryRunCallbackName, collectDryRun),
+		callbacks.Row().After("*").Register(dryRunCallbackName, collectDryRun),
+		callbacks.Raw().After("*").Register(dryRunCallbackName, collectDryRun),
+	} {
+		if err != nil {
+			log.Println("[TX] register dry run callback error: ", err)
+		}
+	}
+}
+
+func collectDryRun(db *gorm.DB) {
+	dryRunCtx, ok := db.Statement.Context.(*dryRunContext)
+	if !ok || !db.DryRun || db.Statement.SQL.Len() == 0 {
+		return
+	}
+	sql := db.Dialector.Explain(db.Statement.SQL.String(), db.Statement.Vars...)
+	dryRunCtx.statements = append(dryRunCtx.statements, sql)
+}
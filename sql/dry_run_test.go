@@ -0,0 +1,58 @@
+package sql
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"propagation-tx/internal/recordingdriver"
+	"testing"
+)
+
+// hookedOrder defers work to the commit of the transaction which created it
+type hookedOrder struct {
+	ID       int64
+	Sku      string
+	notified *int
+}
+
+func (o *hookedOrder) AfterCreate(tx *gorm.DB) error {
+	DeferToCommit(tx, func(ctx context.Context) {
+		*o.notified++
+	})
+	return nil
+}
+
+func TestValidateWrites(t *testing.T) {
+	d := &recordingdriver.Driver{}
+	manager := newRecordingManager(t, d)
+	notified := 0
+	err := manager.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+		statements, err := ValidateWrites(ctx, func(tx *gorm.DB) error {
+			if err := tx.Create(&hookedOrder{Sku: "a", notified: &notified}).Error; err != nil {
+				return err
+			}
+			return tx.Exec("DELETE FROM hooked_orders").Error
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"INSERT INTO `hooked_orders` (`sku`) VALUES ('a')", "DELETE FROM hooked_orders"}, statements)
+		stats, _ := TxStats(ctx)
+		assert.Equal(t, TransactionStats{}, stats)
+		// nor do they count as the statement of a single statement call
+		return manager.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+			if _, err := ValidateWrites(ctx, func(tx *gorm.DB) error {
+				return tx.Exec("UPDATE hooked_orders SET sku = 'b' WHERE id = 1").Error
+			}); err != nil {
+				return err
+			}
+			return tx.Exec("UPDATE hooked_orders SET sku = 'b' WHERE id = 1").Error
+		}, PropagationNested, WithSingleStatement())
+	}, WithStatementBudget(0, FullTableScan))
+	assert.NoError(t, err)
+	assert.Zero(t, notified)
+	assert.Equal(t, []string{"BEGIN", "UPDATE hooked_orders SET sku = 'b' WHERE id = 1", "COMMIT"}, d.Statements())
+
+	_, err = ValidateWrites(context.Background(), func(tx *gorm.DB) error {
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrNoTransaction)
+}
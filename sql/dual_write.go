@@ -0,0 +1,207 @@
+package sql
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+const dualWriteCallbackName = "propagation-tx:dual_write"
+
+// Divergence is a difference between the primary and the mirror datasource found in dual-write mode
+type Divergence struct {
+	Table string
+	// SQL is the mirrored statement, empty for a divergence found by CompareTables
+	SQL         string
+	PrimaryRows int64
+	MirrorRows  int64
+	// PrimaryChecksum and MirrorChecksum are only set by CompareTables
+	PrimaryChecksum int64
+	MirrorChecksum  int64
+	Error           string
+	At              time.Time
+}
+
+// DivergenceRecorder stores divergences for later reconciliation
+type DivergenceRecorder interface {
+	RecordDivergence(ctx context.Context, divergence Divergence)
+}
+
+// DivergenceRecorderFunc is a func implementing DivergenceRecorder
+type DivergenceRecorderFunc func(ctx context.Context, divergence Divergence)
+
+func (f DivergenceRecorderFunc) RecordDivergence(ctx context.Context, divergence Divergence) {
+	f(ctx, divergence)
+}
+
+type dualWrite struct {
+	mirror   DBFactory
+	tables   map[string]bool
+	recorder DivergenceRecorder
+}
+
+// dualWriteKey is the key of the mirroredWrites bound to a root transaction
+type dualWriteKey struct{}
+
+type mirroredWrites struct {
+	statements []mirroredStatement
+}
+
+type mirroredStatement struct {
+	table string
+	sql   string
+	vars  []interface{}
+	rows  int64
+}
+
+// WithDualWrite mirrors the create/update/delete statements on tables executed in the committed root transactions
+// of the manager into the mirror datasource, in a transaction of its own right after the commit. Statements failing
+// or affecting another number of rows on the mirror are recorded as divergences, the result of the primary
+// transaction is never affected.
+//
+// It's meant for migrations dual-writing to an old and a new schema, statements are replayed as is so tables
+// must have the same name and compatible columns on both sides.
+func WithDualWrite(mirror DBFactory, recorder DivergenceRecorder, tables ...string) ManagerOption {
+	return func(m *transactionManager) {
+		m.dualWrite = &dualWrite{
+			mirror:   mirror,
+			tables:   make(map[string]bool, len(tables)),
+			recorder: recorder,
+		}
+		for _, table := range tables {
+			m.dualWrite.tables[table] = true
+		}
+		registerDualWriteCallbacks(m.GetOriginDB())
+	}
+}
+
+// registerDualWriteCallbacks captures the writes of the datasource, only the ones of transactions in dual-write
+// mode are kept
+func registerDualWriteCallbacks(db *gorm.DB) {
+	callbacks := db.Callback()
+	if callbacks.Create().Get(dualWriteCallbackName) != nil {
+		return
+	}
+	_ = callbacks.Create().After("gorm:create").Register(dualWriteCallbackName, captureWrite)
+	_ = callbacks.Update().After("gorm:update").Register(dualWriteCallbackName, captureWrite)
+	_ = callbacks.Delete().After("gorm:delete").Register(dualWriteCallbackName, captureWrite)
+}
+
+func captureWrite(db *gorm.DB) {
+	txCtx, ok := currentTransaction(db.Statement.Context)
+	if !ok || db.Error != nil || db.DryRun || db.Statement.SQL.Len() == 0 {
+		return
+	}
+	writes, ok := txCtx.root().values[dualWriteKey{}].(*mirroredWrites)
+	if !ok {
+		return
+	}
+	statement := mirroredStatement{
+		table: db.Statement.Table,
+		sql:   db.Statement.SQL.String(),
+		vars:  append([]interface{}(nil), db.Statement.Vars...),
+		rows:  db.RowsAffected,
+	}
+	// kept on commit only, so writes of rolled back savepoints aren't mirrored
+	AfterCommit(txCtx, func(ctx context.Context) {
+		writes.statements = append(writes.statements, statement)
+	})
+}
+
+// startDualWrite enables the capture of the writes of a root transaction
+func startDualWrite(txCtx *transactionContext) {
+	txCtx.boundValue(dualWriteKey{}, func() interface{} {
+		return &mirroredWrites{}
+	})
+}
+
+// mirrorWrites replays the writes of the committed root transaction txCtx on the mirror datasource
+func (m *transactionManager) mirrorWrites(txCtx *transactionContext) {
+	writes, ok := txCtx.values[dualWriteKey{}].(*mirroredWrites)
+	if !ok {
+		return
+	}
+	var statements []mirroredStatement
+	for _, statement := range writes.statements {
+		if m.dualWrite.tables[statement.table] {
+			statements = append(statements, statement)
+		}
+	}
+	if len(statements) == 0 {
+		return
+	}
+
+	ctx := txCtx.Ctx()
+	err := m.dualWrite.mirror.GetDB(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, statement := range statements {
+			result := tx.Exec(statement.sql, statement.vars...)
+			if result.Error != nil {
+				m.recordDivergence(ctx, statement, result.RowsAffected, result.Error)
+				return result.Error
+			}
+			if result.RowsAffected != statement.rows {
+				m.recordDivergence(ctx, statement, result.RowsAffected, nil)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Println("[TX] dual write to mirror rolled back: ", err)
+	}
+}
+
+func (m *transactionManager) recordDivergence(ctx context.Context, statement mirroredStatement, mirrorRows int64, err error) {
+	divergence := Divergence{
+		Table:       statement.table,
+		SQL:         statement.sql,
+		PrimaryRows: statement.rows,
+		MirrorRows:  mirrorRows,
+		At:          m.clock.Now(),
+	}
+	if err != nil {
+		divergence.Error = err.Error()
+	}
+	m.dualWrite.recorder.RecordDivergence(ctx, divergence)
+}
+
+// CompareTables compares the row count and the checksum (MySQL CHECKSUM TABLE) of tables between the primary
+// and the mirror datasource of a dual-write migration, every difference is recorded as a divergence at the time of
+// the clock of primary
+func CompareTables(ctx context.Context, primary TransactionManager, mirror *gorm.DB, recorder DivergenceRecorder, tables ...string) error {
+	for _, table := range tables {
+		primaryRows, primaryChecksum, err := tableDigest(primary.GetNonTxDB(ctx), table)
+		if err != nil {
+			return err
+		}
+		mirrorRows, mirrorChecksum, err := tableDigest(mirror.WithContext(ctx), table)
+		if err != nil {
+			return err
+		}
+		if primaryRows != mirrorRows || primaryChecksum != mirrorChecksum {
+			recorder.RecordDivergence(ctx, Divergence{
+				Table:           table,
+				PrimaryRows:     primaryRows,
+				MirrorRows:      mirrorRows,
+				PrimaryChecksum: primaryChecksum,
+				MirrorChecksum:  mirrorChecksum,
+				At:              clockOf(primary).Now(),
+			})
+		}
+	}
+	return nil
+}
+
+func tableDigest(db *gorm.DB, table string) (rows int64, checksum int64, err error) {
+	if err = db.Table(table).Count(&rows).Error; err != nil {
+		return 0, 0, err
+	}
+	var result struct {
+		Table    string
+		Checksum int64
+	}
+	if err = db.Raw("CHECKSUM TABLE " + db.Statement.Quote(table)).Scan(&result).Error; err != nil {
+		return 0, 0, err
+	}
+	return rows, result.Checksum, nil
+}
@@ -0,0 +1,115 @@
+package sql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"propagation-tx/internal/recordingdriver"
+	"strings"
+	"testing"
+)
+
+type mirroredOrder struct {
+	ID   int64
+	Paid bool
+}
+
+func (o *mirroredOrder) TableName() string {
+	return "orders"
+}
+
+func TestWithDualWrite(t *testing.T) {
+	clock := newFakeClock()
+	mirrorErr := errors.New("unknown column paid")
+	mirror := &recordingdriver.Driver{Exec: func(query string) (int64, error) {
+		switch {
+		case strings.HasPrefix(query, "UPDATE"):
+			return 0, nil
+		case strings.HasPrefix(query, "DELETE"):
+			return 0, mirrorErr
+		}
+		return 1, nil
+	}}
+	var divergences []Divergence
+	d := &recordingdriver.Driver{}
+	manager := newRecordingManager(t, d, WithClock(clock), WithDualWrite(sessionFactory{db: newRecordingDB(t, mirror)},
+		DivergenceRecorderFunc(func(ctx context.Context, divergence Divergence) {
+			divergences = append(divergences, divergence)
+		}), "orders"))
+
+	err := manager.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+		order := &mirroredOrder{ID: 1}
+		if err := tx.Create(order).Error; err != nil {
+			return err
+		}
+		// the writes of other tables and of rolled back savepoints aren't mirrored
+		if err := tx.Table("audit").Create(map[string]interface{}{"id": 1}).Error; err != nil {
+			return err
+		}
+		_ = manager.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+			tx.Delete(&mirroredOrder{ID: 1})
+			return errors.New("rolled back to its savepoint")
+		}, PropagationNested)
+		return tx.Model(order).Update("paid", true).Error
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"BEGIN",
+		"INSERT INTO `orders` (`paid`,`id`) VALUES (?,?)",
+		"UPDATE `orders` SET `paid`=? WHERE `id` = ?",
+		"COMMIT",
+	}, mirror.Statements())
+	assert.Equal(t, []Divergence{{
+		Table:       "orders",
+		SQL:         "UPDATE `orders` SET `paid`=? WHERE `id` = ?",
+		PrimaryRows: 1,
+		At:          clock.Now(),
+	}}, divergences)
+
+	// a failed statement rolls the mirror transaction back, the primary one is committed anyway
+	mirror.Reset()
+	divergences = nil
+	err = manager.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+		return tx.Delete(&mirroredOrder{ID: 1}).Error
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"BEGIN", "DELETE FROM `orders` WHERE `orders`.`id` = ?", "ROLLBACK"}, mirror.Statements())
+	assert.Equal(t, []Divergence{{
+		Table:       "orders",
+		SQL:         "DELETE FROM `orders` WHERE `orders`.`id` = ?",
+		PrimaryRows: 1,
+		Error:       mirrorErr.Error(),
+		At:          clock.Now(),
+	}}, divergences)
+}
+
+func TestCompareTables(t *testing.T) {
+	digest := func(rows, checksum int64) *recordingdriver.Driver {
+		return &recordingdriver.Driver{Results: func(query string) ([]string, [][]driver.Value) {
+			if strings.HasPrefix(query, "CHECKSUM TABLE") {
+				return []string{"Table", "Checksum"}, [][]driver.Value{{"pt.orders", checksum}}
+			}
+			return []string{"count"}, [][]driver.Value{{rows}}
+		}}
+	}
+	clock := newFakeClock()
+	primary := newRecordingManager(t, digest(2, 42), WithClock(clock))
+	var divergences []Divergence
+	recorder := DivergenceRecorderFunc(func(ctx context.Context, divergence Divergence) {
+		divergences = append(divergences, divergence)
+	})
+
+	assert.NoError(t, CompareTables(context.Background(), primary, newRecordingDB(t, digest(2, 42)), recorder, "orders"))
+	assert.Empty(t, divergences)
+	assert.NoError(t, CompareTables(context.Background(), primary, newRecordingDB(t, digest(2, 7)), recorder, "orders"))
+	assert.Equal(t, []Divergence{{
+		Table:           "orders",
+		PrimaryRows:     2,
+		MirrorRows:      2,
+		PrimaryChecksum: 42,
+		MirrorChecksum:  7,
+		At:              clock.Now(),
+	}}, divergences)
+}
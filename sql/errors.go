@@ -0,0 +1,52 @@
+package sql
+
+import "fmt"
+
+// The errors of a root transaction tell its outcome apart:
+//   - the error of bizFn as is: the transaction rolled back
+//   - *CommitError: bizFn succeeded but the commit failed, the transaction rolled back (or its outcome is unknown,
+//     see ErrCommitOutcomeUnknown). Its Cause is context.Canceled or context.DeadlineExceeded if the ctx of the call
+//     was done before the commit.
+//   - *RollbackError: rolling back failed after one of the errors above, e.g. the connection was lost
+
+// CommitError is returned when committing a root transaction failed, before commit hooks included
+type CommitError struct {
+	// Name is the name of the transaction, see WithName
+	Name  string
+	Cause error
+}
+
+func (e *CommitError) Error() string {
+	return fmt.Sprintf("%scommit failed: %v", namePrefix(e.Name), e.Cause)
+}
+
+func (e *CommitError) Unwrap() error {
+	return e.Cause
+}
+
+// RollbackError is returned when rolling back a transaction failed after Original, e.g. the connection was lost
+// mid-rollback. The database rolls back on its own once the connection closes, but locks may be held until then.
+type RollbackError struct {
+	// Name is the name of the transaction, see WithName
+	Name string
+	// Cause is the error of the rollback
+	Cause error
+	// Original is the error which triggered the rollback
+	Original error
+}
+
+func (e *RollbackError) Error() string {
+	return fmt.Sprintf("%s%v (rollback failed: %v)", namePrefix(e.Name), e.Original, e.Cause)
+}
+
+func (e *RollbackError) Unwrap() []error {
+	return []error{e.Original, e.Cause}
+}
+
+// namePrefix return the prefix of the error messages of the transaction with name
+func namePrefix(name string) string {
+	if name == "" {
+		return ""
+	}
+	return "transaction " + name + ": "
+}
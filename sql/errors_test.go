@@ -0,0 +1,47 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"propagation-tx/internal/recordingdriver"
+	"testing"
+)
+
+func TestCommitError(t *testing.T) {
+	commitErr := errors.New("deadlock found")
+	manager := newRecordingManager(t, &recordingdriver.Driver{CommitErr: commitErr})
+	err := manager.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+		return nil
+	}, WithName("order"))
+	var commitError *CommitError
+	assert.ErrorAs(t, err, &commitError)
+	assert.Equal(t, "order", commitError.Name)
+	assert.ErrorIs(t, err, commitErr)
+	assert.Equal(t, "transaction order: commit failed: deadlock found", err.Error())
+
+	// the error of bizFn is returned as is
+	err = manager.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+		return mockErr
+	})
+	assert.Equal(t, mockErr, err)
+}
+
+func TestRollbackError(t *testing.T) {
+	rollbackErr := errors.New("connection lost")
+	manager := newRecordingManager(t, &recordingdriver.Driver{RollbackErr: rollbackErr})
+	err := manager.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+		return mockErr
+	}, WithName("order"))
+	var rollbackError *RollbackError
+	assert.ErrorAs(t, err, &rollbackError)
+	assert.Equal(t, "order", rollbackError.Name)
+	assert.Equal(t, mockErr, rollbackError.Original)
+	assert.ErrorIs(t, err, rollbackErr)
+	assert.ErrorIs(t, err, mockErr)
+	assert.Equal(t, "transaction order: "+mockErr.Error()+" (rollback failed: connection lost)", err.Error())
+
+	var commitError *CommitError
+	assert.False(t, errors.As(err, &commitError))
+}
@@ -0,0 +1,80 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+)
+
+var ErrNoEventPublisher = errors.New("no event publisher")
+
+// EventPublisher delivers the events published with PublishAfterCommit, e.g. to a Kafka topic or a NATS subject
+type EventPublisher interface {
+	// Publish delivers event, the transaction it was published in committed
+	Publish(ctx context.Context, event interface{}) error
+}
+
+// EventPublisherFunc is a func implementing EventPublisher
+type EventPublisherFunc func(ctx context.Context, event interface{}) error
+
+func (f EventPublisherFunc) Publish(ctx context.Context, event interface{}) error {
+	return f(ctx, event)
+}
+
+// WithEventPublisher delivers the events published with PublishAfterCommit in the transactions of the manager
+// with publisher
+func WithEventPublisher(publisher EventPublisher) ManagerOption {
+	return func(m *transactionManager) {
+		m.eventPublisher = publisher
+	}
+}
+
+// PublishAfterCommit buffers event until the root transaction of ctx committed, then delivers it with the
+// EventPublisher of the manager. It's dropped if the transaction rolls back, or the PropagationNested savepoint it
+// was published in is rolled back. Events are delivered in the order they were published, a delivery failure is
+// only logged since the transaction can't be undone.
+func PublishAfterCommit(ctx context.Context, event interface{}) error {
+	txCtx, ok := currentTransaction(ctx)
+	if !ok {
+		return ErrNoTransaction
+	}
+	publisher := txCtx.root().eventPublisher
+	if publisher == nil {
+		return ErrNoEventPublisher
+	}
+	AfterCommit(ctx, func(ctx context.Context) {
+		if err := publisher.Publish(ctx, event); err != nil {
+			log.Printf("[TX] publish %T after commit error: %v", event, err)
+		}
+	})
+	return nil
+}
+
+// InMemoryPublisher is an EventPublisher delivering the events to its subscribers synchronously, for tests and
+// single-process setups
+type InMemoryPublisher struct {
+	mu          sync.RWMutex
+	subscribers []func(ctx context.Context, event interface{})
+}
+
+func NewInMemoryPublisher() *InMemoryPublisher {
+	return &InMemoryPublisher{}
+}
+
+// Subscribe makes fn receive the events published from now on
+func (p *InMemoryPublisher) Subscribe(fn func(ctx context.Context, event interface{})) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.subscribers = append(p.subscribers, fn)
+}
+
+func (p *InMemoryPublisher) Publish(ctx context.Context, event interface{}) error {
+	p.mu.RLock()
+	subscribers := p.subscribers
+	p.mu.RUnlock()
+	for _, fn := range subscribers {
+		fn(ctx, event)
+	}
+	return nil
+}
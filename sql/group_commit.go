@@ -0,0 +1,147 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"sync"
+	"time"
+)
+
+var ErrGroupCommitterClosed = errors.New("group committer is closed")
+
+// GroupCommitter coalesces many small independent writes into shared transactions, committed every interval
+// or as soon as maxBatch operations are pending, trading latency for throughput.
+//
+// Every operation runs in its own savepoint of the shared transaction, so a failing operation doesn't affect
+// the others of its batch. The done callback of an operation receives its own error if it failed, otherwise
+// the commit result of the batch. With the savepoints of the manager disabled every operation runs in its own
+// transaction instead.
+type GroupCommitter struct {
+	tm       TransactionManager
+	interval time.Duration
+	maxBatch int
+
+	ops     chan *groupOperation
+	stopped chan struct{}
+	closed  bool
+	sync.RWMutex
+}
+
+type groupOperation struct {
+	ctx  context.Context
+	fn   func(ctx context.Context, tx *gorm.DB) error
+	done func(err error)
+}
+
+// NewGroupCommitter return a started GroupCommitter committing the operations submitted to it with tm
+func NewGroupCommitter(tm TransactionManager, interval time.Duration, maxBatch int) *GroupCommitter {
+	if interval <= 0 {
+		panic("group commit interval must be positive")
+	}
+	if maxBatch <= 0 {
+		maxBatch = 1
+	}
+	g := &GroupCommitter{
+		tm:       tm,
+		interval: interval,
+		maxBatch: maxBatch,
+		ops:      make(chan *groupOperation, maxBatch),
+		stopped:  make(chan struct{}),
+	}
+	go g.run()
+	return g
+}
+
+// Submit queues fn to be executed in the next batch, done is called with the result once the batch completed.
+// fn receives the context of the shared transaction, ctx only aborts the operation if it's done before the batch runs.
+func (g *GroupCommitter) Submit(ctx context.Context, fn func(ctx context.Context, tx *gorm.DB) error, done func(err error)) error {
+	g.RLock()
+	defer g.RUnlock()
+	if g.closed {
+		return ErrGroupCommitterClosed
+	}
+	g.ops <- &groupOperation{ctx: ctx, fn: fn, done: done}
+	return nil
+}
+
+// Close commits the pending operations and stops the GroupCommitter
+func (g *GroupCommitter) Close() {
+	g.Lock()
+	if !g.closed {
+		g.closed = true
+		close(g.ops)
+	}
+	g.Unlock()
+	<-g.stopped
+}
+
+func (g *GroupCommitter) run() {
+	defer close(g.stopped)
+	ticker := time.NewTicker(g.interval)
+	defer ticker.Stop()
+
+	batch := make([]*groupOperation, 0, g.maxBatch)
+	for {
+		select {
+		case op, ok := <-g.ops:
+			if !ok {
+				g.flush(batch)
+				return
+			}
+			batch = append(batch, op)
+			if len(batch) >= g.maxBatch {
+				g.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			g.flush(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+func (g *GroupCommitter) flush(batch []*groupOperation) {
+	if len(batch) == 0 {
+		return
+	}
+	if !savepointsEnabled(g.tm) {
+		// PropagationNested would join the shared transaction, a failed operation rolling its batch back with it
+		for _, op := range batch {
+			err := op.ctx.Err()
+			if err == nil {
+				err = g.tm.Transaction(context.Background(), op.recovered, PropagationRequiresNew)
+			}
+			if op.done != nil {
+				op.done(err)
+			}
+		}
+		return
+	}
+	results := make([]error, len(batch))
+	err := g.tm.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+		for i, op := range batch {
+			if results[i] = op.ctx.Err(); results[i] != nil {
+				continue
+			}
+			results[i] = g.tm.Transaction(ctx, op.recovered, PropagationNested)
+		}
+		return nil
+	}, PropagationRequired)
+
+	for i, op := range batch {
+		if results[i] == nil {
+			results[i] = err
+		}
+		if op.done != nil {
+			op.done(results[i])
+		}
+	}
+}
+
+// recovered runs the operation turning a panic into an error, so it only rolls back its own savepoint
+func (op *groupOperation) recovered(ctx context.Context, tx *gorm.DB) error {
+	return callRecovered(func() error {
+		return op.fn(ctx, tx)
+	})
+}
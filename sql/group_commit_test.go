@@ -0,0 +1,48 @@
+package sql
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGroupCommitter_Submit(t *testing.T) {
+	for name, manager := range map[string]TransactionManager{
+		"savepoints":          tm,
+		"savepoints-disabled": NewTransactionManager(factory, WithSavepointsDisabled()),
+	} {
+		testGroupCommitterSubmit(t, name, manager)
+	}
+}
+
+func testGroupCommitterSubmit(t *testing.T, name string, manager TransactionManager) {
+	results := make(map[string]error)
+	DefaultTransactionTest("test-failed-operation-isolated-"+name, t, func() {
+		g := NewGroupCommitter(manager, 10*time.Millisecond, 10)
+		var mu sync.Mutex
+		submit := func(user *User, err error) {
+			_ = g.Submit(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+				tx.Create(user)
+				return err
+			}, func(err error) {
+				mu.Lock()
+				defer mu.Unlock()
+				results[user.Username] = err
+			})
+		}
+		submit(user1, nil)
+		submit(user2, mockErr)
+		submit(user3, nil)
+		g.Close()
+	}, func(t *testing.T) {
+		AssertExist(t, user1)
+		AssertNotExist(t, user2)
+		AssertExist(t, user3)
+		assert.Nil(t, results[user1.Username])
+		assert.Equal(t, mockErr, results[user2.Username])
+		assert.Nil(t, results[user3.Username])
+	})
+}
@@ -0,0 +1,160 @@
+package sql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"log"
+	"strings"
+)
+
+var ErrGuardrailViolated = errors.New("transaction guardrail violated")
+
+// GuardrailAction is what happens when a transaction violates its Guardrails
+type GuardrailAction int8
+
+const (
+	GuardrailWarn     GuardrailAction = iota // 记录日志，继续执行
+	GuardrailError                           // 违规语句返回ErrGuardrailViolated
+	GuardrailRollback                        // 违规语句返回ErrGuardrailViolated，且整个事务只能回滚
+)
+
+// Guardrails are the limits of the root transactions of a manager, zero values are unlimited
+type Guardrails struct {
+	// MaxStatements is the maximum number of statements of a transaction
+	MaxStatements int
+	// MaxRowsAffected is the maximum number of rows created, updated or deleted by a transaction
+	MaxRowsAffected int64
+	// ForbidDDL rejects CREATE/ALTER/DROP/TRUNCATE/RENAME statements, which commit implicitly on MySQL
+	ForbidDDL bool
+	// Action is applied on violation
+	Action GuardrailAction
+	// OnSplitHint is called with the SplitHint of every transaction exceeding MaxStatements or MaxRowsAffected,
+	// the hint is logged anyway
+	OnSplitHint func(ctx context.Context, hint SplitHint)
+}
+
+// SplitHint reports a transaction exceeding the statements/rows guardrails, it's a candidate to be split into
+// chunks of smaller transactions
+type SplitHint struct {
+	// Callsite is the file:line starting the transaction
+	Callsite     string `json:"callsite"`
+	Statements   int    `json:"statements"`
+	RowsAffected int64  `json:"rowsAffected"`
+	// Histogram counts the statements by type and table, e.g. "UPDATE user"
+	Histogram map[string]int `json:"histogram"`
+}
+
+// guardrailKey is the key of the guardrailState bound to a root transaction
+type guardrailKey struct{}
+
+type guardrailState struct {
+	guardrails *Guardrails
+	callsite   string
+	histogram  map[string]int
+	exceeded   bool
+	violation  error
+}
+
+// WithGuardrails evaluates guardrails on every statement of the root transactions of the manager
+func WithGuardrails(guardrails Guardrails) ManagerOption {
+	return func(m *transactionManager) {
+		m.guardrails = &guardrails
+	}
+}
+
+// startGuardrails enables the guardrails of the root transaction txCtx started at callsite
+func (m *transactionManager) startGuardrails(txCtx *transactionContext, callsite string) {
+	state := txCtx.boundValue(guardrailKey{}, func() interface{} {
+		return &guardrailState{guardrails: m.guardrails, callsite: callsite, histogram: make(map[string]int)}
+	}).(*guardrailState)
+	txCtx.beforeCompletion = append(txCtx.beforeCompletion, func(tx *gorm.DB) {
+		if state.exceeded {
+			state.emitSplitHint(txCtx.ctx, txCtx.stats)
+		}
+	})
+	if m.guardrails.Action == GuardrailRollback {
+		txCtx.beforeCommit = append(txCtx.beforeCommit, func(ctx context.Context, tx *gorm.DB) error {
+			return state.violation
+		})
+	}
+}
+
+// guardrailState return the guardrailState of the root transaction c, nil if it has none
+func (c *transactionContext) guardrailState() *guardrailState {
+	state, _ := c.values[guardrailKey{}].(*guardrailState)
+	return state
+}
+
+// checkStatement runs before a statement, violations prevent its execution unless the action is GuardrailWarn
+func (s *guardrailState) checkStatement(db *gorm.DB, stats TransactionStats) {
+	if limit := s.guardrails.MaxStatements; limit > 0 && stats.Statements > limit {
+		s.exceeded = true
+		s.violate(db, fmt.Sprintf("more than %d statements", limit))
+		return
+	}
+	if s.guardrails.ForbidDDL && isDDL(db.Statement.SQL.String()) {
+		s.violate(db, "DDL statement "+db.Statement.SQL.String())
+	}
+}
+
+// checkRowsAffected runs after a write, it can only fail the statement already executed
+func (s *guardrailState) checkRowsAffected(db *gorm.DB, stats TransactionStats) {
+	if limit := s.guardrails.MaxRowsAffected; limit > 0 && stats.RowsAffected > limit {
+		s.exceeded = true
+		s.violate(db, fmt.Sprintf("more than %d rows affected", limit))
+	}
+}
+
+func (s *guardrailState) violate(db *gorm.DB, reason string) {
+	err := fmt.Errorf("%w: %s", ErrGuardrailViolated, reason)
+	if s.guardrails.Action == GuardrailWarn {
+		log.Println("[TX] ", err)
+		return
+	}
+	if s.violation == nil {
+		s.violation = err
+	}
+	_ = db.AddError(err)
+}
+
+func (s *guardrailState) record(db *gorm.DB) {
+	sql := strings.TrimSpace(db.Statement.SQL.String())
+	if sql == "" {
+		return
+	}
+	key := strings.ToUpper(strings.SplitN(sql, " ", 2)[0])
+	if db.Statement.Table != "" {
+		key += " " + db.Statement.Table
+	}
+	s.histogram[key]++
+}
+
+func (s *guardrailState) emitSplitHint(ctx context.Context, stats TransactionStats) {
+	hint := SplitHint{
+		Callsite:     s.callsite,
+		Statements:   stats.Statements,
+		RowsAffected: stats.RowsAffected,
+		Histogram:    s.histogram,
+	}
+	if data, err := json.Marshal(hint); err == nil {
+		log.Println("[TX] split hint: ", string(data))
+	}
+	if s.guardrails.OnSplitHint != nil {
+		s.guardrails.OnSplitHint(ctx, hint)
+	}
+}
+
+var ddlKeywords = []string{"CREATE", "ALTER", "DROP", "TRUNCATE", "RENAME"}
+
+func isDDL(sql string) bool {
+	sql = strings.ToUpper(strings.TrimSpace(sql))
+	for _, keyword := range ddlKeywords {
+		if strings.HasPrefix(sql, keyword) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// ErrDuplicateRequest is returned by Idempotent, with the result stored for the key, when the key was processed
+// already
+var ErrDuplicateRequest = errors.New("duplicate request")
+
+// idempotencyRecord is a row of the idempotency table, the result of a processed key
+type idempotencyRecord struct {
+	Key       string    `gorm:"column:idempotency_key;type:varchar(255);primaryKey"`
+	Result    []byte    `gorm:"column:result"`
+	CreatedAt time.Time `gorm:"column:created_at;not null"`
+}
+
+func (r *idempotencyRecord) TableName() string {
+	return "ptx_idempotency"
+}
+
+// Idempotent runs fn once per key: the key is inserted in the ptx_idempotency table in the transaction of fn, with
+// the result of fn once it succeeded. A call with a key processed already doesn't run fn and return the stored
+// result with ErrDuplicateRequest; a call concurrent to the one processing the key waits for its outcome. If fn
+// fails the key is released with the rollback, a PropagationNested call releases it with its savepoint when the
+// call joins an ambient transaction. The table is created on the first call, a failed creation is retried by the
+// next one.
+func (m *transactionManager) Idempotent(ctx context.Context, key string, fn func(ctx context.Context, tx *gorm.DB) ([]byte, error), opts ...TxOption) ([]byte, error) {
+	if err := m.migrateIdempotencyTable(); err != nil {
+		return nil, err
+	}
+	var result []byte
+	err := m.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+		record := &idempotencyRecord{Key: key, CreatedAt: m.clock.Now()}
+		inserted := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+		if inserted.Error != nil {
+			return inserted.Error
+		}
+		if inserted.RowsAffected == 0 {
+			// a locking read sees the row committed by another transaction whatever the snapshot of tx
+			stored := &idempotencyRecord{}
+			if err := tx.Clauses(clause.Locking{Strength: "SHARE"}).Where("idempotency_key = ?", key).Take(stored).Error; err != nil {
+				return err
+			}
+			result = stored.Result
+			return ErrDuplicateRequest
+		}
+		var err error
+		if result, err = fn(ctx, tx); err != nil {
+			return err
+		}
+		return tx.Model(record).Update("result", result).Error
+	}, opts...)
+	return result, err
+}
+
+// migrateIdempotencyTable creates or migrates the idempotency table until it succeeded once
+func (m *transactionManager) migrateIdempotencyTable() error {
+	if m.idempotencyTable.Load() {
+		return nil
+	}
+	m.idempotencyTableMu.Lock()
+	defer m.idempotencyTableMu.Unlock()
+	if m.idempotencyTable.Load() {
+		return nil
+	}
+	if err := m.GetOriginDB().AutoMigrate(&idempotencyRecord{}); err != nil {
+		return err
+	}
+	m.idempotencyTable.Store(true)
+	return nil
+}
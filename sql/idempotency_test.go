@@ -0,0 +1,94 @@
+package sql
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestTransactionManager_Idempotent_Failure(t *testing.T) {
+	key := "test-idempotent-failure"
+	db.Exec("DELETE FROM ptx_idempotency WHERE idempotency_key = ?", key)
+	defer db.Exec("DELETE FROM ptx_idempotency WHERE idempotency_key = ?", key)
+	DefaultTransactionTest("test-key-released-on-rollback", t, func() {
+		_, err := tm.Idempotent(context.Background(), key, func(ctx context.Context, tx *gorm.DB) ([]byte, error) {
+			tx.Create(user1)
+			return nil, mockErr
+		})
+		assert.ErrorIs(t, err, mockErr)
+		result, err := tm.Idempotent(context.Background(), key, func(ctx context.Context, tx *gorm.DB) ([]byte, error) {
+			return []byte(user2.Username), tx.Create(user2).Error
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, user2.Username, string(result))
+	}, func(t *testing.T) {
+		AssertNotExist(t, user1)
+		AssertExist(t, user2)
+	})
+}
+
+func TestTransactionManager_Idempotent_Concurrent(t *testing.T) {
+	key := "test-idempotent-concurrent"
+	db.Exec("DELETE FROM ptx_idempotency WHERE idempotency_key = ?", key)
+	defer db.Exec("DELETE FROM ptx_idempotency WHERE idempotency_key = ?", key)
+	const callers = 8
+	var mu sync.Mutex
+	calls, duplicates := 0, 0
+	DefaultTransactionTest("test-key-processed-once", t, func() {
+		var wg sync.WaitGroup
+		for i := 0; i < callers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				result, err := tm.Idempotent(context.Background(), key, func(ctx context.Context, tx *gorm.DB) ([]byte, error) {
+					mu.Lock()
+					calls++
+					mu.Unlock()
+					return []byte(user1.Username), tx.Create(user1).Error
+				})
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					assert.ErrorIs(t, err, ErrDuplicateRequest)
+					duplicates++
+				}
+				assert.Equal(t, user1.Username, string(result))
+			}()
+		}
+		wg.Wait()
+	}, func(t *testing.T) {
+		AssertExist(t, user1)
+		assert.Equal(t, 1, calls)
+		assert.Equal(t, callers-1, duplicates)
+	})
+}
+
+func TestTransactionManager_Idempotent_MigrationRetried(t *testing.T) {
+	unreachable, err := gorm.Open(mysql.New(mysql.Config{DSN: "root@tcp(localhost:1)/pt", SkipInitializeWithVersion: true}),
+		&gorm.Config{DisableAutomaticPing: true, Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrations := 0
+	err = unreachable.Callback().Raw().Before("gorm:raw").Register("test:count_migrations", func(db *gorm.DB) {
+		if strings.HasPrefix(db.Statement.SQL.String(), "CREATE TABLE") {
+			migrations++
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unreachableTm := NewTransactionManager(connConfigFactory{db: unreachable})
+	for i := 1; i <= 2; i++ {
+		_, err := unreachableTm.Idempotent(context.Background(), "test-migration-retried", func(ctx context.Context, tx *gorm.DB) ([]byte, error) {
+			return nil, nil
+		})
+		assert.Error(t, err)
+		assert.Equal(t, i, migrations)
+	}
+}
@@ -0,0 +1,66 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	"gorm.io/gorm"
+)
+
+// ImportReport is the outcome of ImportEach
+type ImportReport struct {
+	// Succeeded is the number of items imported
+	Succeeded int
+	// Failures are the items rolled back to their savepoint
+	Failures []ImportFailure
+}
+
+// ImportFailure is an item ImportEach failed to import
+type ImportFailure struct {
+	Index int
+	Err   error
+}
+
+// ImportEach imports items in one transaction, each of them in its own savepoint: an item failing (error or panic)
+// only rolls back its own changes and is reported, the other items are committed together.
+// The returned error is the one of the transaction itself, in which case nothing was committed.
+//
+// With the savepoints of tm disabled (WithSavepointsDisabled, gorm.Config.DisableNestedTransaction) each item is
+// imported in its own transaction instead, PropagationRequiresNew, and stays committed whatever happens next.
+func ImportEach[T any](ctx context.Context, tm TransactionManager, items []T, fn func(ctx context.Context, tx *gorm.DB, item T) error) (*ImportReport, error) {
+	report := &ImportReport{}
+	importItems := func(ctx context.Context, propagation TransactionPropagation) {
+		for i, item := range items {
+			item := item
+			err := tm.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+				return callRecovered(func() error {
+					return fn(ctx, tx, item)
+				})
+			}, propagation)
+			if err != nil {
+				report.Failures = append(report.Failures, ImportFailure{Index: i, Err: err})
+			} else {
+				report.Succeeded++
+			}
+		}
+	}
+	if !savepointsEnabled(tm) {
+		// PropagationNested would join the shared transaction, a failed item rolling the others back with it
+		importItems(ctx, PropagationRequiresNew)
+		return report, nil
+	}
+	err := tm.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+		importItems(ctx, PropagationNested)
+		return nil
+	}, PropagationRequired)
+	return report, err
+}
+
+// callRecovered calls fn turning a panic into an error, so it only rolls back the savepoint fn runs in
+func callRecovered(fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn()
+}
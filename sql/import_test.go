@@ -0,0 +1,34 @@
+package sql
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"testing"
+)
+
+func TestImportEach(t *testing.T) {
+	for name, manager := range map[string]TransactionManager{
+		"savepoints":          tm,
+		"savepoints-disabled": NewTransactionManager(factory, WithSavepointsDisabled()),
+	} {
+		var report *ImportReport
+		var err error
+		DefaultTransactionTest("test-failed-item-isolated-"+name, t, func() {
+			report, err = ImportEach(context.Background(), manager, []*User{user1, user2, user3}, func(ctx context.Context, tx *gorm.DB, user *User) error {
+				tx.Create(user)
+				if user == user2 {
+					return mockErr
+				}
+				return nil
+			})
+		}, func(t *testing.T) {
+			assert.NoError(t, err)
+			assert.Equal(t, 2, report.Succeeded)
+			assert.Equal(t, []ImportFailure{{Index: 1, Err: mockErr}}, report.Failures)
+			AssertExist(t, user1)
+			AssertNotExist(t, user2)
+			AssertExist(t, user3)
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+var ErrPropagationRejected = errors.New("propagation rejected")
+
+// PropagationCall is a Transaction call submitted to the PropagationInterceptor of the manager
+type PropagationCall struct {
+	// Name is the name given by WithName, the function calling Transaction by default
+	Name string
+	// Propagation is the requested propagation
+	Propagation TransactionPropagation
+	// InTransaction tells whether the call is made inside a transaction of the manager
+	InTransaction bool
+}
+
+// PropagationInterceptor is consulted before the manager applies the propagation of a call,
+// it return the effective propagation, or an error to reject the call
+type PropagationInterceptor interface {
+	InterceptPropagation(ctx context.Context, call PropagationCall) (TransactionPropagation, error)
+}
+
+// PropagationInterceptorFunc is a func implementing PropagationInterceptor
+type PropagationInterceptorFunc func(ctx context.Context, call PropagationCall) (TransactionPropagation, error)
+
+func (f PropagationInterceptorFunc) InterceptPropagation(ctx context.Context, call PropagationCall) (TransactionPropagation, error) {
+	return f(ctx, call)
+}
+
+// WithPropagationInterceptors registers interceptors consulted in order,
+// each one receives the propagation returned by the previous one
+func WithPropagationInterceptors(interceptors ...PropagationInterceptor) ManagerOption {
+	return func(m *transactionManager) {
+		m.interceptors = append(m.interceptors, interceptors...)
+	}
+}
+
+// WithName names the call for PropagationInterceptor, and names the transaction in TransactionInfo, its
+// CommitError/RollbackError and WithBeginComment if it starts a root transaction
+func WithName(name string) TxOption {
+	return txOptionFunc(func(o *txOptions) {
+		o.name = name
+	})
+}
+
+// WithBeginComment runs /* tx:name */ SELECT 1 right after beginning a named root transaction, so the name shows
+// among the statements of the connection (performance_schema on MySQL 8, pg_stat_activity on Postgres) when
+// looking for the transaction holding a lock. The statement isn't counted in the TransactionStats.
+func WithBeginComment() ManagerOption {
+	return func(m *transactionManager) {
+		m.beginComment = true
+	}
+}
+
+// commentBegin runs the begin comment of the root transaction txCtx named name
+func commentBegin(txCtx *transactionContext, name string) error {
+	name = strings.NewReplacer("*/", "", "/*", "").Replace(name)
+	_, err := txCtx.tx.Statement.ConnPool.ExecContext(txCtx.ctx, "/* tx:"+name+" */ SELECT 1")
+	return err
+}
+
+// WithCallerNames names the calls without WithName after the function calling Transaction (package.function),
+// so transactions are told apart in TransactionInfo
+func WithCallerNames() ManagerOption {
+	return func(m *transactionManager) {
+		m.callerNames = true
+	}
+}
+
+// ForbidRequiresNewInTransaction return an interceptor rejecting PropagationRequiresNew inside a transaction,
+// except for the calls named in allowlist
+func ForbidRequiresNewInTransaction(allowlist ...string) PropagationInterceptor {
+	allowed := make(map[string]bool, len(allowlist))
+	for _, name := range allowlist {
+		allowed[name] = true
+	}
+	return PropagationInterceptorFunc(func(ctx context.Context, call PropagationCall) (TransactionPropagation, error) {
+		if call.InTransaction && call.Propagation == PropagationRequiresNew && !allowed[call.Name] {
+			return call.Propagation, fmt.Errorf("%w: %s inside transaction by %s", ErrPropagationRejected, call.Propagation, call.Name)
+		}
+		return call.Propagation, nil
+	})
+}
+
+// interceptPropagation return the propagation of call decided by the interceptors of m
+func (m *transactionManager) interceptPropagation(ctx context.Context, call PropagationCall) (TransactionPropagation, error) {
+	for _, interceptor := range m.interceptors {
+		propagation, err := interceptor.InterceptPropagation(ctx, call)
+		if err != nil {
+			return call.Propagation, err
+		}
+		call.Propagation = propagation
+	}
+	return call.Propagation, nil
+}
+
+var callerNames sync.Map
+
+// callerName return the package.function calling the caller of callerName, cached by program counter
+func callerName() string {
+	pc, _, _, ok := runtime.Caller(2)
+	if !ok {
+		return "unknown"
+	}
+	if name, ok := callerNames.Load(pc); ok {
+		return name.(string)
+	}
+	name := "unknown"
+	if fn := runtime.FuncForPC(pc); fn != nil {
+		name = fn.Name()
+	}
+	callerNames.Store(pc, name)
+	return name
+}
+
+// callsite return the file:line of the caller of the caller of callsite
+func callsite() string {
+	_, file, line, ok := runtime.Caller(2)
+	if !ok {
+		return "unknown"
+	}
+	return fmt.Sprintf("%s:%d", file, line)
+}
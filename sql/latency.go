@@ -0,0 +1,80 @@
+package sql
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+var defaultLatencyBuckets = []time.Duration{
+	time.Millisecond, 5 * time.Millisecond, 10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond, time.Second, 5 * time.Second,
+}
+
+// LatencyHistogram is a TimingObserver counting the phases of the root transactions of a manager in latency
+// buckets, register one per datasource to compare their commit latencies
+type LatencyHistogram struct {
+	buckets []time.Duration
+
+	mu         sync.Mutex
+	begin      []uint64
+	body       []uint64
+	completion []uint64
+}
+
+// LatencySnapshot are the counts of a LatencyHistogram, counts[i] is the number of phases lasting at most
+// Buckets[i], the last count is the one of the phases longer than every bucket
+type LatencySnapshot struct {
+	Buckets    []time.Duration
+	Begin      []uint64
+	Body       []uint64
+	Completion []uint64
+}
+
+var _ TimingObserver = (*LatencyHistogram)(nil)
+
+// NewLatencyHistogram return a LatencyHistogram with the upper bounds buckets, or default ones from 1ms to 5s
+func NewLatencyHistogram(buckets ...time.Duration) *LatencyHistogram {
+	if len(buckets) == 0 {
+		buckets = defaultLatencyBuckets
+	}
+	buckets = append([]time.Duration(nil), buckets...)
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i] < buckets[j] })
+	return &LatencyHistogram{
+		buckets:    buckets,
+		begin:      make([]uint64, len(buckets)+1),
+		body:       make([]uint64, len(buckets)+1),
+		completion: make([]uint64, len(buckets)+1),
+	}
+}
+
+func (h *LatencyHistogram) TransactionStarted(ctx context.Context, _ TransactionInfo) context.Context {
+	return ctx
+}
+
+func (h *LatencyHistogram) TransactionFinished(context.Context, TransactionInfo, error) {}
+
+func (h *LatencyHistogram) TransactionTimed(_ context.Context, _ TransactionInfo, timings TransactionTimings) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.begin[h.bucketOf(timings.Begin)]++
+	h.body[h.bucketOf(timings.Body)]++
+	h.completion[h.bucketOf(timings.Completion)]++
+}
+
+// Snapshot return a copy of the counts of h
+func (h *LatencyHistogram) Snapshot() LatencySnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return LatencySnapshot{
+		Buckets:    append([]time.Duration(nil), h.buckets...),
+		Begin:      append([]uint64(nil), h.begin...),
+		Body:       append([]uint64(nil), h.body...),
+		Completion: append([]uint64(nil), h.completion...),
+	}
+}
+
+func (h *LatencyHistogram) bucketOf(d time.Duration) int {
+	return sort.Search(len(h.buckets), func(i int) bool { return d <= h.buckets[i] })
+}
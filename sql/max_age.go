@@ -0,0 +1,28 @@
+package sql
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrTxTooOld = errors.New("transaction open for too long")
+
+// WithMaxTransactionAge fails fast with ErrTxTooOld the Transaction calls made inside a transaction of the manager
+// open for longer than maxAge, whatever the deadline of the ctx, to bound the time locks are held
+func WithMaxTransactionAge(maxAge time.Duration) ManagerOption {
+	return func(m *transactionManager) {
+		m.maxTransactionAge = maxAge
+	}
+}
+
+// checkAge return ErrTxTooOld if the root transaction of txCtx is older than the max age of m
+func (m *transactionManager) checkAge(txCtx *transactionContext) error {
+	if m.maxTransactionAge <= 0 {
+		return nil
+	}
+	if age := m.since(txCtx.root().startedAt); age > m.maxTransactionAge {
+		return fmt.Errorf("%w: open for %s, max %s", ErrTxTooOld, age, m.maxTransactionAge)
+	}
+	return nil
+}
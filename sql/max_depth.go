@@ -0,0 +1,39 @@
+package sql
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrTooDeeplyNested = errors.New("transaction calls too deeply nested")
+
+// defaultMaxNestingDepth is the max nesting depth of the managers without WithMaxNestingDepth
+const defaultMaxNestingDepth = 32
+
+// WithMaxNestingDepth fails with ErrTooDeeplyNested the Transaction calls nested more than depth calls deep in a
+// transaction of the manager, e.g. runaway recursive calls stacking savepoints. 0 is unlimited, 32 by default.
+func WithMaxNestingDepth(depth int) ManagerOption {
+	return func(m *transactionManager) {
+		m.maxNestingDepth = depth
+	}
+}
+
+// depth return the number of calls joining the root transaction down to c, 0 for the root
+func (c *transactionContext) depth() int {
+	depth := 0
+	for ; c.parent != nil; c = c.parent {
+		depth++
+	}
+	return depth
+}
+
+// checkDepth return ErrTooDeeplyNested if a call in txCtx would exceed the max nesting depth of m
+func (m *transactionManager) checkDepth(txCtx *transactionContext) error {
+	if m.maxNestingDepth <= 0 {
+		return nil
+	}
+	if depth := txCtx.depth() + 1; depth > m.maxNestingDepth {
+		return fmt.Errorf("%w: depth %d, max %d", ErrTooDeeplyNested, depth, m.maxNestingDepth)
+	}
+	return nil
+}
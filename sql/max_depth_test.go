@@ -0,0 +1,40 @@
+package sql
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"propagation-tx/internal/recordingdriver"
+	"testing"
+)
+
+func TestMaxNestingDepth(t *testing.T) {
+	d := &recordingdriver.Driver{}
+	manager := newRecordingManager(t, d, WithMaxNestingDepth(2))
+	calls := 0
+	var recurse func(ctx context.Context, tx *gorm.DB) error
+	recurse = func(ctx context.Context, tx *gorm.DB) error {
+		calls++
+		return manager.Transaction(ctx, recurse, PropagationNested)
+	}
+	err := manager.Transaction(context.Background(), recurse)
+	assert.ErrorIs(t, err, ErrTooDeeplyNested)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, "ROLLBACK", d.Statements()[len(d.Statements())-1])
+
+	d = &recordingdriver.Driver{}
+	manager = newRecordingManager(t, d, WithMaxNestingDepth(0))
+	calls = 0
+	err = manager.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+		var recurse func(ctx context.Context, tx *gorm.DB) error
+		recurse = func(ctx context.Context, tx *gorm.DB) error {
+			if calls++; calls == 40 {
+				return nil
+			}
+			return manager.Transaction(ctx, recurse, PropagationRequired)
+		}
+		return recurse(ctx, tx)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 40, calls)
+}
@@ -0,0 +1,80 @@
+package sql
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+// MetadataLockAction is what the manager does when a pending metadata lock is found on the tables of a transaction
+type MetadataLockAction int8
+
+const (
+	MetadataLockWarn  MetadataLockAction = iota // 记录日志后立即开始事务
+	MetadataLockDelay                           // 等待锁释放后再开始事务，最多等待maxDelay
+)
+
+// pendingLockQueries find the tables among the given ones having a pending exclusive metadata lock,
+// i.e. a DDL waiting for the running transactions, which every new transaction would queue behind
+var pendingLockQueries = map[string]string{
+	"mysql": "SELECT DISTINCT OBJECT_NAME FROM performance_schema.metadata_locks " +
+		"WHERE OBJECT_TYPE = 'TABLE' AND OBJECT_SCHEMA = DATABASE() AND LOCK_STATUS = 'PENDING' AND OBJECT_NAME IN ?",
+	"postgres": "SELECT DISTINCT c.relname FROM pg_locks l JOIN pg_class c ON c.oid = l.relation " +
+		"WHERE NOT l.granted AND l.mode = 'AccessExclusiveLock' AND c.relname IN ?",
+}
+
+type metadataLockCheck struct {
+	action       MetadataLockAction
+	maxDelay     time.Duration
+	pollInterval time.Duration
+}
+
+// WithMetadataLockCheck checks the tables declared by WithWriteTables for pending metadata locks (online schema
+// changes waiting for their lock) before beginning a root transaction, so application transactions don't pile
+// up behind the DDL. Supported dialects are mysql (performance_schema must be enabled) and postgres.
+func WithMetadataLockCheck(action MetadataLockAction, maxDelay time.Duration) ManagerOption {
+	return func(m *transactionManager) {
+		m.metadataLockCheck = &metadataLockCheck{
+			action:       action,
+			maxDelay:     maxDelay,
+			pollInterval: 100 * time.Millisecond,
+		}
+	}
+}
+
+// WithWriteTables declares the tables the transaction writes to, they are checked by WithMetadataLockCheck
+func WithWriteTables(tables ...string) TxOption {
+	return txOptionFunc(func(o *txOptions) {
+		o.writeTables = append(o.writeTables, tables...)
+	})
+}
+
+// await applies the metadata lock check before beginning a transaction writing tables on db
+func (c *metadataLockCheck) await(ctx context.Context, clock Clock, db *gorm.DB, tables []string) error {
+	query, ok := pendingLockQueries[db.Dialector.Name()]
+	if !ok {
+		return nil
+	}
+	deadline := clock.Now().Add(c.maxDelay)
+	for {
+		var locked []string
+		if err := db.Raw(query, tables).Scan(&locked).Error; err != nil {
+			// the check is best effort, e.g. performance_schema may be disabled
+			log.Println("[TX] check metadata locks error: ", err)
+			return nil
+		}
+		if len(locked) == 0 {
+			return nil
+		}
+		if c.action == MetadataLockWarn || !clock.Now().Before(deadline) {
+			log.Printf("[TX] pending metadata lock on %v, begin transaction anyway", locked)
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-clock.After(c.pollInterval):
+		}
+	}
+}
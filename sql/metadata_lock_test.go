@@ -0,0 +1,70 @@
+package sql
+
+import (
+	"context"
+	"database/sql/driver"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"propagation-tx/internal/recordingdriver"
+	"strings"
+	"testing"
+	"time"
+)
+
+const checkMetadataLocks = "SELECT DISTINCT OBJECT_NAME FROM performance_schema.metadata_locks " +
+	"WHERE OBJECT_TYPE = 'TABLE' AND OBJECT_SCHEMA = DATABASE() AND LOCK_STATUS = 'PENDING' AND OBJECT_NAME IN (?)"
+
+// pendingMetadataLocks return a recordingdriver.Driver whose first pending checks of the metadata locks find one
+// on the orders table
+func pendingMetadataLocks(pending int) *recordingdriver.Driver {
+	return &recordingdriver.Driver{Results: func(query string) ([]string, [][]driver.Value) {
+		if !strings.HasPrefix(query, "SELECT DISTINCT OBJECT_NAME") || pending == 0 {
+			return []string{"OBJECT_NAME"}, nil
+		}
+		pending--
+		return []string{"OBJECT_NAME"}, [][]driver.Value{{"orders"}}
+	}}
+}
+
+func TestWithMetadataLockCheck(t *testing.T) {
+	write := func(ctx context.Context, tx *gorm.DB) error {
+		return tx.Exec("UPDATE orders SET paid = 1 WHERE id = 1").Error
+	}
+	written := []string{"BEGIN", "UPDATE orders SET paid = 1 WHERE id = 1", "COMMIT"}
+
+	// the transaction waits for the lock to be released
+	d := pendingMetadataLocks(2)
+	clock := newFakeClock()
+	manager := newRecordingManager(t, d, WithClock(clock), WithMetadataLockCheck(MetadataLockDelay, time.Second))
+	done := make(chan error)
+	go func() {
+		done <- manager.Transaction(context.Background(), write, WithWriteTables("orders"))
+	}()
+	clock.WaitForWaiter()
+	assert.Equal(t, []string{checkMetadataLocks}, d.Statements())
+	clock.Advance(100 * time.Millisecond)
+	clock.WaitForWaiter()
+	clock.Advance(100 * time.Millisecond)
+	assert.NoError(t, <-done)
+	assert.Equal(t, append([]string{checkMetadataLocks, checkMetadataLocks, checkMetadataLocks}, written...), d.Statements())
+
+	// up to maxDelay
+	d = pendingMetadataLocks(10)
+	manager = newRecordingManager(t, d, WithClock(clock), WithMetadataLockCheck(MetadataLockDelay, 150*time.Millisecond))
+	go func() {
+		done <- manager.Transaction(context.Background(), write, WithWriteTables("orders"))
+	}()
+	clock.WaitForWaiter()
+	clock.Advance(100 * time.Millisecond)
+	clock.WaitForWaiter()
+	clock.Advance(100 * time.Millisecond)
+	assert.NoError(t, <-done)
+	assert.Equal(t, append([]string{checkMetadataLocks, checkMetadataLocks, checkMetadataLocks}, written...), d.Statements())
+
+	// MetadataLockWarn and the transactions without write tables don't wait
+	d = pendingMetadataLocks(10)
+	manager = newRecordingManager(t, d, WithClock(clock), WithMetadataLockCheck(MetadataLockWarn, time.Second))
+	assert.NoError(t, manager.Transaction(context.Background(), write, WithWriteTables("orders")))
+	assert.NoError(t, manager.Transaction(context.Background(), write))
+	assert.Equal(t, append(append([]string{checkMetadataLocks}, written...), written...), d.Statements())
+}
@@ -0,0 +1,82 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	"gorm.io/gorm"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// NonTxDBFactory is a DBFactory able to give a db that bypasses the ambient transaction on purpose
+type NonTxDBFactory interface {
+	DBFactory
+	// GetNonTxDB return gorm.DB with ctx, always outside of the transaction of ctx (e.g. for logging tables)
+	GetNonTxDB(ctx context.Context) *gorm.DB
+}
+
+// NonTxDBAuditor is notified of every GetNonTxDB call with its caller (file:line),
+// inTransaction tells whether a transaction was actually bypassed
+type NonTxDBAuditor func(ctx context.Context, caller string, inTransaction bool)
+
+var (
+	nonTxDBCount   uint64
+	nonTxDBAuditMu sync.RWMutex
+	nonTxDBAuditor NonTxDBAuditor
+)
+
+// SetNonTxDBAuditor set the auditor of GetNonTxDB calls, nil to disable
+func SetNonTxDBAuditor(auditor NonTxDBAuditor) {
+	nonTxDBAuditMu.Lock()
+	defer nonTxDBAuditMu.Unlock()
+	nonTxDBAuditor = auditor
+}
+
+// NonTxDBCount return the number of GetNonTxDB calls which bypassed a transaction
+func NonTxDBCount() uint64 {
+	return atomic.LoadUint64(&nonTxDBCount)
+}
+
+func (g GlobalCachedDBFactory) GetNonTxDB(ctx context.Context) *gorm.DB {
+	return g.db.WithContext(bypassTransaction(ctx))
+}
+
+func (m *transactionManager) GetNonTxDB(ctx context.Context) *gorm.DB {
+	return m.getPureDB(bypassTransaction(ctx))
+}
+
+// bypassTransaction return ctx without its transaction and records the bypass, it must be called by GetNonTxDB
+func bypassTransaction(ctx context.Context) context.Context {
+	// a RequiresNew transaction keeps the outer transaction in its ctx, all of them are hidden
+	_, inTransaction := currentTransaction(ctx)
+	if inTransaction {
+		ctx = nonTxContext{ctx}
+		atomic.AddUint64(&nonTxDBCount, 1)
+	}
+	nonTxDBAuditMu.RLock()
+	auditor := nonTxDBAuditor
+	nonTxDBAuditMu.RUnlock()
+	if auditor != nil {
+		caller := "unknown"
+		if _, file, line, ok := runtime.Caller(2); ok {
+			caller = fmt.Sprintf("%s:%d", file, line)
+		}
+		auditor(ctx, caller, inTransaction)
+	}
+	return ctx
+}
+
+// nonTxContext is the ctx of a GetNonTxDB db, hiding the transactions of every datasource while keeping the
+// deadline and values of the ctx it wraps
+type nonTxContext struct {
+	context.Context
+}
+
+func (c nonTxContext) Value(key interface{}) interface{} {
+	switch key.(type) {
+	case transactionKey, currentTransactionKey:
+		return nil
+	}
+	return c.Context.Value(key)
+}
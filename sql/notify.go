@@ -0,0 +1,40 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"log"
+)
+
+var ErrNotifyUnsupported = errors.New("NOTIFY is only supported on postgres")
+
+// NotifyTiming is when NotifyAfterCommit sends its notification
+type NotifyTiming int8
+
+const (
+	NotifyOnCommit        NotifyTiming = iota // 在事务中执行NOTIFY，由Postgres在提交时投递，回滚的savepoint中的通知会被丢弃
+	NotifyAfterCompletion                     // 事务提交后在另一个连接上执行NOTIFY
+)
+
+// NotifyAfterCommit sends payload on the Postgres channel once the root transaction of ctx committed, so listeners
+// only see committed changes. The timing is NotifyOnCommit by default; with NotifyAfterCompletion the notification
+// is sent after the commit, a failure is then only logged.
+func NotifyAfterCommit(ctx context.Context, channel, payload string, timing ...NotifyTiming) error {
+	txCtx, ok := currentTransaction(ctx)
+	if !ok {
+		return ErrNoTransaction
+	}
+	if txCtx.tx.Dialector.Name() != "postgres" {
+		return ErrNotifyUnsupported
+	}
+	if len(timing) == 0 || timing[0] == NotifyOnCommit {
+		return txCtx.tx.Exec("SELECT pg_notify(?, ?)", channel, payload).Error
+	}
+	datasource := txCtx.datasource
+	AfterCommit(ctx, func(ctx context.Context) {
+		if err := datasource.Exec("SELECT pg_notify(?, ?)", channel, payload).Error; err != nil {
+			log.Printf("[TX] notify %s after commit error: %v", channel, err)
+		}
+	})
+	return nil
+}
@@ -0,0 +1,85 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var errTransactionPanicked = errors.New("transaction panicked")
+
+// TransactionInfo describes a root transaction to TransactionObserver
+type TransactionInfo struct {
+	// ID is the ID of the transaction given by the IDGenerator of the manager
+	ID string
+	// Name is the name given by WithName, or the function starting the transaction with WithCallerNames
+	Name string
+	// Propagation is the propagation the transaction was started with
+	Propagation TransactionPropagation
+}
+
+// String return the name and the ID of the transaction for the logs
+func (i TransactionInfo) String() string {
+	if i.Name == "" {
+		return i.ID
+	}
+	return i.Name + "(" + i.ID + ")"
+}
+
+// TransactionObserver observes the root transactions of a manager, e.g. to trace or measure them
+type TransactionObserver interface {
+	// TransactionStarted is called before a root transaction begins, the returned ctx becomes the ctx of
+	// the transaction, so values (e.g. spans) put in it are visible to the statements of the transaction
+	TransactionStarted(ctx context.Context, info TransactionInfo) context.Context
+	// TransactionFinished is called with the ctx returned by TransactionStarted once the transaction committed,
+	// or rolled back because of err
+	TransactionFinished(ctx context.Context, info TransactionInfo, err error)
+}
+
+// TransactionTimings are the durations of the phases of a root transaction
+type TransactionTimings struct {
+	// Begin is the time spent beginning the transaction
+	Begin time.Duration
+	// Body is the time spent in bizFn
+	Body time.Duration
+	// Completion is the time spent committing (commit latency of the database), or rolling back
+	Completion time.Duration
+}
+
+// TimingObserver is a TransactionObserver also receiving the TransactionTimings of the root transactions,
+// right before TransactionFinished
+type TimingObserver interface {
+	TransactionObserver
+	TransactionTimed(ctx context.Context, info TransactionInfo, timings TransactionTimings)
+}
+
+// WithObservers registers observers notified of every root transaction of the manager
+func WithObservers(observers ...TransactionObserver) ManagerOption {
+	return func(m *transactionManager) {
+		m.observers = append(m.observers, observers...)
+	}
+}
+
+func (m *transactionManager) transactionStarted(ctx context.Context, info TransactionInfo) context.Context {
+	for _, observer := range m.observers {
+		ctx = observer.TransactionStarted(ctx, info)
+	}
+	return ctx
+}
+
+func (m *transactionManager) transactionTimed(ctx context.Context, info TransactionInfo, timings TransactionTimings) {
+	for _, observer := range m.observers {
+		if timed, ok := observer.(TimingObserver); ok {
+			timed.TransactionTimed(ctx, info, timings)
+		}
+	}
+}
+
+func (m *transactionManager) transactionFinished(ctx context.Context, info TransactionInfo, err error, panicked bool) {
+	if panicked {
+		err = errTransactionPanicked
+	}
+	for i := len(m.observers) - 1; i >= 0; i-- {
+		m.observers[i].TransactionFinished(ctx, info, err)
+	}
+}
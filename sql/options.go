@@ -0,0 +1,279 @@
+package sql
+
+import (
+	stdsql "database/sql"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+// TxOption configures a single Transaction call. A TransactionPropagation is a TxOption as well, so
+// tm.Transaction(ctx, bizFn, PropagationRequiresNew) keeps working alongside the other options.
+//
+// Options about the transaction itself only take effect when the call starts a root transaction,
+// calls joining an ambient transaction inherit its settings.
+type TxOption interface {
+	applyTx(o *txOptions)
+}
+
+type txOptionFunc func(o *txOptions)
+
+func (f txOptionFunc) applyTx(o *txOptions) {
+	f(o)
+}
+
+func (p TransactionPropagation) applyTx(o *txOptions) {
+	o.propagation = p
+}
+
+type txOptions struct {
+	propagation         TransactionPropagation
+	deferConstraints    bool
+	deferredConstraints []string
+	savepointLabel      string
+	writeTables         []string
+	commitToken         *CommitToken
+	isolation           stdsql.IsolationLevel
+	readOnly            bool
+	statementTimeout    time.Duration
+	lockTimeout         time.Duration
+	name                string
+	callsite            string
+	readRetries         int
+	statementBudgets    []statementBudget
+	rollbackRules       []RollbackRule
+	singleStatement     bool
+	session             *gorm.Session
+	alwaysRollback      bool
+}
+
+// newTxOptions return the options of a call, starting from the defaults of the manager
+func (m *transactionManager) newTxOptions(opts []TxOption) *txOptions {
+	o := &txOptions{
+		propagation:      m.defaultPropagation,
+		isolation:        m.txDefaults.isolation,
+		readOnly:         m.txDefaults.readOnly,
+		statementTimeout: m.txDefaults.statementTimeout,
+	}
+	for _, opt := range opts {
+		opt.applyTx(o)
+	}
+	return o
+}
+
+// sqlTxOptions return the options of BeginTx, nil for the defaults of the server
+func (o *txOptions) sqlTxOptions() *stdsql.TxOptions {
+	if o.isolation == stdsql.LevelDefault && !o.readOnly {
+		return nil
+	}
+	return &stdsql.TxOptions{Isolation: o.isolation, ReadOnly: o.readOnly}
+}
+
+// txDefaults are the settings of ConnConfig applied to every transaction of a manager
+type txDefaults struct {
+	isolation          stdsql.IsolationLevel
+	readOnly           bool
+	statementTimeout   time.Duration
+	poolAcquireTimeout time.Duration
+}
+
+var isolationLevels = map[string]stdsql.IsolationLevel{
+	"":                 stdsql.LevelDefault,
+	"READ UNCOMMITTED": stdsql.LevelReadUncommitted,
+	"READ COMMITTED":   stdsql.LevelReadCommitted,
+	"REPEATABLE READ":  stdsql.LevelRepeatableRead,
+	"SERIALIZABLE":     stdsql.LevelSerializable,
+}
+
+// ErrInvalidConnConfig is returned by NewConfigDBFactory for a ConnConfig with invalid transaction settings, and by
+// the transactions of a manager built on a factory providing such a ConnConfig
+var ErrInvalidConnConfig = errors.New("invalid ConnConfig")
+
+// txDefaultsOf return the txDefaults of config, ErrInvalidConnConfig if a setting is invalid
+func txDefaultsOf(config *ConnConfig) (txDefaults, error) {
+	isolation, ok := isolationLevels[strings.ToUpper(strings.TrimSpace(config.TxIsolation))]
+	if !ok {
+		return txDefaults{}, fmt.Errorf("%w: unknown txIsolation %q", ErrInvalidConnConfig, config.TxIsolation)
+	}
+	return txDefaults{
+		isolation:          isolation,
+		readOnly:           config.TxReadOnly,
+		statementTimeout:   time.Duration(config.TxStatementTimeoutSec) * time.Second,
+		poolAcquireTimeout: time.Duration(config.PoolAcquireTimeoutSec) * time.Second,
+	}, nil
+}
+
+// WithIsolation sets the isolation level of the transaction, overriding the TxIsolation of the ConnConfig.
+// Calls joining an ambient transaction keep its isolation level.
+func WithIsolation(level stdsql.IsolationLevel) TxOption {
+	return txOptionFunc(func(o *txOptions) {
+		o.isolation = level
+	})
+}
+
+// WithReadOnly makes the transaction read-only, overriding the TxReadOnly of the ConnConfig
+func WithReadOnly(readOnly bool) TxOption {
+	return txOptionFunc(func(o *txOptions) {
+		o.readOnly = readOnly
+	})
+}
+
+// WithStatementTimeout bounds the execution time of the statements of the transaction, overriding the
+// TxStatementTimeoutSec of the ConnConfig. On MySQL it only applies to SELECT.
+func WithStatementTimeout(timeout time.Duration) TxOption {
+	return txOptionFunc(func(o *txOptions) {
+		o.statementTimeout = timeout
+	})
+}
+
+// WithLockTimeout bounds the wait for a row lock by the statements of the transaction: lock_timeout on Postgres,
+// innodb_lock_wait_timeout (rounded up to the second) on MySQL
+func WithLockTimeout(timeout time.Duration) TxOption {
+	return txOptionFunc(func(o *txOptions) {
+		o.lockTimeout = timeout
+	})
+}
+
+// BeginTxOptions begins the transaction with the options of database/sql, like WithIsolation and WithReadOnly.
+// Only the fields set in opts apply, so the zero ones keep the options given before and the defaults of the
+// ConnConfig. The transaction is begun with db.BeginTx and the ctx of the call, so its deadline bounds the begin
+// as well.
+func BeginTxOptions(opts stdsql.TxOptions) TxOption {
+	return txOptionFunc(func(o *txOptions) {
+		if opts.Isolation != stdsql.LevelDefault {
+			o.isolation = opts.Isolation
+		}
+		if opts.ReadOnly {
+			o.readOnly = true
+		}
+	})
+}
+
+// WithSessionConfig applies the gorm session settings of config (SkipDefaultTransaction, PrepareStmt, Logger,
+// DryRun, QueryFields...) to the tx of the transaction, so bizFn and the calls joining it get them without
+// re-wrapping tx. The Context of config is ignored.
+func WithSessionConfig(config gorm.Session) TxOption {
+	config.Context = nil
+	return txOptionFunc(func(o *txOptions) {
+		o.session = &config
+	})
+}
+
+// WithDeferredConstraints defers the checks of the named constraints, or all deferrable constraints if no name is
+// given, to the commit of the root transaction with SET CONSTRAINTS ... DEFERRED (Postgres), so rows referencing
+// each other can be inserted within one transaction. The constraints must be declared DEFERRABLE.
+func WithDeferredConstraints(names ...string) TxOption {
+	return txOptionFunc(func(o *txOptions) {
+		o.deferConstraints = true
+		o.deferredConstraints = append(o.deferredConstraints, names...)
+	})
+}
+
+// WithSavepointName labels the savepoint of a PropagationNested block, so a later step of the same root
+// transaction can undo it with RollbackToLabel
+func WithSavepointName(label string) TxOption {
+	return txOptionFunc(func(o *txOptions) {
+		o.savepointLabel = label
+	})
+}
+
+// WithForcedPropagation overrides the propagation of every call made inside a transaction of the manager with
+// propagation. It's meant for tests: with PropagationRequired a whole flow runs in the one transaction opened by
+// the test, whose intermediate state can be asserted and rolled back, without changing production code paths.
+func WithForcedPropagation(propagation TransactionPropagation) ManagerOption {
+	return func(m *transactionManager) {
+		m.forcedPropagation = &propagation
+	}
+}
+
+// startRoot prepares a root transaction just begun, before bizFn runs in it
+func (m *transactionManager) startRoot(txCtx *transactionContext, o *txOptions) error {
+	txCtx.validators, txCtx.eventPublisher = m.commitValidators, m.eventPublisher
+	if m.concurrentUseCheck {
+		txCtx.concurrentUse = &concurrentUseGuard{}
+	}
+	if m.beginComment && o.name != "" {
+		if err := commentBegin(txCtx, o.name); err != nil {
+			return err
+		}
+	}
+	if o.statementTimeout > 0 {
+		if err := setStatementTimeout(txCtx, o.statementTimeout); err != nil {
+			return err
+		}
+	}
+	if o.lockTimeout > 0 {
+		if err := setLockTimeout(txCtx, o.lockTimeout); err != nil {
+			return err
+		}
+	}
+	if o.deferConstraints {
+		constraints := "ALL"
+		if len(o.deferredConstraints) > 0 {
+			quoted := make([]string, len(o.deferredConstraints))
+			for i, name := range o.deferredConstraints {
+				quoted[i] = txCtx.tx.Statement.Quote(name)
+			}
+			constraints = strings.Join(quoted, ", ")
+		}
+		if err := txCtx.tx.Exec("SET CONSTRAINTS " + constraints + " DEFERRED").Error; err != nil {
+			return err
+		}
+	}
+	if o.readOnly && m.enforceReadOnly {
+		startReadOnly(txCtx)
+	}
+	if len(o.statementBudgets) > 0 {
+		startStatementBudgets(txCtx, o.statementBudgets)
+	}
+	if o.readOnly && o.readRetries > 0 {
+		startReadRetry(txCtx, o.readRetries)
+	}
+	if m.guardrails != nil {
+		m.startGuardrails(txCtx, o.callsite)
+	}
+	if o.readOnly && m.shadowTraffic != nil {
+		m.startShadow(txCtx)
+	}
+	return m.beginResources(txCtx)
+}
+
+// setStatementTimeout bounds the execution time of the statements of the transaction of txCtx
+func setStatementTimeout(txCtx *transactionContext, timeout time.Duration) error {
+	tx := txCtx.tx
+	switch tx.Dialector.Name() {
+	case "postgres":
+		// SET LOCAL ends with the transaction, SET takes no bind parameters on Postgres
+		return tx.Exec(fmt.Sprintf("SET LOCAL statement_timeout = %d", timeout.Milliseconds())).Error
+	case "mysql":
+		// max_execution_time only applies to SELECT, and is a session variable to restore before the
+		// connection goes back to the pool
+		if err := tx.Exec("SET SESSION max_execution_time = ?", timeout.Milliseconds()).Error; err != nil {
+			return err
+		}
+		txCtx.beforeCompletion = append(txCtx.beforeCompletion, func(tx *gorm.DB) {
+			tx.Exec("SET SESSION max_execution_time = DEFAULT")
+		})
+	}
+	return nil
+}
+
+// setLockTimeout bounds the wait for a row lock by the statements of the transaction of txCtx
+func setLockTimeout(txCtx *transactionContext, timeout time.Duration) error {
+	tx := txCtx.tx
+	switch tx.Dialector.Name() {
+	case "postgres":
+		return tx.Exec(fmt.Sprintf("SET LOCAL lock_timeout = %d", timeout.Milliseconds())).Error
+	case "mysql":
+		seconds := (timeout + time.Second - 1) / time.Second
+		if err := tx.Exec("SET SESSION innodb_lock_wait_timeout = ?", int64(seconds)).Error; err != nil {
+			return err
+		}
+		txCtx.beforeCompletion = append(txCtx.beforeCompletion, func(tx *gorm.DB) {
+			tx.Exec("SET SESSION innodb_lock_wait_timeout = DEFAULT")
+		})
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package sql
+
+import (
+	"context"
+	stdsql "database/sql"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"testing"
+	"time"
+)
+
+// postgresDialector is the mysql dialector named postgres, to check the statements built for Postgres without
+// a server
+type postgresDialector struct {
+	gorm.Dialector
+}
+
+func (postgresDialector) Name() string {
+	return "postgres"
+}
+
+// dryRunDB return a gorm.DB of the dialect named dialect whose raw statements are recorded in statements instead
+// of being executed
+func dryRunDB(t *testing.T, dialect string, statements *[]string) *gorm.DB {
+	var dialector gorm.Dialector = mysql.New(mysql.Config{DSN: "root@tcp(localhost:1)/pt", SkipInitializeWithVersion: true})
+	if dialect == "postgres" {
+		dialector = postgresDialector{dialector}
+	}
+	db, err := gorm.Open(dialector, &gorm.Config{DryRun: true, DisableAutomaticPing: true, Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Callback().Raw().After("gorm:raw").Register("test:record", func(db *gorm.DB) {
+		assert.Empty(t, db.Statement.Vars)
+		*statements = append(*statements, db.Statement.SQL.String())
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// dryRunTransaction return a transactionContext on a dryRunDB
+func dryRunTransaction(t *testing.T, dialect string, statements *[]string) *transactionContext {
+	return &transactionContext{tx: dryRunDB(t, dialect, statements)}
+}
+
+func TestSetLockTimeout(t *testing.T) {
+	var statements []string
+	assert.NoError(t, setLockTimeout(dryRunTransaction(t, "postgres", &statements), 1500*time.Millisecond))
+	assert.Equal(t, []string{"SET LOCAL lock_timeout = 1500"}, statements)
+}
+
+func TestSetStatementTimeout(t *testing.T) {
+	var statements []string
+	assert.NoError(t, setStatementTimeout(dryRunTransaction(t, "postgres", &statements), 2*time.Second))
+	assert.Equal(t, []string{"SET LOCAL statement_timeout = 2000"}, statements)
+}
+
+// connConfigFactory is a DBFactory providing a ConnConfig
+type connConfigFactory struct {
+	db     *gorm.DB
+	config *ConnConfig
+}
+
+func (f connConfigFactory) GetDB(ctx context.Context) *gorm.DB {
+	return f.db.WithContext(ctx)
+}
+
+func (f connConfigFactory) GetOriginDB() *gorm.DB {
+	return f.db
+}
+
+func (f connConfigFactory) ConnConfig() *ConnConfig {
+	return f.config
+}
+
+func TestTxDefaultsOf(t *testing.T) {
+	defaults, err := txDefaultsOf(&ConnConfig{})
+	assert.NoError(t, err)
+	assert.Equal(t, txDefaults{}, defaults)
+
+	defaults, err = txDefaultsOf(&ConnConfig{
+		TxIsolation:           " read committed ",
+		TxReadOnly:            true,
+		TxStatementTimeoutSec: 3,
+		PoolAcquireTimeoutSec: 2,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, txDefaults{
+		isolation:          stdsql.LevelReadCommitted,
+		readOnly:           true,
+		statementTimeout:   3 * time.Second,
+		poolAcquireTimeout: 2 * time.Second,
+	}, defaults)
+
+	_, err = txDefaultsOf(&ConnConfig{TxIsolation: "SNAPSHOT"})
+	assert.ErrorIs(t, err, ErrInvalidConnConfig)
+}
+
+func TestNewTransactionManager_ConnConfig(t *testing.T) {
+	_, err := NewConfigDBFactory(&ConnConfig{Database: "pt", TxIsolation: "SNAPSHOT"})
+	assert.ErrorIs(t, err, ErrInvalidConnConfig)
+
+	var statements []string
+	db := dryRunDB(t, "mysql", &statements)
+	configTm := NewTransactionManager(connConfigFactory{db: db, config: &ConnConfig{TxIsolation: "SERIALIZABLE", TxReadOnly: true}})
+	o := configTm.(*transactionManager).newTxOptions(nil)
+	assert.Equal(t, stdsql.LevelSerializable, o.isolation)
+	assert.True(t, o.readOnly)
+	o = configTm.(*transactionManager).newTxOptions([]TxOption{WithReadOnly(false)})
+	assert.False(t, o.readOnly)
+
+	called := false
+	invalidTm := NewTransactionManager(connConfigFactory{db: db, config: &ConnConfig{TxIsolation: "SNAPSHOT"}})
+	err = invalidTm.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+		called = true
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrInvalidConnConfig)
+	assert.False(t, called)
+}
+
+func TestBeginTxOptions(t *testing.T) {
+	var statements []string
+	configTm := NewTransactionManager(connConfigFactory{db: dryRunDB(t, "mysql", &statements), config: &ConnConfig{TxIsolation: "SERIALIZABLE"}})
+	o := configTm.(*transactionManager).newTxOptions([]TxOption{BeginTxOptions(stdsql.TxOptions{ReadOnly: true})})
+	assert.Equal(t, &stdsql.TxOptions{Isolation: stdsql.LevelSerializable, ReadOnly: true}, o.sqlTxOptions())
+	o = configTm.(*transactionManager).newTxOptions([]TxOption{
+		WithIsolation(stdsql.LevelRepeatableRead), WithReadOnly(true), BeginTxOptions(stdsql.TxOptions{}),
+	})
+	assert.Equal(t, &stdsql.TxOptions{Isolation: stdsql.LevelRepeatableRead, ReadOnly: true}, o.sqlTxOptions())
+	o = configTm.(*transactionManager).newTxOptions([]TxOption{
+		WithIsolation(stdsql.LevelRepeatableRead), BeginTxOptions(stdsql.TxOptions{Isolation: stdsql.LevelReadCommitted}),
+	})
+	assert.Equal(t, &stdsql.TxOptions{Isolation: stdsql.LevelReadCommitted}, o.sqlTxOptions())
+}
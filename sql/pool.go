@@ -0,0 +1,34 @@
+package sql
+
+import (
+	"context"
+	stdsql "database/sql"
+	"errors"
+	"gorm.io/gorm"
+	"time"
+)
+
+var ErrPoolAcquireTimeout = errors.New("timeout acquiring a connection from the pool")
+
+// acquireConn acquires a connection of the pool of db within timeout
+func acquireConn(ctx context.Context, db *gorm.DB, timeout time.Duration) (*stdsql.Conn, error) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	acquireCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	conn, err := sqlDB.Conn(acquireCtx)
+	if err != nil && ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+		return nil, ErrPoolAcquireTimeout
+	}
+	return conn, err
+}
+
+// releaseConn gives the connection of the root transaction c back to the pool once it completed
+func (c *transactionContext) releaseConn() {
+	if c.conn != nil {
+		_ = c.conn.Close()
+		c.conn = nil
+	}
+}
@@ -0,0 +1,65 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrQuotaExceeded is the error for a QuotaChecker to reject a transaction with
+var ErrQuotaExceeded = errors.New("tenant quota exceeded")
+
+// tenantKey is the key of the tenant of a ctx
+type tenantKey struct{}
+
+// WithTenant return a ctx whose transactions are accounted to tenant by the QuotaChecker of the manager
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantOf return the tenant of ctx given by WithTenant
+func TenantOf(ctx context.Context) (string, bool) {
+	tenant, ok := ctx.Value(tenantKey{}).(string)
+	return tenant, ok
+}
+
+// QuotaChecker admits the root transactions of the tenants against their write budgets, protecting a shared
+// database from noisy neighbors
+type QuotaChecker interface {
+	// Admit return how long the transaction of tenant must wait before it begins, or an error rejecting it
+	// (e.g. wrapping ErrQuotaExceeded)
+	Admit(ctx context.Context, tenant string) (time.Duration, error)
+}
+
+// QuotaCheckerFunc is a func implementing QuotaChecker
+type QuotaCheckerFunc func(ctx context.Context, tenant string) (time.Duration, error)
+
+func (f QuotaCheckerFunc) Admit(ctx context.Context, tenant string) (time.Duration, error) {
+	return f(ctx, tenant)
+}
+
+// WithQuotaChecker checks the root transactions of the manager with checker before they begin. Read-only
+// transactions and the ones of a ctx without tenant aren't checked.
+func WithQuotaChecker(checker QuotaChecker) ManagerOption {
+	return func(m *transactionManager) {
+		m.quotaChecker = checker
+	}
+}
+
+// admit waits for the admission of the root transaction of ctx by the QuotaChecker of m
+func (m *transactionManager) admit(ctx context.Context, o *txOptions) error {
+	tenant, ok := TenantOf(ctx)
+	if !ok || o.readOnly {
+		return nil
+	}
+	delay, err := m.quotaChecker.Admit(ctx, tenant)
+	if err != nil || delay <= 0 {
+		return err
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-m.clock.After(delay):
+		return nil
+	}
+}
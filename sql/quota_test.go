@@ -0,0 +1,56 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"propagation-tx/internal/recordingdriver"
+	"testing"
+	"time"
+)
+
+func TestWithQuotaChecker(t *testing.T) {
+	d := &recordingdriver.Driver{}
+	clock := newFakeClock()
+	var admitted []string
+	manager := newRecordingManager(t, d, WithClock(clock), WithQuotaChecker(QuotaCheckerFunc(func(ctx context.Context, tenant string) (time.Duration, error) {
+		admitted = append(admitted, tenant)
+		switch tenant {
+		case "noisy":
+			return 0, fmt.Errorf("%w: %s", ErrQuotaExceeded, tenant)
+		case "throttled":
+			return time.Second, nil
+		}
+		return 0, nil
+	})))
+	write := func(ctx context.Context, tx *gorm.DB) error {
+		return tx.Exec("UPDATE stock SET n = 0 WHERE id = 1").Error
+	}
+
+	assert.ErrorIs(t, manager.Transaction(WithTenant(context.Background(), "noisy"), write), ErrQuotaExceeded)
+	assert.Empty(t, d.Statements())
+	// read-only transactions and the ones without tenant aren't checked
+	assert.NoError(t, manager.Transaction(WithTenant(context.Background(), "noisy"), write, WithReadOnly(true)))
+	assert.NoError(t, manager.Transaction(context.Background(), write))
+	assert.Equal(t, []string{"noisy"}, admitted)
+
+	d.Reset()
+	done := make(chan error)
+	go func() {
+		done <- manager.Transaction(WithTenant(context.Background(), "throttled"), write)
+	}()
+	clock.WaitForWaiter()
+	assert.Empty(t, d.Statements())
+	clock.Advance(time.Second)
+	assert.NoError(t, <-done)
+	assert.Equal(t, []string{"BEGIN", "UPDATE stock SET n = 0 WHERE id = 1", "COMMIT"}, d.Statements())
+
+	// the wait is bounded by the ctx
+	ctx, cancel := context.WithCancel(WithTenant(context.Background(), "throttled"))
+	go func() {
+		clock.WaitForWaiter()
+		cancel()
+	}()
+	assert.ErrorIs(t, manager.Transaction(ctx, write), context.Canceled)
+}
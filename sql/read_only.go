@@ -0,0 +1,81 @@
+package sql
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"log"
+	"strings"
+)
+
+const readOnlyCallbackName = "propagation-tx:read_only"
+
+var ErrWriteInReadOnlyTransaction = errors.New("write statement in read-only transaction")
+
+// readOnlyKey marks a root transaction whose writes are rejected client-side
+type readOnlyKey struct{}
+
+var writeKeywords = []string{"INSERT", "UPDATE", "DELETE", "REPLACE", "MERGE", "UPSERT"}
+
+// WithReadOnlyEnforcement rejects the writes and DDL of the read-only transactions of the manager before they're
+// sent, with ErrWriteInReadOnlyTransaction naming the statement, instead of the late error of the server
+func WithReadOnlyEnforcement() ManagerOption {
+	return func(m *transactionManager) {
+		m.enforceReadOnly = true
+		registerReadOnlyCallbacks(m.GetOriginDB())
+	}
+}
+
+// startReadOnly enables the enforcement of the read-only root transaction txCtx
+func startReadOnly(txCtx *transactionContext) {
+	txCtx.boundValue(readOnlyKey{}, func() interface{} {
+		return true
+	})
+}
+
+func registerReadOnlyCallbacks(db *gorm.DB) {
+	callbacks := db.Callback()
+	if callbacks.Raw().Get(readOnlyCallbackName) != nil {
+		return
+	}
+	for _, err := range []error{
+		callbacks.Create().Before("*").Register(readOnlyCallbackName, rejectWrite("INSERT")),
+		callbacks.Update().Before("*").Register(readOnlyCallbackName, rejectWrite("UPDATE")),
+		callbacks.Delete().Before("*").Register(readOnlyCallbackName, rejectWrite("DELETE")),
+		callbacks.Raw().Before("*").Register(readOnlyCallbackName, rejectRawWrite),
+	} {
+		if err != nil {
+			log.Println("[TX] register read-only callback error: ", err)
+		}
+	}
+}
+
+func inReadOnlyTransaction(db *gorm.DB) bool {
+	root := transactionRootOf(db)
+	return root != nil && root.values[readOnlyKey{}] == true
+}
+
+func rejectWrite(kind string) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		if db.Error == nil && inReadOnlyTransaction(db) {
+			_ = db.AddError(fmt.Errorf("%w: %s %s", ErrWriteInReadOnlyTransaction, kind, db.Statement.Table))
+		}
+	}
+}
+
+func rejectRawWrite(db *gorm.DB) {
+	if db.Error != nil || !inReadOnlyTransaction(db) {
+		return
+	}
+	sql := strings.TrimSpace(db.Statement.SQL.String())
+	upper := strings.ToUpper(sql)
+	for _, keyword := range writeKeywords {
+		if strings.HasPrefix(upper, keyword) {
+			_ = db.AddError(fmt.Errorf("%w: %s", ErrWriteInReadOnlyTransaction, sql))
+			return
+		}
+	}
+	if isDDL(sql) {
+		_ = db.AddError(fmt.Errorf("%w: %s", ErrWriteInReadOnlyTransaction, sql))
+	}
+}
@@ -0,0 +1,80 @@
+package sql
+
+import (
+	"database/sql/driver"
+	"errors"
+	"gorm.io/gorm"
+	"io"
+	"log"
+	"strings"
+	"syscall"
+)
+
+const readRetryCallbackName = "propagation-tx:read_retry"
+
+// readRetryKey is the key of the number of retries of the reads of a root transaction
+type readRetryKey struct{}
+
+// WithReadRetry retries up to attempts times the reads of a read-only transaction failing because of a broken
+// connection (connection reset, replica restart). Retries run on another connection of the datasource pool,
+// outside of the transaction, so they don't see its snapshot: only use it where that's acceptable, e.g. reports.
+// It has no effect on transactions that aren't read-only.
+func WithReadRetry(attempts int) TxOption {
+	return txOptionFunc(func(o *txOptions) {
+		o.readRetries = attempts
+	})
+}
+
+// startReadRetry enables the retry of the reads of the root transaction txCtx
+func startReadRetry(txCtx *transactionContext, attempts int) {
+	txCtx.boundValue(readRetryKey{}, func() interface{} {
+		return attempts
+	})
+}
+
+// registerReadRetryCallbacks retries the broken reads of the transactions of the datasource which enabled it,
+// registered with the manager
+func registerReadRetryCallbacks(db *gorm.DB) {
+	callbacks := db.Callback()
+	if callbacks.Query().Get(readRetryCallbackName) != nil {
+		return
+	}
+	query, row := callbacks.Query().Get("gorm:query"), callbacks.Row().Get("gorm:row")
+	for _, err := range []error{
+		callbacks.Query().After("gorm:query").Register(readRetryCallbackName, retryRead(query)),
+		callbacks.Row().After("gorm:row").Register(readRetryCallbackName, retryRead(row)),
+	} {
+		if err != nil {
+			log.Println("[TX] register read retry callback error: ", err)
+		}
+	}
+}
+
+// retryRead return a callback running read again when it failed on a broken connection
+func retryRead(read func(db *gorm.DB)) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		if read == nil || db.Error == nil || !isBrokenConn(db.Error) {
+			return
+		}
+		txCtx, ok := currentTransaction(db.Statement.Context)
+		if !ok {
+			return
+		}
+		attempts, _ := txCtx.root().values[readRetryKey{}].(int)
+		for i := 0; i < attempts && db.Error != nil && isBrokenConn(db.Error); i++ {
+			log.Printf("[TX] retry read %d/%d after error: %v", i+1, attempts, db.Error)
+			db.Error = nil
+			db.Statement.ConnPool = txCtx.datasource.Statement.ConnPool
+			read(db)
+		}
+	}
+}
+
+func isBrokenConn(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	// go-sql-driver/mysql ErrInvalidConn
+	return strings.Contains(err.Error(), "invalid connection")
+}
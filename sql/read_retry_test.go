@@ -0,0 +1,30 @@
+package sql
+
+import (
+	"context"
+	"database/sql/driver"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"propagation-tx/internal/recordingdriver"
+	"testing"
+)
+
+func TestWithReadRetry(t *testing.T) {
+	d := &recordingdriver.Driver{BrokenReads: 1}
+	manager := newRecordingManager(t, d)
+	err := manager.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+		var users []User
+		return tx.Find(&users).Error
+	}, WithReadOnly(true), WithReadRetry(1))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"BEGIN", "SELECT * FROM `user`", "SELECT * FROM `user`", "COMMIT"}, d.Statements())
+
+	// database/sql tries a few connections of the pool itself before giving up
+	d = &recordingdriver.Driver{BrokenReads: 10}
+	manager = newRecordingManager(t, d)
+	err = manager.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+		var users []User
+		return tx.Find(&users).Error
+	}, WithReadOnly(true), WithReadRetry(1))
+	assert.ErrorIs(t, err, driver.ErrBadConn)
+}
@@ -0,0 +1,21 @@
+package sql
+
+import (
+	"gorm.io/gorm"
+	"propagation-tx/internal/recordingdriver"
+	"testing"
+)
+
+// newRecordingDB return a *gorm.DB of the mysql dialect on d
+func newRecordingDB(t *testing.T, d *recordingdriver.Driver) *gorm.DB {
+	recordingDB, err := recordingdriver.OpenGorm(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return recordingDB
+}
+
+// newRecordingManager return a TransactionManager of the mysql dialect on d
+func newRecordingManager(t *testing.T, d *recordingdriver.Driver, opts ...ManagerOption) TransactionManager {
+	return NewTransactionManager(sessionFactory{db: newRecordingDB(t, d)}, opts...)
+}
@@ -0,0 +1,162 @@
+package sql
+
+import (
+	"context"
+)
+
+// ResourceManager is a transactional resource other than the gorm datasource (e.g. a MongoDB client,
+// an embedded KV store or a message staging buffer) that takes part in the propagation lifecycle of the
+// transactions of a TransactionManager.
+//
+// The manager drives it as follows:
+//   - Begin is called when a root transaction starts (Required without ambient transaction, RequiresNew)
+//   - Commit or Rollback of the returned ResourceTransaction is called when the root transaction completes
+//   - Savepoint and RollbackTo are called around PropagationNested blocks if the ResourceTransaction
+//     implements SavepointResourceTransaction
+//   - Suspend and Resume are called around RequiresNew and NotSupported blocks if the ResourceTransaction
+//     implements SuspendableResourceTransaction
+//
+// ResourceManager is used as the lookup key of ResourceTx, so implementations must be comparable (e.g. pointers).
+type ResourceManager interface {
+	// Begin starts a transaction on the resource
+	Begin(ctx context.Context) (ResourceTransaction, error)
+}
+
+// ResourceTransaction is the transaction of a ResourceManager inside a root transaction.
+//
+// Atomicity is per resource: the gorm transaction is committed first, then every ResourceTransaction
+// in the order its ResourceManager was registered. A resource failing to commit can't undo the commits of
+// the gorm transaction and the resources committed before it.
+type ResourceTransaction interface {
+	// Commit commits the transaction of the resource
+	Commit(ctx context.Context) error
+	// Rollback aborts the transaction of the resource
+	Rollback(ctx context.Context) error
+}
+
+// SavepointResourceTransaction is a ResourceTransaction supporting partial rollback of PropagationNested blocks.
+// Without it the changes of a failed nested block stay in the resource transaction.
+type SavepointResourceTransaction interface {
+	ResourceTransaction
+	// Savepoint marks a savepoint with name before a nested block
+	Savepoint(ctx context.Context, name string) error
+	// RollbackTo undoes the changes made after the savepoint with name
+	RollbackTo(ctx context.Context, name string) error
+}
+
+// SuspendableResourceTransaction is a ResourceTransaction which must be detached while a block runs outside of
+// its transaction, i.e. PropagationRequiresNew and PropagationNotSupported
+type SuspendableResourceTransaction interface {
+	ResourceTransaction
+	// Suspend detaches the transaction before the block
+	Suspend(ctx context.Context) error
+	// Resume reattaches the transaction after the block
+	Resume(ctx context.Context) error
+}
+
+type enlistedResource struct {
+	manager ResourceManager
+	tx      ResourceTransaction
+}
+
+// WithResources enlists resources in every root transaction started by the manager.
+// Joining propagations share the ResourceTransaction of the root transaction, RequiresNew begins new ones
+// and NotSupported/Never run without them.
+func WithResources(resources ...ResourceManager) ManagerOption {
+	return func(m *transactionManager) {
+		m.resources = append(m.resources, resources...)
+	}
+}
+
+// ResourceTx return the ResourceTransaction of resource enlisted in the transaction of ctx,
+// nil if ctx is not in transaction or resource isn't enlisted
+func ResourceTx(ctx context.Context, resource ResourceManager) ResourceTransaction {
+	txCtx, ok := currentTransaction(ctx)
+	if !ok {
+		return nil
+	}
+	for _, r := range txCtx.root().resources {
+		if r.manager == resource {
+			return r.tx
+		}
+	}
+	return nil
+}
+
+func (m *transactionManager) beginResources(txCtx *transactionContext) error {
+	for _, resource := range m.resources {
+		tx, err := resource.Begin(txCtx.ctx)
+		if err != nil {
+			return err
+		}
+		txCtx.resources = append(txCtx.resources, enlistedResource{manager: resource, tx: tx})
+	}
+	return nil
+}
+
+func (c *transactionContext) commitResources() error {
+	for len(c.resources) > 0 {
+		r := c.resources[0]
+		c.resources = c.resources[1:]
+		if err := r.tx.Commit(c.ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *transactionContext) rollbackResources() {
+	for _, r := range c.resources {
+		_ = r.tx.Rollback(c.ctx)
+	}
+	c.resources = nil
+}
+
+func (c *transactionContext) savepointResources(name string) error {
+	for _, r := range c.root().resources {
+		if sp, ok := r.tx.(SavepointResourceTransaction); ok {
+			if err := sp.Savepoint(c.ctx, name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *transactionContext) rollbackResourcesTo(name string) {
+	for _, r := range c.root().resources {
+		if sp, ok := r.tx.(SavepointResourceTransaction); ok {
+			_ = sp.RollbackTo(c.ctx, name)
+		}
+	}
+}
+
+func (c *transactionContext) suspendResources() error {
+	resources := c.root().resources
+	for i, r := range resources {
+		if s, ok := r.tx.(SuspendableResourceTransaction); ok {
+			if err := s.Suspend(c.ctx); err != nil {
+				// resume the ones already suspended, the block won't run
+				_ = resumeResources(c.ctx, resources[:i])
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *transactionContext) resumeResources() error {
+	return resumeResources(c.ctx, c.root().resources)
+}
+
+func resumeResources(ctx context.Context, resources []enlistedResource) error {
+	var err error
+	for _, r := range resources {
+		if s, ok := r.tx.(SuspendableResourceTransaction); ok {
+			if resumeErr := s.Resume(ctx); resumeErr != nil && err == nil {
+				err = resumeErr
+			}
+		}
+	}
+	return err
+}
@@ -0,0 +1,25 @@
+package sql
+
+import (
+	"context"
+)
+
+// WithRollbackFailureHandler registers handler called with the error of every failed rollback of a root
+// transaction, panicking ones included, so they can be alerted on
+func WithRollbackFailureHandler(handler func(ctx context.Context, info TransactionInfo, err error)) ManagerOption {
+	return func(m *transactionManager) {
+		m.rollbackFailureHandler = handler
+	}
+}
+
+// rollbackFailed reports rollbackErr of the transaction failing with err, it return the error of the transaction
+func (m *transactionManager) rollbackFailed(ctx context.Context, info TransactionInfo, err, rollbackErr error) error {
+	if m.rollbackFailureHandler != nil {
+		m.rollbackFailureHandler(ctx, info, rollbackErr)
+	}
+	if err == nil {
+		// panicking, the panic goes on
+		return nil
+	}
+	return &RollbackError{Name: info.Name, Cause: rollbackErr, Original: err}
+}
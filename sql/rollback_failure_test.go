@@ -0,0 +1,36 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"propagation-tx/internal/recordingdriver"
+	"testing"
+)
+
+func TestWithRollbackFailureHandler(t *testing.T) {
+	rollbackErr := errors.New("connection lost")
+	var reported []error
+	manager := newRecordingManager(t, &recordingdriver.Driver{RollbackErr: rollbackErr},
+		WithRollbackFailureHandler(func(ctx context.Context, info TransactionInfo, err error) {
+			reported = append(reported, err)
+		}))
+
+	err := manager.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+		return mockErr
+	})
+	var rollbackError *RollbackError
+	assert.ErrorAs(t, err, &rollbackError)
+	assert.ErrorIs(t, err, mockErr)
+	assert.ErrorIs(t, err, rollbackErr)
+	assert.Len(t, reported, 1)
+	assert.ErrorIs(t, reported[0], rollbackErr)
+
+	assert.PanicsWithValue(t, "boom", func() {
+		_ = manager.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+			panic("boom")
+		})
+	})
+	assert.Len(t, reported, 2)
+}
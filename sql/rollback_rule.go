@@ -0,0 +1,57 @@
+package sql
+
+import "errors"
+
+// ErrorMatcher tells whether err belongs to a class of errors
+type ErrorMatcher func(err error) bool
+
+// ErrorIs matches the errors wrapping target
+func ErrorIs(target error) ErrorMatcher {
+	return func(err error) bool {
+		return errors.Is(err, target)
+	}
+}
+
+// RollbackRule decides whether an error returned by bizFn rolls back the transaction (or the savepoint of a
+// PropagationNested call) it owns. Without matching rule every error rolls back, panics always do.
+//
+// A RollbackRule is a TxOption, per-call rules are evaluated before the ones of the manager (WithRollbackRules)
+// and the first matching rule wins. Calls joining an ambient transaction return their error to the owner of the
+// transaction, which applies its own rules.
+type RollbackRule struct {
+	matcher  ErrorMatcher
+	rollback bool
+}
+
+func (r RollbackRule) applyTx(o *txOptions) {
+	o.rollbackRules = append(o.rollbackRules, r)
+}
+
+// RollbackFor rolls back on the errors matched by matcher, e.g. to carve exceptions out of a broader NoRollbackFor
+func RollbackFor(matcher ErrorMatcher) RollbackRule {
+	return RollbackRule{matcher: matcher, rollback: true}
+}
+
+// NoRollbackFor commits on the errors matched by matcher, e.g. business warnings, the error is still returned
+func NoRollbackFor(matcher ErrorMatcher) RollbackRule {
+	return RollbackRule{matcher: matcher}
+}
+
+// WithRollbackRules sets the rollback rules of every transaction of the manager
+func WithRollbackRules(rules ...RollbackRule) ManagerOption {
+	return func(m *transactionManager) {
+		m.rollbackRules = append(m.rollbackRules, rules...)
+	}
+}
+
+// rollsBack tells whether err of bizFn rolls back according to the rules of the call and of m
+func (m *transactionManager) rollsBack(o *txOptions, err error) bool {
+	for _, rules := range [][]RollbackRule{o.rollbackRules, m.rollbackRules} {
+		for _, rule := range rules {
+			if rule.matcher(err) {
+				return rule.rollback
+			}
+		}
+	}
+	return true
+}
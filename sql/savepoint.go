@@ -0,0 +1,116 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrSavepointLabelNotFound = errors.New("no savepoint with the label in transaction")
+	ErrSavepointsDisabled     = errors.New("savepoints disabled")
+)
+
+// SavepointNamer names the savepoints of the root transaction with id, seq counts its savepoints from 1.
+// Names must be unique within the transaction and valid SQL identifiers.
+type SavepointNamer interface {
+	SavepointName(txID string, seq int) string
+}
+
+// SavepointNamerFunc is a func implementing SavepointNamer
+type SavepointNamerFunc func(txID string, seq int) string
+
+func (f SavepointNamerFunc) SavepointName(txID string, seq int) string {
+	return f(txID, seq)
+}
+
+// sequentialSavepoints names the savepoints sp1, sp2...
+type sequentialSavepoints struct{}
+
+func (sequentialSavepoints) SavepointName(_ string, seq int) string {
+	return fmt.Sprintf("sp%d", seq)
+}
+
+// WithSavepointNamer replaces the naming of the savepoints, sp1, sp2... by default
+func WithSavepointNamer(namer SavepointNamer) ManagerOption {
+	return func(m *transactionManager) {
+		m.savepointNamer = namer
+	}
+}
+
+// WithSavepointRelease controls whether the savepoint of a PropagationNested block is released once the block
+// succeeded, true by default so long transactions don't pile up savepoints. Savepoints labeled by WithSavepointName
+// are kept anyway, and dialects without RELEASE SAVEPOINT (SQL Server) never release them.
+func WithSavepointRelease(release bool) ManagerOption {
+	return func(m *transactionManager) {
+		m.keepSavepoints = !release
+	}
+}
+
+// WithSavepointsDisabled never creates savepoints, like gorm.Config.DisableNestedTransaction: PropagationNested
+// joins the enclosing transaction like PropagationRequired, and Txn.Savepoint fails with ErrSavepointsDisabled.
+// For the backends rejecting SAVEPOINT, e.g. some MySQL proxies.
+func WithSavepointsDisabled() ManagerOption {
+	return func(m *transactionManager) {
+		m.savepointsDisabled = true
+	}
+}
+
+// savepointsEnabled tells whether the PropagationNested blocks of tm run in savepoints rather than joining the
+// enclosing transaction
+func savepointsEnabled(tm TransactionManager) bool {
+	m, ok := tm.(*transactionManager)
+	return !ok || !m.savepointsDisabled && !m.GetOriginDB().DisableNestedTransaction
+}
+
+// nextSavepoint return the name of the next savepoint of the root transaction of txCtx
+func (m *transactionManager) nextSavepoint(txCtx *transactionContext) string {
+	root := txCtx.root()
+	root.savepointSeq++
+	return m.savepointNamer.SavepointName(root.id, root.savepointSeq)
+}
+
+type labeledSavepoint struct {
+	label           string
+	savepoint       string
+	afterCommitMark int
+}
+
+// RollbackToLabel rolls the transaction of ctx back to the savepoint labeled by WithSavepointName, undoing the
+// labeled block and everything executed after it. Labels of blocks started after it are dropped, the label
+// itself stays valid. The latest block is used if several share the label.
+func RollbackToLabel(ctx context.Context, label string) error {
+	txCtx, ok := currentTransaction(ctx)
+	if !ok {
+		return ErrNoTransaction
+	}
+	root := txCtx.root()
+	for i := len(root.labels) - 1; i >= 0; i-- {
+		if sp := root.labels[i]; sp.label == label {
+			if err := savepointDialectOf(txCtx.tx).RollbackTo(txCtx.tx, sp.savepoint); err != nil {
+				return err
+			}
+			txCtx.rollbackResourcesTo(sp.savepoint)
+			txCtx.discardAfterCommit(sp.afterCommitMark)
+			txCtx.discardLabels(i + 1)
+			return nil
+		}
+	}
+	return ErrSavepointLabelNotFound
+}
+
+func (c *transactionContext) labelSavepoint(label, savepoint string) {
+	root := c.root()
+	root.labels = append(root.labels, labeledSavepoint{
+		label:           label,
+		savepoint:       savepoint,
+		afterCommitMark: len(root.afterCommit),
+	})
+}
+
+func (c *transactionContext) discardLabels(mark int) {
+	root := c.root()
+	if mark < len(root.labels) {
+		root.labels = root.labels[:mark]
+	}
+}
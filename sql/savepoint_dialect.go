@@ -0,0 +1,94 @@
+package sql
+
+import (
+	"gorm.io/gorm"
+	"sync"
+)
+
+// SavepointDialect is the savepoint syntax of a database, used by PropagationNested and RollbackToLabel
+type SavepointDialect interface {
+	// Savepoint marks a savepoint with name in tx
+	Savepoint(tx *gorm.DB, name string) error
+	// RollbackTo undoes the changes of tx made after the savepoint with name
+	RollbackTo(tx *gorm.DB, name string) error
+	// Release drops the savepoint with name once its block succeeded, it's a no-op on databases without release
+	Release(tx *gorm.DB, name string) error
+}
+
+var (
+	savepointDialectsMu sync.RWMutex
+	savepointDialects   = map[string]SavepointDialect{
+		"mysql":     standardSavepoints{release: true},
+		"postgres":  standardSavepoints{release: true},
+		"sqlite":    standardSavepoints{release: true},
+		"sqlserver": sqlServerSavepoints{},
+		"oracle":    standardSavepoints{},
+	}
+)
+
+// RegisterSavepointDialect registers the SavepointDialect of the gorm dialector with name (gorm.Dialector.Name()),
+// dialectors without one use the savepoint support of gorm without release
+func RegisterSavepointDialect(name string, dialect SavepointDialect) {
+	savepointDialectsMu.Lock()
+	defer savepointDialectsMu.Unlock()
+	savepointDialects[name] = dialect
+}
+
+func savepointDialectOf(tx *gorm.DB) SavepointDialect {
+	savepointDialectsMu.RLock()
+	defer savepointDialectsMu.RUnlock()
+	if dialect, ok := savepointDialects[tx.Dialector.Name()]; ok {
+		return dialect
+	}
+	return gormSavepoints{}
+}
+
+// standardSavepoints is the SQL standard SAVEPOINT / ROLLBACK TO SAVEPOINT / RELEASE SAVEPOINT
+type standardSavepoints struct {
+	release bool
+}
+
+func (d standardSavepoints) Savepoint(tx *gorm.DB, name string) error {
+	return tx.Exec("SAVEPOINT " + name).Error
+}
+
+func (d standardSavepoints) RollbackTo(tx *gorm.DB, name string) error {
+	return tx.Exec("ROLLBACK TO SAVEPOINT " + name).Error
+}
+
+func (d standardSavepoints) Release(tx *gorm.DB, name string) error {
+	if !d.release {
+		return nil
+	}
+	return tx.Exec("RELEASE SAVEPOINT " + name).Error
+}
+
+// sqlServerSavepoints is SAVE TRANSACTION / ROLLBACK TRANSACTION, SQL Server has no release
+type sqlServerSavepoints struct{}
+
+func (d sqlServerSavepoints) Savepoint(tx *gorm.DB, name string) error {
+	return tx.Exec("SAVE TRANSACTION " + name).Error
+}
+
+func (d sqlServerSavepoints) RollbackTo(tx *gorm.DB, name string) error {
+	return tx.Exec("ROLLBACK TRANSACTION " + name).Error
+}
+
+func (d sqlServerSavepoints) Release(*gorm.DB, string) error {
+	return nil
+}
+
+// gormSavepoints delegates to the gorm.SavePointerDialectorInterface of the dialector
+type gormSavepoints struct{}
+
+func (d gormSavepoints) Savepoint(tx *gorm.DB, name string) error {
+	return tx.SavePoint(name).Error
+}
+
+func (d gormSavepoints) RollbackTo(tx *gorm.DB, name string) error {
+	return tx.RollbackTo(name).Error
+}
+
+func (d gormSavepoints) Release(*gorm.DB, string) error {
+	return nil
+}
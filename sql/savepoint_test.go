@@ -0,0 +1,115 @@
+package sql
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"propagation-tx/internal/recordingdriver"
+	"strings"
+	"testing"
+)
+
+func TestRollbackToLabel(t *testing.T) {
+	var err error
+	DefaultTransactionTest("test-undo-labeled-step", t, func() {
+		err = tm.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+			tx.Create(user1)
+			_ = tm.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+				tx.Create(user2)
+				return nil
+			}, PropagationNested, WithSavepointName("pricing"))
+			tx.Create(user3)
+			if err := RollbackToLabel(ctx, "pricing"); err != nil {
+				return err
+			}
+			tx.Create(user4)
+			return nil
+		}, PropagationRequired)
+	}, func(t *testing.T) {
+		assert.Nil(t, err)
+		AssertExist(t, user1)
+		AssertNotExist(t, user2)
+		AssertNotExist(t, user3)
+		AssertExist(t, user4)
+	})
+
+	DefaultTransactionTest("test-unknown-label", t, func() {
+		err = tm.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+			tx.Create(user1)
+			return RollbackToLabel(ctx, "pricing")
+		}, PropagationRequired)
+	}, func(t *testing.T) {
+		assert.Equal(t, ErrSavepointLabelNotFound, err)
+		AssertNotExist(t, user1)
+	})
+}
+
+// nestedCreator creates one of its users per call of its Create method value, each call nesting the next one in
+// PropagationNested and failing after it
+type nestedCreator struct {
+	tm    TransactionManager
+	users []*User
+	calls int
+}
+
+func (c *nestedCreator) Create(ctx context.Context, tx *gorm.DB) error {
+	user := c.users[c.calls]
+	c.calls++
+	tx.Create(user)
+	if c.calls < len(c.users) {
+		_ = c.tm.Transaction(ctx, c.Create, PropagationNested)
+	}
+	return mockErr
+}
+
+func TestSavepointNaming(t *testing.T) {
+	DefaultTransactionTest("test-same-method-value-nested", t, func() {
+		creator := &nestedCreator{tm: tm, users: []*User{user2, user3}}
+		_ = tm.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+			tx.Create(user1)
+			_ = tm.Transaction(ctx, creator.Create, PropagationNested)
+			return nil
+		}, PropagationRequired)
+	}, func(t *testing.T) {
+		AssertExist(t, user1)
+		AssertNotExist(t, user2)
+		AssertNotExist(t, user3)
+	})
+}
+
+func TestSavepointNaming_Statements(t *testing.T) {
+	d := &recordingdriver.Driver{}
+	manager := newRecordingManager(t, d)
+	creator := &nestedCreator{tm: manager, users: []*User{user2, user3}}
+	_ = manager.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+		return manager.Transaction(ctx, creator.Create, PropagationNested)
+	})
+	var savepoints []string
+	for _, statement := range d.Statements() {
+		if strings.Contains(statement, "SAVEPOINT") {
+			savepoints = append(savepoints, statement)
+		}
+	}
+	assert.Equal(t, []string{"SAVEPOINT sp1", "SAVEPOINT sp2", "ROLLBACK TO SAVEPOINT sp2", "ROLLBACK TO SAVEPOINT sp1"}, savepoints)
+}
+
+func TestSavepointRelease(t *testing.T) {
+	savepointStatements := func(opts ...ManagerOption) []string {
+		d := &recordingdriver.Driver{}
+		manager := newRecordingManager(t, d, opts...)
+		assert.NoError(t, manager.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+			return manager.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+				return nil
+			}, PropagationNested)
+		}))
+		var statements []string
+		for _, statement := range d.Statements() {
+			if strings.Contains(statement, "SAVEPOINT") {
+				statements = append(statements, statement)
+			}
+		}
+		return statements
+	}
+	assert.Equal(t, []string{"SAVEPOINT sp1", "RELEASE SAVEPOINT sp1"}, savepointStatements())
+	assert.Equal(t, []string{"SAVEPOINT sp1"}, savepointStatements(WithSavepointRelease(false)))
+}
@@ -0,0 +1,71 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"sync"
+	"time"
+)
+
+var ErrSchemaVersionMismatch = errors.New("schema version mismatch")
+
+// SchemaVersionFunc return the current schema migration version of db, db is already bound to ctx
+type SchemaVersionFunc func(ctx context.Context, db *gorm.DB) (string, error)
+
+// MigrateSchemaVersion reads the version of the schema_migrations table of golang-migrate,
+// a dirty version (failed migration) is reported with a "dirty:" prefix so it never matches
+func MigrateSchemaVersion(_ context.Context, db *gorm.DB) (string, error) {
+	var row struct {
+		Version int64
+		Dirty   bool
+	}
+	if err := db.Raw("SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&row).Error; err != nil {
+		return "", err
+	}
+	if row.Dirty {
+		return fmt.Sprintf("dirty:%d", row.Version), nil
+	}
+	return fmt.Sprint(row.Version), nil
+}
+
+type schemaVersionGuard struct {
+	expected  string
+	versionFn SchemaVersionFunc
+	interval  time.Duration
+
+	mu        sync.Mutex
+	version   string
+	checkedAt time.Time
+}
+
+// WithSchemaVersionGuard fails root transactions with ErrSchemaVersionMismatch when the schema version of the
+// datasource given by versionFn isn't expected, so a binary deployed against another schema stops writing.
+// The version is cached and read again after interval.
+func WithSchemaVersionGuard(expected string, versionFn SchemaVersionFunc, interval time.Duration) ManagerOption {
+	return func(m *transactionManager) {
+		m.schemaVersionGuard = &schemaVersionGuard{
+			expected:  expected,
+			versionFn: versionFn,
+			interval:  interval,
+		}
+	}
+}
+
+// check verifies the schema version of db before beginning a transaction
+func (g *schemaVersionGuard) check(ctx context.Context, clock Clock, db *gorm.DB) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.checkedAt.IsZero() || clock.Now().Sub(g.checkedAt) >= g.interval {
+		version, err := g.versionFn(ctx, db)
+		if err != nil {
+			return err
+		}
+		g.version, g.checkedAt = version, clock.Now()
+	}
+	if g.version != g.expected {
+		return fmt.Errorf("%w: expected %s, found %s", ErrSchemaVersionMismatch, g.expected, g.version)
+	}
+	return nil
+}
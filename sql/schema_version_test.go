@@ -0,0 +1,36 @@
+package sql
+
+import (
+	"context"
+	"database/sql/driver"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"propagation-tx/internal/recordingdriver"
+	"testing"
+	"time"
+)
+
+func TestWithSchemaVersionGuard(t *testing.T) {
+	migration := []driver.Value{int64(7), false}
+	d := &recordingdriver.Driver{Results: func(query string) ([]string, [][]driver.Value) {
+		return []string{"version", "dirty"}, [][]driver.Value{migration}
+	}}
+	clock := newFakeClock()
+	manager := newRecordingManager(t, d, WithClock(clock), WithSchemaVersionGuard("7", MigrateSchemaVersion, time.Minute))
+	noop := func(ctx context.Context, tx *gorm.DB) error {
+		return nil
+	}
+
+	assert.NoError(t, manager.Transaction(context.Background(), noop))
+	// the version is cached for the interval
+	migration = []driver.Value{int64(7), true}
+	assert.NoError(t, manager.Transaction(context.Background(), noop))
+	assert.Equal(t, []string{"SELECT version, dirty FROM schema_migrations LIMIT 1", "BEGIN", "COMMIT", "BEGIN", "COMMIT"}, d.Statements())
+
+	d.Reset()
+	clock.Advance(time.Minute)
+	err := manager.Transaction(context.Background(), noop)
+	assert.ErrorIs(t, err, ErrSchemaVersionMismatch)
+	assert.EqualError(t, err, "schema version mismatch: expected 7, found dirty:7")
+	assert.Equal(t, []string{"SELECT version, dirty FROM schema_migrations LIMIT 1"}, d.Statements())
+}
@@ -0,0 +1,42 @@
+package sql
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// Scoped return tm.GetDB(ctx) with scopes applied, so the query runs in the transaction of ctx if any.
+// Build scopes with it rather than on GetOriginDB, which always runs outside of the transaction.
+func Scoped(ctx context.Context, tm TransactionManager, scopes ...func(db *gorm.DB) *gorm.DB) *gorm.DB {
+	return tm.GetDB(ctx).Scopes(scopes...)
+}
+
+// TenantScope restricts the query to the rows of tenantID in column
+func TenantScope(column string, tenantID interface{}) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(clause.Eq{Column: clause.Column{Name: column}, Value: tenantID})
+	}
+}
+
+// NotDeletedScope restricts the query to the rows whose soft-delete column is NULL, for tables not using
+// gorm.DeletedAt
+func NotDeletedScope(column string) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(clause.Eq{Column: clause.Column{Name: column}, Value: nil})
+	}
+}
+
+// TimeRangeScope restricts the query to the rows whose column is in [from, to), a zero bound is unbounded
+func TimeRangeScope(column string, from, to time.Time) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if !from.IsZero() {
+			db = db.Where(clause.Gte{Column: clause.Column{Name: column}, Value: from})
+		}
+		if !to.IsZero() {
+			db = db.Where(clause.Lt{Column: clause.Column{Name: column}, Value: to})
+		}
+		return db
+	}
+}
@@ -0,0 +1,159 @@
+package sql
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+	"log"
+	"math/rand"
+	"reflect"
+)
+
+const shadowCallbackName = "propagation-tx:shadow"
+
+// ShadowTraffic duplicates read-only transactions against a mirror datasource, e.g. to validate a new database
+// engine or index changes under real traffic. The queries of a sampled transaction are replayed asynchronously on
+// the shadow once it committed, and the digests of their results are compared.
+type ShadowTraffic struct {
+	// Shadow is the mirror datasource, it must hold the same data as the primary
+	Shadow DBFactory
+	// SampleRate is the fraction of the read-only root transactions duplicated, from 0 to 1
+	SampleRate float64
+	// OnMismatch is called with every query whose results differ or which failed on the shadow, they are
+	// logged anyway
+	OnMismatch func(mismatch ShadowMismatch)
+}
+
+// ShadowMismatch is a query whose results differ between the primary and the shadow
+type ShadowMismatch struct {
+	TxID          string
+	SQL           string
+	PrimaryDigest string
+	ShadowDigest  string
+	// Err is the error of the query on the shadow
+	Err error
+}
+
+// shadowKey is the key of the shadowQueries of a root transaction
+type shadowKey struct{}
+
+type shadowQuery struct {
+	sql      string
+	vars     []interface{}
+	destType reflect.Type
+	schema   *schema.Schema
+	digest   string
+}
+
+// WithShadowTraffic duplicates the read-only root transactions of the manager according to shadow.
+// Only the queries of the gorm API (Find, First, Scan...) are replayed.
+func WithShadowTraffic(shadow ShadowTraffic) ManagerOption {
+	return func(m *transactionManager) {
+		m.shadowTraffic = &shadow
+		registerShadowCallbacks(m.GetOriginDB())
+	}
+}
+
+// startShadow samples the read-only root transaction txCtx for the shadow traffic of m
+func (m *transactionManager) startShadow(txCtx *transactionContext) {
+	if rand.Float64() >= m.shadowTraffic.SampleRate {
+		return
+	}
+	queries := txCtx.boundValue(shadowKey{}, func() interface{} {
+		return &[]shadowQuery{}
+	}).(*[]shadowQuery)
+	txID := txCtx.id
+	AfterCommit(txCtx, func(ctx context.Context) {
+		if len(*queries) > 0 {
+			go m.shadowTraffic.replay(txID, *queries)
+		}
+	})
+}
+
+func registerShadowCallbacks(db *gorm.DB) {
+	callbacks := db.Callback()
+	if callbacks.Query().Get(shadowCallbackName) != nil {
+		return
+	}
+	if err := callbacks.Query().After("*").Register(shadowCallbackName, recordShadowQuery); err != nil {
+		log.Println("[TX] register shadow callback error: ", err)
+	}
+}
+
+// recordShadowQuery runs after a query, it records the query with the digest of its results
+func recordShadowQuery(db *gorm.DB) {
+	root := transactionRootOf(db)
+	if root == nil || db.Error != nil || db.DryRun || db.Statement.Dest == nil {
+		return
+	}
+	queries, ok := root.values[shadowKey{}].(*[]shadowQuery)
+	if !ok {
+		return
+	}
+	destType := reflect.TypeOf(db.Statement.Dest)
+	if destType.Kind() != reflect.Ptr {
+		return
+	}
+	*queries = append(*queries, shadowQuery{
+		sql:      db.Statement.SQL.String(),
+		vars:     append([]interface{}(nil), db.Statement.Vars...),
+		destType: destType.Elem(),
+		schema:   db.Statement.Schema,
+		digest:   shadowDigest(db.Statement.Schema, reflect.ValueOf(db.Statement.Dest)),
+	})
+}
+
+func (s *ShadowTraffic) replay(txID string, queries []shadowQuery) {
+	db := s.Shadow.GetDB(context.Background())
+	for _, q := range queries {
+		dest := reflect.New(q.destType)
+		mismatch := ShadowMismatch{TxID: txID, SQL: q.sql, PrimaryDigest: q.digest}
+		if mismatch.Err = db.Raw(q.sql, q.vars...).Scan(dest.Interface()).Error; mismatch.Err == nil {
+			mismatch.ShadowDigest = shadowDigest(q.schema, dest)
+			if mismatch.ShadowDigest == q.digest {
+				continue
+			}
+		}
+		log.Printf("[TX] shadow mismatch: tx %s, sql %s, primary %s, shadow %s, error %v",
+			txID, q.sql, mismatch.PrimaryDigest, mismatch.ShadowDigest, mismatch.Err)
+		if s.OnMismatch != nil {
+			s.OnMismatch(mismatch)
+		}
+	}
+}
+
+// shadowDigest return the digest of the results of a query in value. Rows of the model are digested by their
+// columns, so the associations loaded by Preload on the primary don't count.
+func shadowDigest(s *schema.Schema, value reflect.Value) string {
+	hash := sha256.New()
+	value = reflect.Indirect(value)
+	rows := []reflect.Value{value}
+	if value.Kind() == reflect.Slice || value.Kind() == reflect.Array {
+		rows = rows[:0]
+		for i := 0; i < value.Len(); i++ {
+			rows = append(rows, value.Index(i))
+		}
+	}
+	for _, row := range rows {
+		row = reflect.Indirect(row)
+		if !row.IsValid() {
+			continue
+		}
+		if s == nil || row.Type() != s.ModelType {
+			data, _ := json.Marshal(row.Interface())
+			hash.Write(data)
+		} else {
+			for _, field := range s.Fields {
+				if field.DBName != "" {
+					data, _ := json.Marshal(field.ReflectValueOf(context.Background(), row).Interface())
+					hash.Write(append(data, '\x1f'))
+				}
+			}
+		}
+		hash.Write([]byte{'\x1e'})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
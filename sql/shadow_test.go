@@ -0,0 +1,52 @@
+package sql
+
+import (
+	"context"
+	"database/sql/driver"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"propagation-tx/internal/recordingdriver"
+	"testing"
+)
+
+func TestWithShadowTraffic(t *testing.T) {
+	// database/sql tries a few connections of the pool before giving up
+	shadow := &recordingdriver.Driver{BrokenReads: 10}
+	mismatches := make(chan ShadowMismatch, 1)
+	d := &recordingdriver.Driver{}
+	manager := newRecordingManager(t, d, WithShadowTraffic(ShadowTraffic{
+		Shadow:     sessionFactory{db: newRecordingDB(t, shadow)},
+		SampleRate: 1,
+		OnMismatch: func(mismatch ShadowMismatch) {
+			mismatches <- mismatch
+		},
+	}))
+	var txID string
+	err := manager.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+		txID = TxID(ctx)
+		var users []User
+		return tx.Find(&users).Error
+	}, WithReadOnly(true))
+	assert.NoError(t, err)
+	mismatch := <-mismatches
+	assert.Equal(t, txID, mismatch.TxID)
+	assert.Equal(t, "SELECT * FROM `user`", mismatch.SQL)
+	assert.ErrorIs(t, mismatch.Err, driver.ErrBadConn)
+
+	// the transactions which aren't read-only or sampled aren't replayed
+	for _, c := range []struct {
+		sampleRate float64
+		readOnly   bool
+	}{{sampleRate: 0, readOnly: true}, {sampleRate: 1, readOnly: false}} {
+		shadow = &recordingdriver.Driver{}
+		manager = newRecordingManager(t, &recordingdriver.Driver{}, WithShadowTraffic(ShadowTraffic{
+			Shadow:     sessionFactory{db: newRecordingDB(t, shadow)},
+			SampleRate: c.sampleRate,
+		}))
+		assert.NoError(t, manager.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+			var users []User
+			return tx.Find(&users).Error
+		}, WithReadOnly(c.readOnly)))
+		assert.Empty(t, shadow.Statements())
+	}
+}
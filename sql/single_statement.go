@@ -0,0 +1,78 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+)
+
+var ErrNotSingleStatement = errors.New("more than one statement in a single statement call")
+
+// WithSingleStatement declares a PropagationNested call executes a single statement, it then joins the outer
+// transaction without savepoint since the atomicity of the statement already covers the call. The statements
+// after the first one fail with ErrNotSingleStatement without being executed. Since there's no savepoint, a call
+// failing after its write succeeded can't undo it: the outer transaction is then marked rollback-only.
+//
+// On Postgres a failed statement aborts the whole transaction, only the savepoint keeps it usable.
+func WithSingleStatement() TxOption {
+	return txOptionFunc(func(o *txOptions) {
+		o.singleStatement = true
+	})
+}
+
+// singleStatementKey is the key of the singleStatementGuard of a root transaction
+type singleStatementKey struct{}
+
+type singleStatementGuard struct {
+	active bool
+	// limit is the Statements of the TransactionStats allowed
+	limit int
+	// written tells the write of the call succeeded
+	written bool
+}
+
+// withSingleStatement runs bizFn of a PropagationNested call declared WithSingleStatement in txCtx, without savepoint
+func (m *transactionManager) withSingleStatement(ctx context.Context, txCtx *transactionContext, bizFn func(ctx context.Context, tx *gorm.DB) error, o *txOptions) (err error) {
+	root := txCtx.root()
+	guard := txCtx.boundValue(singleStatementKey{}, func() interface{} {
+		return &singleStatementGuard{}
+	}).(*singleStatementGuard)
+	outer := *guard
+	guard.active, guard.limit, guard.written = true, root.stats.Statements+1, false
+	afterCommitMark, labelMark := len(root.afterCommit), len(root.labels)
+	panicked := true
+	defer func() {
+		written := guard.written
+		*guard = outer
+		if !panicked && (err == nil || !m.rollsBack(o, err)) {
+			return
+		}
+		// a failed statement is undone by the database, a succeeded write only by the rollback of the outer transaction
+		if written {
+			root.rollbackOnly = true
+		}
+		txCtx.discardAfterCommit(afterCommitMark)
+		txCtx.discardLabels(labelMark)
+	}()
+	err = bizFn(txCtx.Session(ctx, PropagationNested), txCtx.TxDB())
+	panicked = false
+	return err
+}
+
+// checkSingleStatement fails db if it runs in a single statement call which already executed its statement
+func (c *transactionContext) checkSingleStatement(db *gorm.DB) bool {
+	guard, _ := c.values[singleStatementKey{}].(*singleStatementGuard)
+	if guard == nil || !guard.active || c.stats.Statements <= guard.limit {
+		return true
+	}
+	_ = db.AddError(ErrNotSingleStatement)
+	return false
+}
+
+// recordSingleStatement records the write db succeeded if it runs in a single statement call
+func (c *transactionContext) recordSingleStatement(db *gorm.DB) {
+	guard, _ := c.values[singleStatementKey{}].(*singleStatementGuard)
+	if guard != nil && guard.active && db.Error == nil {
+		guard.written = true
+	}
+}
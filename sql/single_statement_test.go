@@ -0,0 +1,44 @@
+package sql
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"propagation-tx/internal/recordingdriver"
+	"testing"
+)
+
+func TestWithSingleStatement(t *testing.T) {
+	d := &recordingdriver.Driver{}
+	manager := newRecordingManager(t, d)
+	err := manager.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+		assert.NoError(t, manager.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+			return tx.Exec("UPDATE stock SET n = n - 1").Error
+		}, PropagationNested, WithSingleStatement()))
+		err := manager.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+			if err := tx.Exec("UPDATE stock SET n = n - 1").Error; err != nil {
+				return err
+			}
+			return tx.Exec("UPDATE orders SET paid = 1").Error
+		}, PropagationNested, WithSingleStatement())
+		assert.ErrorIs(t, err, ErrNotSingleStatement)
+		return nil
+	})
+	// the write of the failed call can't be undone without the outer transaction
+	assert.ErrorIs(t, err, ErrRollbackOnly)
+	assert.Equal(t, []string{"BEGIN", "UPDATE stock SET n = n - 1", "UPDATE stock SET n = n - 1", "ROLLBACK"}, d.Statements())
+}
+
+func TestWithSingleStatement_FailedStatement(t *testing.T) {
+	d := &recordingdriver.Driver{}
+	manager := newRecordingManager(t, d)
+	err := manager.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+		err := manager.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+			return tx.Exec("DELETE FROM stock").Error
+		}, PropagationNested, WithSingleStatement())
+		assert.ErrorIs(t, err, ErrStatementBudgetExceeded)
+		return tx.Exec("DELETE FROM stock WHERE id = 1").Error
+	}, WithStatementBudget(0, FullTableScan))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"BEGIN", "DELETE FROM stock WHERE id = 1", "COMMIT"}, d.Statements())
+}
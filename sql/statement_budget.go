@@ -0,0 +1,103 @@
+package sql
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"log"
+	"reflect"
+	"strings"
+)
+
+const statementBudgetCallbackName = "propagation-tx:statement_budget"
+
+var ErrStatementBudgetExceeded = errors.New("statement budget exceeded")
+
+// StatementMatcher flags the statements of a class, e.g. expensive ones. Statements of the gorm API are given
+// before their SQL is built, only raw statements have their SQL.
+type StatementMatcher func(stmt *gorm.Statement) bool
+
+// FullTableScan matches the reads, updates and deletes without WHERE, LIMIT nor primary key
+func FullTableScan(stmt *gorm.Statement) bool {
+	if stmt.SQL.Len() > 0 {
+		sql := strings.ToUpper(strings.TrimSpace(stmt.SQL.String()))
+		if !strings.HasPrefix(sql, "SELECT") && !strings.HasPrefix(sql, "UPDATE") && !strings.HasPrefix(sql, "DELETE") {
+			return false
+		}
+		return !strings.Contains(sql, " WHERE ") && !strings.Contains(sql, " LIMIT ")
+	}
+	if _, ok := stmt.Clauses["WHERE"]; ok {
+		return false
+	}
+	if _, ok := stmt.Clauses["LIMIT"]; ok {
+		return false
+	}
+	if stmt.Schema != nil && stmt.Schema.PrioritizedPrimaryField != nil && stmt.ReflectValue.Kind() == reflect.Struct {
+		if _, zero := stmt.Schema.PrioritizedPrimaryField.ValueOf(stmt.Context, stmt.ReflectValue); !zero {
+			return false
+		}
+	}
+	return true
+}
+
+// statementBudgetKey is the key of the statementBudgets of a root transaction
+type statementBudgetKey struct{}
+
+type statementBudget struct {
+	remaining int
+	matcher   StatementMatcher
+}
+
+// WithStatementBudget allows at most n statements matched by matcher in the transaction, the next ones fail
+// with ErrStatementBudgetExceeded without being executed. Creates aren't matched.
+func WithStatementBudget(n int, matcher StatementMatcher) TxOption {
+	return txOptionFunc(func(o *txOptions) {
+		o.statementBudgets = append(o.statementBudgets, statementBudget{remaining: n, matcher: matcher})
+	})
+}
+
+// startStatementBudgets enables the statement budgets of the root transaction txCtx
+func startStatementBudgets(txCtx *transactionContext, budgets []statementBudget) {
+	txCtx.boundValue(statementBudgetKey{}, func() interface{} {
+		// copied, the options may be reused by other calls
+		return append([]statementBudget(nil), budgets...)
+	})
+}
+
+// registerStatementBudgetCallbacks enforces the statement budgets of the transactions of the datasource, it's
+// registered with the manager since gorm callbacks can't be registered safely while statements run
+func registerStatementBudgetCallbacks(db *gorm.DB) {
+	callbacks := db.Callback()
+	if callbacks.Raw().Get(statementBudgetCallbackName) != nil {
+		return
+	}
+	for _, err := range []error{
+		callbacks.Query().Before("*").Register(statementBudgetCallbackName, spendStatementBudget),
+		callbacks.Update().Before("*").Register(statementBudgetCallbackName, spendStatementBudget),
+		callbacks.Delete().Before("*").Register(statementBudgetCallbackName, spendStatementBudget),
+		callbacks.Row().Before("*").Register(statementBudgetCallbackName, spendStatementBudget),
+		callbacks.Raw().Before("*").Register(statementBudgetCallbackName, spendStatementBudget),
+	} {
+		if err != nil {
+			log.Println("[TX] register statement budget callback error: ", err)
+		}
+	}
+}
+
+func spendStatementBudget(db *gorm.DB) {
+	root := transactionRootOf(db)
+	if root == nil || db.Error != nil || db.DryRun {
+		return
+	}
+	budgets, _ := root.values[statementBudgetKey{}].([]statementBudget)
+	for i := range budgets {
+		if !budgets[i].matcher(db.Statement) {
+			continue
+		}
+		if budgets[i].remaining <= 0 {
+			_ = db.AddError(fmt.Errorf("%w: %s", ErrStatementBudgetExceeded, db.Statement.Table))
+			return
+		}
+		budgets[i].remaining--
+	}
+}
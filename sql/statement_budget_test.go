@@ -0,0 +1,31 @@
+package sql
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"propagation-tx/internal/recordingdriver"
+	"testing"
+)
+
+func TestWithStatementBudget(t *testing.T) {
+	d := &recordingdriver.Driver{}
+	manager := newRecordingManager(t, d)
+	err := manager.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+		assert.NoError(t, tx.Exec("UPDATE stock SET n = 0").Error)
+		assert.NoError(t, tx.Exec("UPDATE stock SET n = 1 WHERE id = 1").Error)
+		return tx.Exec("DELETE FROM stock").Error
+	}, WithStatementBudget(1, FullTableScan))
+	assert.ErrorIs(t, err, ErrStatementBudgetExceeded)
+	assert.Equal(t, []string{"BEGIN", "UPDATE stock SET n = 0", "UPDATE stock SET n = 1 WHERE id = 1", "ROLLBACK"}, d.Statements())
+
+	// the budget is per transaction
+	d = &recordingdriver.Driver{}
+	manager = newRecordingManager(t, d)
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, manager.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+			return tx.Exec("DELETE FROM stock").Error
+		}, WithStatementBudget(1, FullTableScan)))
+	}
+	assert.Equal(t, []string{"BEGIN", "DELETE FROM stock", "COMMIT", "BEGIN", "DELETE FROM stock", "COMMIT"}, d.Statements())
+}
@@ -0,0 +1,108 @@
+package sql
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"log"
+)
+
+const statsCallbackName = "propagation-tx:stats"
+
+// TransactionStats are the statements executed and rows affected by a root transaction so far,
+// statements of rolled back PropagationNested blocks included
+type TransactionStats struct {
+	Statements int
+	// RowsAffected counts the rows created, updated or deleted
+	RowsAffected int64
+}
+
+// TxStats return the TransactionStats of the transaction of ctx, false if ctx is not in transaction
+func TxStats(ctx context.Context) (TransactionStats, bool) {
+	txCtx, ok := currentTransaction(ctx)
+	if !ok {
+		return TransactionStats{}, false
+	}
+	return txCtx.root().stats, true
+}
+
+// registerStatsCallbacks counts the statements of the transactions of the datasource,
+// guardrails are evaluated along
+func registerStatsCallbacks(db *gorm.DB) {
+	callbacks := db.Callback()
+	if callbacks.Raw().Get(statsCallbackName) != nil {
+		return
+	}
+	for _, err := range []error{
+		callbacks.Create().Before("*").Register(statsCallbackName, countStatement),
+		callbacks.Query().Before("*").Register(statsCallbackName, countStatement),
+		callbacks.Update().Before("*").Register(statsCallbackName, countStatement),
+		callbacks.Delete().Before("*").Register(statsCallbackName, countStatement),
+		callbacks.Row().Before("*").Register(statsCallbackName, countStatement),
+		callbacks.Raw().Before("*").Register(statsCallbackName, countStatement),
+		callbacks.Create().After("*").Register(statsCallbackName+"_after", countRowsAffected),
+		callbacks.Query().After("*").Register(statsCallbackName+"_after", recordStatement),
+		callbacks.Update().After("*").Register(statsCallbackName+"_after", countRowsAffected),
+		callbacks.Delete().After("*").Register(statsCallbackName+"_after", countRowsAffected),
+		callbacks.Row().After("*").Register(statsCallbackName+"_after", recordStatement),
+		callbacks.Raw().After("*").Register(statsCallbackName+"_after", countRowsAffected),
+	} {
+		if err != nil {
+			log.Println("[TX] register stats callback error: ", err)
+		}
+	}
+}
+
+// transactionRootOf return the root transaction db runs in, nil if it doesn't run in a transaction
+func transactionRootOf(db *gorm.DB) *transactionContext {
+	txCtx, ok := currentTransaction(db.Statement.Context)
+	if !ok {
+		return nil
+	}
+	return txCtx.root()
+}
+
+// countStatement runs before a statement, the statements of DryRun sessions aren't executed and don't count
+func countStatement(db *gorm.DB) {
+	root := transactionRootOf(db)
+	if root == nil || db.Error != nil || db.DryRun {
+		return
+	}
+	root.stats.Statements++
+	if !root.checkSingleStatement(db) {
+		return
+	}
+	if state := root.guardrailState(); state != nil {
+		state.checkStatement(db, root.stats)
+	}
+}
+
+// recordStatement runs after a read
+func recordStatement(db *gorm.DB) {
+	root := transactionRootOf(db)
+	if root == nil || db.DryRun {
+		return
+	}
+	if state := root.guardrailState(); state != nil {
+		state.record(db)
+	}
+}
+
+// countRowsAffected runs after a write
+func countRowsAffected(db *gorm.DB) {
+	root := transactionRootOf(db)
+	if root == nil || db.DryRun {
+		return
+	}
+	state := root.guardrailState()
+	if state != nil {
+		state.record(db)
+	}
+	if db.Error != nil {
+		return
+	}
+	root.recordSingleStatement(db)
+	root.stats.RowsAffected += db.RowsAffected
+	if state != nil {
+		state.checkRowsAffected(db, root.stats)
+	}
+}
@@ -0,0 +1,69 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrRollbackOnly = errors.New("transaction marked rollback-only")
+
+// TransactionStatus describes the transaction of a ctx, see TxStatus
+type TransactionStatus struct {
+	Active bool
+	// ID is the TxID of the root transaction
+	ID string
+	// Depth is the number of calls joining the root transaction down to the ctx, 0 in the root call
+	Depth int
+	// Propagations are the propagations of the calls from the root transaction down to the ctx
+	Propagations []TransactionPropagation
+	// RollbackOnly tells whether the transaction can only roll back, see SetRollbackOnly
+	RollbackOnly bool
+	StartedAt    time.Time
+	// Savepoints is the number of savepoints created in the transaction so far
+	Savepoints int
+}
+
+// TxStatus return the TransactionStatus of the transaction of ctx, inactive if ctx is not in transaction
+func TxStatus(ctx context.Context) TransactionStatus {
+	txCtx, ok := currentTransaction(ctx)
+	if !ok {
+		return TransactionStatus{}
+	}
+	root := txCtx.root()
+	status := TransactionStatus{
+		Active:       true,
+		ID:           root.id,
+		RollbackOnly: root.isRollbackOnly(),
+		StartedAt:    root.startedAt,
+		Savepoints:   root.savepointSeq,
+	}
+	for c := txCtx; c != nil; c = c.parent {
+		status.Propagations = append(status.Propagations, c.propagation)
+	}
+	status.Depth = len(status.Propagations) - 1
+	for i, j := 0, len(status.Propagations)-1; i < j; i, j = i+1, j-1 {
+		status.Propagations[i], status.Propagations[j] = status.Propagations[j], status.Propagations[i]
+	}
+	return status
+}
+
+// SetRollbackOnly marks the root transaction of ctx rollback-only, its commit then fails with ErrRollbackOnly
+// and rolls it back instead
+func SetRollbackOnly(ctx context.Context) error {
+	txCtx, ok := currentTransaction(ctx)
+	if !ok {
+		return ErrNoTransaction
+	}
+	txCtx.root().rollbackOnly = true
+	return nil
+}
+
+// isRollbackOnly tells whether the root transaction c can only roll back
+func (c *transactionContext) isRollbackOnly() bool {
+	if c.rollbackOnly {
+		return true
+	}
+	state := c.guardrailState()
+	return state != nil && state.guardrails.Action == GuardrailRollback && state.violation != nil
+}
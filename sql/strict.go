@@ -0,0 +1,63 @@
+package sql
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"log"
+)
+
+const strictCallbackName = "propagation-tx:strict"
+
+var ErrRawDBInTransaction = errors.New("statement run outside of the ambient transaction")
+
+// StrictMode decides what happens to a statement executed on the raw datasource (e.g. factory.GetDB(ctx) or
+// GetOriginDB().WithContext(ctx)) with a ctx that is in a transaction on that datasource
+type StrictMode int8
+
+const (
+	StrictModeRedirect StrictMode = iota + 1 // 在当前事务中执行该语句
+	StrictModeReject                         // 返回ErrRawDBInTransaction，不执行该语句
+)
+
+// WithStrictMode protects the datasource of the manager from statements accidentally written outside of the
+// ambient transaction. Statements are recognized by their ctx, so GetOriginDB() used without ctx can't be caught.
+// The mode applies to the datasource, the first manager enabling it on a datasource sets the mode.
+func WithStrictMode(mode StrictMode) ManagerOption {
+	return func(m *transactionManager) {
+		registerStrictCallbacks(m.GetOriginDB(), mode)
+	}
+}
+
+func registerStrictCallbacks(origin *gorm.DB, mode StrictMode) {
+	callbacks := origin.Callback()
+	if callbacks.Query().Get(strictCallbackName) != nil {
+		return
+	}
+	key := transactionKeyOf(origin)
+	check := func(db *gorm.DB) {
+		txCtx, ok := db.Statement.Context.Value(key).(*transactionContext)
+		if !ok {
+			return
+		}
+		if _, inTx := db.Statement.ConnPool.(gorm.TxCommitter); inTx {
+			return
+		}
+		if mode == StrictModeRedirect {
+			db.Statement.ConnPool = txCtx.tx.Statement.ConnPool
+			return
+		}
+		_ = db.AddError(ErrRawDBInTransaction)
+	}
+	for _, err := range []error{
+		callbacks.Create().Before("*").Register(strictCallbackName, check),
+		callbacks.Query().Before("*").Register(strictCallbackName, check),
+		callbacks.Update().Before("*").Register(strictCallbackName, check),
+		callbacks.Delete().Before("*").Register(strictCallbackName, check),
+		callbacks.Row().Before("*").Register(strictCallbackName, check),
+		callbacks.Raw().Before("*").Register(strictCallbackName, check),
+	} {
+		if err != nil {
+			log.Println("[TX] register strict mode callback error: ", err)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package sql
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"reflect"
+)
+
+// SuspendedTransaction is a transaction set aside while a PropagationRequiresNew or PropagationNotSupported block
+// runs outside of it. Its suspendable resources are detached and its synchronizations (BeforeCommit, AfterCommit,
+// AfterRollback) are held back until the block returns, so nothing of the block is bound to it.
+type SuspendedTransaction struct {
+	root             *transactionContext
+	beforeCommit     []func(ctx context.Context, tx *gorm.DB) error
+	afterCommit      []func(ctx context.Context)
+	afterRollback    []func(ctx context.Context)
+	beforeCompletion []func(tx *gorm.DB)
+}
+
+// ID return the TxID of the suspended transaction
+func (s *SuspendedTransaction) ID() string {
+	return s.root.id
+}
+
+// suspendedKey looks up the innermost SuspendedTransaction of a ctx
+type suspendedKey struct{}
+
+// Suspended return the transaction suspended by the innermost PropagationRequiresNew or PropagationNotSupported
+// block ctx runs in, e.g. to correlate the logs of both transactions
+func Suspended(ctx context.Context) (*SuspendedTransaction, bool) {
+	s, ok := ctx.Value(suspendedKey{}).(*SuspendedTransaction)
+	return s, ok
+}
+
+// SuspensionValues is which values of the ctx cross the suspension boundary into a PropagationRequiresNew or
+// PropagationNotSupported block. The values of propagation-tx itself, the deadline and the cancellation always do.
+type SuspensionValues int8
+
+const (
+	CopyAllValues   SuspensionValues = iota // 默认，传递所有值
+	AllowlistValues                         // 只传递allowlist中的key
+	StripValues                             // 不传递任何值
+)
+
+type suspensionValuePolicy struct {
+	policy    SuspensionValues
+	allowlist map[interface{}]bool
+}
+
+// WithSuspensionValues controls the values of the ctx passed to the blocks suspending a transaction, e.g. to keep
+// request-scoped DB handles from leaking into the new transaction. allowlist is the keys kept by AllowlistValues.
+func WithSuspensionValues(policy SuspensionValues, allowlist ...interface{}) ManagerOption {
+	return func(m *transactionManager) {
+		if policy == CopyAllValues {
+			m.suspensionValues = nil
+			return
+		}
+		p := &suspensionValuePolicy{policy: policy, allowlist: make(map[interface{}]bool, len(allowlist))}
+		for _, key := range allowlist {
+			p.allowlist[key] = true
+		}
+		m.suspensionValues = p
+	}
+}
+
+// internalKeyPackage is the package of the context keys of propagation-tx
+var internalKeyPackage = reflect.TypeOf(transactionKey{}).PkgPath()
+
+func (p *suspensionValuePolicy) crosses(key interface{}) bool {
+	if reflect.TypeOf(key).PkgPath() == internalKeyPackage {
+		return true
+	}
+	return p.policy == AllowlistValues && p.allowlist[key]
+}
+
+// suspendedContext is the ctx of a block running with the transaction of its datasource suspended
+type suspendedContext struct {
+	context.Context
+	suspended *SuspendedTransaction
+	values    *suspensionValuePolicy
+}
+
+func (c *suspendedContext) Value(key interface{}) interface{} {
+	switch k := key.(type) {
+	case transactionKey:
+		if k == c.suspended.root.key {
+			return nil
+		}
+	case suspendedKey:
+		return c.suspended
+	}
+	if c.values != nil && !c.values.crosses(key) {
+		return nil
+	}
+	return c.Context.Value(key)
+}
+
+// suspend suspends the transaction of m in ctx if any, it return the ctx to run the block with
+func (m *transactionManager) suspend(ctx context.Context) (*SuspendedTransaction, context.Context, error) {
+	txCtx, ok := m.transactionOf(ctx)
+	if !ok {
+		return nil, ctx, nil
+	}
+	if err := txCtx.suspendResources(); err != nil {
+		return nil, ctx, err
+	}
+	root := txCtx.root()
+	s := &SuspendedTransaction{
+		root:             root,
+		beforeCommit:     root.beforeCommit,
+		afterCommit:      root.afterCommit,
+		afterRollback:    root.afterRollback,
+		beforeCompletion: root.beforeCompletion,
+	}
+	root.beforeCommit, root.afterCommit, root.afterRollback, root.beforeCompletion = nil, nil, nil, nil
+	return s, &suspendedContext{Context: ctx, suspended: s, values: m.suspensionValues}, nil
+}
+
+// resume restores the suspended transaction once the block returned, the synchronizations registered meanwhile
+// through a ctx of the suspended transaction run after the ones held back
+func (s *SuspendedTransaction) resume() error {
+	if s == nil {
+		return nil
+	}
+	root := s.root
+	root.beforeCommit = append(s.beforeCommit, root.beforeCommit...)
+	root.afterCommit = append(s.afterCommit, root.afterCommit...)
+	root.afterRollback = append(s.afterRollback, root.afterRollback...)
+	root.beforeCompletion = append(s.beforeCompletion, root.beforeCompletion...)
+	return root.resumeResources()
+}
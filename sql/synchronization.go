@@ -0,0 +1,119 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"log"
+)
+
+var ErrNoTransaction = errors.New("not in transaction")
+
+// BeforeCommit registers fn to run right before the root transaction of ctx commits,
+// an error returned by fn rolls the root transaction back instead
+func BeforeCommit(ctx context.Context, fn func(ctx context.Context, tx *gorm.DB) error) error {
+	txCtx, ok := currentTransaction(ctx)
+	if !ok {
+		return ErrNoTransaction
+	}
+	root := txCtx.root()
+	root.beforeCommit = append(root.beforeCommit, fn)
+	return nil
+}
+
+func (c *transactionContext) triggerBeforeCommit() error {
+	// hooks may register other hooks, which run in the same pass
+	for i := 0; i < len(c.beforeCommit); i++ {
+		if err := c.beforeCommit[i](c, c.tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *transactionContext) triggerBeforeCompletion() {
+	for _, fn := range c.beforeCompletion {
+		fn(c.tx)
+	}
+	c.beforeCompletion = nil
+}
+
+// AfterCommit registers fn to run once the root transaction of ctx committed, it's dropped if the transaction
+// rolls back, or the PropagationNested savepoint it was registered in is rolled back.
+// fn runs immediately if ctx is not in transaction.
+func AfterCommit(ctx context.Context, fn func(ctx context.Context)) {
+	txCtx, ok := currentTransaction(ctx)
+	if !ok {
+		fn(ctx)
+		return
+	}
+	root := txCtx.root()
+	root.afterCommit = append(root.afterCommit, fn)
+}
+
+// DeferToCommit registers the side effect fn of a gorm model hook (AfterCreate, AfterUpdate...) to run once
+// the managed transaction of tx committed, instead of on data that may still be rolled back
+//
+//	func (u *User) AfterCreate(tx *gorm.DB) error {
+//		sql.DeferToCommit(tx, func(ctx context.Context) { publishUserCreated(ctx, u) })
+//		return nil
+//	}
+func DeferToCommit(tx *gorm.DB, fn func(ctx context.Context)) {
+	AfterCommit(tx.Statement.Context, fn)
+}
+
+func (c *transactionContext) triggerAfterCommit() {
+	for i := 0; i < len(c.afterCommit); i++ {
+		c.runAfterCompletion("after commit", c.afterCommit[i])
+	}
+	c.afterCommit = nil
+}
+
+// runAfterCompletion runs fn with the original ctx, the transaction is over and its panic can't change the outcome
+func (c *transactionContext) runAfterCompletion(kind string, fn func(ctx context.Context)) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[TX] %s callback panic: %v", kind, r)
+		}
+	}()
+	fn(c.ctx)
+}
+
+// AfterRollback registers fn to run once the root transaction of ctx rolled back, e.g. to undo a side effect made
+// in anticipation of the commit. It's dropped if ctx is not in transaction, or the root transaction commits.
+func AfterRollback(ctx context.Context, fn func(ctx context.Context)) {
+	txCtx, ok := currentTransaction(ctx)
+	if !ok {
+		return
+	}
+	root := txCtx.root()
+	root.afterRollback = append(root.afterRollback, fn)
+}
+
+func (c *transactionContext) triggerAfterRollback() {
+	for i := 0; i < len(c.afterRollback); i++ {
+		c.runAfterCompletion("after rollback", c.afterRollback[i])
+	}
+	c.afterRollback = nil
+}
+
+func (c *transactionContext) discardAfterCommit(mark int) {
+	root := c.root()
+	if mark < len(root.afterCommit) {
+		root.afterCommit = root.afterCommit[:mark]
+	}
+}
+
+// boundValue return the value bound to key on the root transaction, created by create on first access
+func (c *transactionContext) boundValue(key interface{}, create func() interface{}) interface{} {
+	root := c.root()
+	if root.values == nil {
+		root.values = make(map[interface{}]interface{})
+	}
+	value, exist := root.values[key]
+	if !exist {
+		value = create()
+		root.values[key] = value
+	}
+	return value
+}
@@ -0,0 +1,213 @@
+package sql
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"testing"
+	"time"
+)
+
+// derivedKey is the key of the values of the ctxs derived from the ctx of a transaction
+type derivedKey struct{}
+
+func TestAfterCommit(t *testing.T) {
+	var called []string
+	DefaultTransactionTest("test-run-after-commit", t, func() {
+		called = nil
+		_ = tm.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+			tx.Create(user1)
+			AfterCommit(ctx, func(ctx context.Context) {
+				AssertExist(t, user1)
+				called = append(called, user1.Username)
+			})
+			assert.Empty(t, called)
+			return nil
+		}, PropagationRequired)
+	}, func(t *testing.T) {
+		assert.Equal(t, []string{user1.Username}, called)
+	})
+
+	DefaultTransactionTest("test-drop-on-rollback", t, func() {
+		called = nil
+		_ = tm.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+			tx.Create(user1)
+			AfterCommit(ctx, func(ctx context.Context) {
+				called = append(called, user1.Username)
+			})
+			return mockErr
+		}, PropagationRequired)
+	}, func(t *testing.T) {
+		AssertNotExist(t, user1)
+		assert.Empty(t, called)
+	})
+
+	DefaultTransactionTest("test-drop-on-nested-rollback", t, func() {
+		called = nil
+		_ = tm.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+			tx.Create(user1)
+			AfterCommit(ctx, func(ctx context.Context) {
+				called = append(called, user1.Username)
+			})
+			_ = tm.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+				tx.Create(user2)
+				DeferToCommit(tx, func(ctx context.Context) {
+					called = append(called, user2.Username)
+				})
+				return mockErr
+			}, PropagationNested)
+			return nil
+		}, PropagationRequired)
+	}, func(t *testing.T) {
+		AssertExist(t, user1)
+		AssertNotExist(t, user2)
+		assert.Equal(t, []string{user1.Username}, called)
+	})
+
+	DefaultTransactionTest("test-drop-on-rollback-derived-ctx", t, func() {
+		called = nil
+		_ = tm.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+			tx.Create(user1)
+			timeoutCtx, cancel := context.WithTimeout(ctx, time.Minute)
+			defer cancel()
+			AfterCommit(context.WithValue(timeoutCtx, derivedKey{}, user1.Username), func(ctx context.Context) {
+				called = append(called, user1.Username)
+			})
+			assert.Empty(t, called)
+			return mockErr
+		}, PropagationRequired)
+	}, func(t *testing.T) {
+		AssertNotExist(t, user1)
+		assert.Empty(t, called)
+	})
+}
+
+func TestAfterRollback(t *testing.T) {
+	var called []string
+	DefaultTransactionTest("test-run-after-rollback", t, func() {
+		called = nil
+		_ = tm.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+			tx.Create(user1)
+			AfterRollback(ctx, func(ctx context.Context) {
+				AssertNotExist(t, user1)
+				called = append(called, user1.Username)
+			})
+			return mockErr
+		}, PropagationRequired)
+	}, func(t *testing.T) {
+		assert.Equal(t, []string{user1.Username}, called)
+	})
+
+	DefaultTransactionTest("test-drop-on-commit", t, func() {
+		called = nil
+		_ = tm.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+			tx.Create(user1)
+			AfterRollback(ctx, func(ctx context.Context) {
+				called = append(called, user1.Username)
+			})
+			return nil
+		}, PropagationRequired)
+	}, func(t *testing.T) {
+		AssertExist(t, user1)
+		assert.Empty(t, called)
+	})
+}
+
+func TestSuspendedTransaction(t *testing.T) {
+	var called []string
+	DefaultTransactionTest("test-suspend-synchronizations", t, func() {
+		called = nil
+		_ = tm.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+			tx.Create(user1)
+			AfterCommit(ctx, func(ctx context.Context) {
+				called = append(called, user1.Username)
+			})
+			outerID := TxID(ctx)
+			_ = tm.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+				suspended, ok := Suspended(ctx)
+				assert.True(t, ok)
+				assert.Equal(t, outerID, suspended.ID())
+				tx.Create(user2)
+				AfterCommit(ctx, func(ctx context.Context) {
+					called = append(called, user2.Username)
+				})
+				return nil
+			}, PropagationRequiresNew)
+			assert.Equal(t, []string{user2.Username}, called)
+			return nil
+		}, PropagationRequired)
+	}, func(t *testing.T) {
+		AssertExist(t, user1)
+		AssertExist(t, user2)
+		assert.Equal(t, []string{user2.Username, user1.Username}, called)
+	})
+}
+
+func TestTxResources(t *testing.T) {
+	var cleaned []string
+	DefaultTransactionTest("test-tx-resources", t, func() {
+		cleaned = nil
+		_ = tm.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+			resources, ok := TxResourcesOf(ctx)
+			assert.True(t, ok)
+			assert.NoError(t, resources.Bind("producer", user1.Username, func(ctx context.Context, value interface{}) {
+				cleaned = append(cleaned, value.(string))
+			}))
+			assert.ErrorIs(t, resources.Bind("producer", user2.Username, nil), ErrResourceBound)
+			_ = tm.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+				resources, _ := TxResourcesOf(ctx)
+				value, ok := resources.Get("producer")
+				assert.True(t, ok)
+				assert.Equal(t, user1.Username, value)
+				return nil
+			}, PropagationNested)
+			_ = tm.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+				resources, _ := TxResourcesOf(ctx)
+				_, ok := resources.Get("producer")
+				assert.False(t, ok)
+				return nil
+			}, PropagationRequiresNew)
+			assert.Empty(t, cleaned)
+			return nil
+		}, PropagationRequired)
+	}, func(t *testing.T) {
+		assert.Equal(t, []string{user1.Username}, cleaned)
+	})
+}
+
+func TestPublishAfterCommit(t *testing.T) {
+	publisher := NewInMemoryPublisher()
+	var received []interface{}
+	publisher.Subscribe(func(ctx context.Context, event interface{}) {
+		received = append(received, event)
+	})
+	publishingTm := NewTransactionManager(factory, WithEventPublisher(publisher))
+	DefaultTransactionTest("test-publish-after-commit", t, func() {
+		received = nil
+		_ = publishingTm.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+			tx.Create(user1)
+			assert.NoError(t, PublishAfterCommit(ctx, user1.Username))
+			_ = publishingTm.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+				tx.Create(user2)
+				assert.NoError(t, PublishAfterCommit(ctx, user2.Username))
+				return mockErr
+			}, PropagationNested)
+			assert.Empty(t, received)
+			return nil
+		}, PropagationRequired)
+	}, func(t *testing.T) {
+		assert.Equal(t, []interface{}{user1.Username}, received)
+	})
+
+	DefaultTransactionTest("test-publish-dropped-on-rollback", t, func() {
+		received = nil
+		_ = publishingTm.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+			tx.Create(user1)
+			assert.NoError(t, PublishAfterCommit(ctx, user1.Username))
+			return mockErr
+		}, PropagationRequired)
+	}, func(t *testing.T) {
+		assert.Empty(t, received)
+	})
+	assert.ErrorIs(t, PublishAfterCommit(context.Background(), user1.Username), ErrNoTransaction)
+}
@@ -0,0 +1,34 @@
+package sql
+
+import (
+	"context"
+	"gorm.io/gorm"
+)
+
+// WithTempTable creates the temporary table name with the columns definition (e.g. "id BIGINT PRIMARY KEY") on
+// the connection of the transaction of ctx, runs fn and drops the table afterwards, whatever fn returns.
+//
+// A transaction is pinned to one connection, so every statement of fn made through the transaction (tx, or
+// tm.GetDB with the ctx of fn) sees the table, and dropping it before the transaction ends keeps it from
+// leaking to the next user of the pooled connection.
+func WithTempTable(ctx context.Context, name string, columns string, fn func(ctx context.Context, tx *gorm.DB) error) (err error) {
+	txCtx, ok := currentTransaction(ctx)
+	if !ok {
+		return ErrNoTransaction
+	}
+	tx := txCtx.tx
+	table := tx.Statement.Quote(name)
+	if err = tx.Exec("CREATE TEMPORARY TABLE " + table + " (" + columns + ")").Error; err != nil {
+		return err
+	}
+	defer func() {
+		drop := "DROP TABLE IF EXISTS "
+		if tx.Dialector.Name() == "mysql" {
+			drop = "DROP TEMPORARY TABLE IF EXISTS "
+		}
+		if dropErr := tx.Exec(drop + table).Error; err == nil {
+			err = dropErr
+		}
+	}()
+	return fn(ctx, tx)
+}
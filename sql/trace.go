@@ -0,0 +1,129 @@
+package sql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"log"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// Trace is the portable record of a failed root transaction: every statement executed in it, savepoints
+// included, with its outcome
+type Trace struct {
+	StartedAt time.Time    `json:"startedAt"`
+	Events    []TraceEvent `json:"events"`
+	// Error is the error the transaction was rolled back for, empty for a panic
+	Error string `json:"error,omitempty"`
+}
+
+// TraceEvent is a statement executed in a traced transaction
+type TraceEvent struct {
+	// Offset since the start of the transaction
+	Offset time.Duration `json:"offset"`
+	SQL    string        `json:"sql"`
+	Rows   int64         `json:"rows"`
+	Error  string        `json:"error,omitempty"`
+}
+
+// TraceSink stores the traces of failed transactions
+type TraceSink interface {
+	WriteTrace(trace *Trace) error
+}
+
+// DirTraceSink writes every trace as a JSON file in a directory
+type DirTraceSink string
+
+var traceSeq uint64
+
+func (d DirTraceSink) WriteTrace(trace *Trace) error {
+	content, err := json.MarshalIndent(trace, "", "  ")
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("tx-%s-%d.json", trace.StartedAt.Format("20060102T150405.000"), atomic.AddUint64(&traceSeq, 1))
+	return os.WriteFile(filepath.Join(string(d), name), content, 0644)
+}
+
+// WithTraceRecorder records the statements of every root transaction and writes the ones rolled back to sink.
+// It's a debug mode: statements are kept in memory with their values until the transaction completes.
+func WithTraceRecorder(sink TraceSink) ManagerOption {
+	return func(m *transactionManager) {
+		m.traceSink = sink
+	}
+}
+
+// LoadTrace reads a trace written by DirTraceSink
+func LoadTrace(path string) (*Trace, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	trace := &Trace{}
+	if err = json.Unmarshal(content, trace); err != nil {
+		return nil, err
+	}
+	return trace, nil
+}
+
+// ReplayTrace re-executes the statements of trace in one transaction on db, a scratch database with the same
+// schema, to reproduce the failure offline. It returns the first statement error, the transaction is always
+// rolled back.
+func ReplayTrace(ctx context.Context, db *gorm.DB, trace *Trace) error {
+	tx := db.WithContext(ctx).Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	defer tx.Rollback()
+	for i, event := range trace.Events {
+		if err := tx.Exec(event.SQL).Error; err != nil {
+			return fmt.Errorf("replay statement %d [%s]: %w", i, event.SQL, err)
+		}
+	}
+	return nil
+}
+
+// recordTrace starts the Trace of the root transaction, recording through the logger of its tx
+func (c *transactionContext) recordTrace(startedAt time.Time) *Trace {
+	trace := &Trace{StartedAt: startedAt}
+	c.tx = c.tx.Session(&gorm.Session{Logger: &traceLogger{Interface: c.tx.Logger, trace: trace}})
+	return trace
+}
+
+func (m *transactionManager) writeTrace(trace *Trace, err error) {
+	if err != nil {
+		trace.Error = err.Error()
+	}
+	if writeErr := m.traceSink.WriteTrace(trace); writeErr != nil {
+		log.Println("[TX] write trace error: ", writeErr)
+	}
+}
+
+// traceLogger records every statement traced by gorm into trace before passing it to the wrapped logger
+type traceLogger struct {
+	logger.Interface
+	trace *Trace
+}
+
+func (l *traceLogger) LogMode(level logger.LogLevel) logger.Interface {
+	return &traceLogger{Interface: l.Interface.LogMode(level), trace: l.trace}
+}
+
+func (l *traceLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	sql, rows := fc()
+	event := TraceEvent{
+		Offset: begin.Sub(l.trace.StartedAt),
+		SQL:    sql,
+		Rows:   rows,
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	l.trace.Events = append(l.trace.Events, event)
+	l.Interface.Trace(ctx, begin, fc, err)
+}
@@ -2,9 +2,12 @@ package sql
 
 import (
 	"context"
+	stdsql "database/sql"
 	"errors"
 	"fmt"
 	"gorm.io/gorm"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -13,29 +16,109 @@ import (
 type TransactionPropagation int8
 
 const (
-	PropagationRequired     = iota // 如果存在一个事务，则支持当前事务，如果当前没有事务，就新建一个事务
-	PropagationSupports            // 如果存在一个事务，支持当前事务，如果当前没有事务，就以非事务方式执行
-	PropagationMandatory           // 如果存在一个事务，支持当前事务，如果当前没有事务，返回错误
-	PropagationRequiresNew         // 新建事务，如果当前存在事务，把当前事务挂起
-	PropagationNotSupported        // 以非事务方式执行操作，如果当前存在事务，就把当前事务挂起
-	PropagationNested              // 支持当前事务，新增Savepoint点，与当前事务同步提交或回滚
-	PropagationNever               // 以非事务方式执行，如果当前存在事务，直接返回错误
+	PropagationRequired     TransactionPropagation = iota // 如果存在一个事务，则支持当前事务，如果当前没有事务，就新建一个事务
+	PropagationSupports                                   // 如果存在一个事务，支持当前事务，如果当前没有事务，就以非事务方式执行
+	PropagationMandatory                                  // 如果存在一个事务，支持当前事务，如果当前没有事务，返回错误
+	PropagationRequiresNew                                // 新建事务，如果当前存在事务，把当前事务挂起
+	PropagationNotSupported                               // 以非事务方式执行操作，如果当前存在事务，就把当前事务挂起
+	PropagationNested                                     // 支持当前事务，新增Savepoint点，与当前事务同步提交或回滚
+	PropagationNever                                      // 以非事务方式执行，如果当前存在事务，直接返回错误
 )
 
-func defaultPropagation() TransactionPropagation {
-	return PropagationRequired
+func (p TransactionPropagation) String() string {
+	switch p {
+	case PropagationRequired:
+		return "Required"
+	case PropagationSupports:
+		return "Supports"
+	case PropagationMandatory:
+		return "Mandatory"
+	case PropagationRequiresNew:
+		return "RequiresNew"
+	case PropagationNotSupported:
+		return "NotSupported"
+	case PropagationNested:
+		return "Nested"
+	case PropagationNever:
+		return "Never"
+	default:
+		return fmt.Sprintf("TransactionPropagation(%d)", int8(p))
+	}
+}
+
+// joins reports whether the propagation joins the ambient transaction when there is one
+func (p TransactionPropagation) joins() bool {
+	switch p {
+	case PropagationRequired, PropagationSupports, PropagationMandatory, PropagationNested:
+		return true
+	default:
+		return false
+	}
+}
+
+// NestedFallbackPolicy is what PropagationNested does without an enclosing transaction
+type NestedFallbackPolicy int8
+
+const (
+	NestedFallbackRequired  NestedFallbackPolicy = iota // 默认，新建一个事务，同PropagationRequired
+	NestedFallbackReject                                // 返回ErrNestedPropWithoutTransaction
+	NestedFallbackSavepoint                             // 新建一个事务，并立即新增Savepoint点
+)
+
+// WithNestedFallback sets what PropagationNested does without an enclosing transaction,
+// NestedFallbackRequired by default
+func WithNestedFallback(policy NestedFallbackPolicy) ManagerOption {
+	return func(m *transactionManager) {
+		m.nestedFallback = policy
+	}
+}
+
+// WithDefaultPropagation sets the propagation of the calls without one, PropagationRequired by default
+func WithDefaultPropagation(propagation TransactionPropagation) ManagerOption {
+	return func(m *transactionManager) {
+		m.defaultPropagation = propagation
+	}
 }
 
 var (
 	ErrCommitWithoutTransaction        = errors.New("not in transaction, can't commit")
 	ErrNeverPropInTransaction          = errors.New("never propagation must not in transaction")
 	ErrMandatoryPropWithoutTransaction = errors.New("mandatory propagation must in transaction")
+	ErrNestedPropWithoutTransaction    = errors.New("nested propagation must in transaction")
 )
 
 type transactionContext struct {
-	ctx    context.Context
-	tx     *gorm.DB
-	parent *transactionContext
+	ctx        context.Context
+	tx         *gorm.DB
+	parent     *transactionContext
+	datasource *gorm.DB
+	// key is the transactionKey of datasource
+	key transactionKey
+	// concurrentUse is set on the root transaction by WithConcurrentUseCheck
+	concurrentUse *concurrentUseGuard
+	resources     []enlistedResource
+	// propagation is the propagation of the call of the transactionContext
+	propagation TransactionPropagation
+	// the fields below are only used on the root transaction
+	id             string
+	startedAt      time.Time
+	conn           *stdsql.Conn
+	savepointSeq   int
+	rollbackOnly   bool
+	alwaysRollback bool
+	// watchdogRollback is set by the watchdog goroutine
+	watchdogRollback atomic.Bool
+	beforeCommit     []func(ctx context.Context, tx *gorm.DB) error
+	validators       []CommitValidator
+	eventPublisher   EventPublisher
+	afterCommit      []func(ctx context.Context)
+	afterRollback    []func(ctx context.Context)
+	labels           []labeledSavepoint
+	values           map[interface{}]interface{}
+	trace            *Trace
+	stats            TransactionStats
+	// beforeCompletion restore the connection state before the transaction commits or rolls back
+	beforeCompletion []func(tx *gorm.DB)
 }
 
 func (c *transactionContext) Deadline() (deadline time.Time, ok bool) {
@@ -50,14 +133,67 @@ func (c *transactionContext) Err() error {
 	return c.ctx.Err()
 }
 
+// transactionKey looks up the transaction of datasource in a ctx, so each manager finds its own ambient
+// transaction when transactions of several datasources are interleaved
+type transactionKey struct {
+	datasource *gorm.DB
+}
+
+// datasources are the first *gorm.DB seen of each connection pool
+var datasources sync.Map
+
+// transactionKeyOf return the transactionKey of db. A datasource is identified by its connection pool, so managers
+// built separately on the same pool (sessions of one *gorm.DB, or *gorm.DB opened on one *sql.DB) join each other's
+// transactions.
+func transactionKeyOf(db *gorm.DB) transactionKey {
+	pool, err := db.DB()
+	if err != nil {
+		return transactionKey{db}
+	}
+	datasource, _ := datasources.LoadOrStore(pool, db)
+	return transactionKey{datasource.(*gorm.DB)}
+}
+
+// currentTransactionKey looks up the innermost transaction of a ctx, whatever its datasource
+type currentTransactionKey struct{}
+
 func (c *transactionContext) Value(key interface{}) interface{} {
+	switch k := key.(type) {
+	case transactionKey:
+		if k == c.key && c.InTransaction() {
+			return c
+		}
+	case currentTransactionKey:
+		if c.InTransaction() {
+			return c
+		}
+	}
 	return c.ctx.Value(key)
 }
 
+// currentTransaction return the innermost transaction of ctx, ctx being the ctx of the transaction or derived from
+// it (context.WithTimeout, WithValue...). A transaction hidden from ctx, by PropagationNotSupported or a suspension,
+// isn't returned.
+func currentTransaction(ctx context.Context) (*transactionContext, bool) {
+	txCtx, ok := ctx.Value(currentTransactionKey{}).(*transactionContext)
+	if !ok || ctx.Value(txCtx.key) != txCtx {
+		return nil, false
+	}
+	return txCtx, true
+}
+
 func (c *transactionContext) IsRoot() bool {
 	return c.parent == nil
 }
 
+func (c *transactionContext) root() *transactionContext {
+	root := c
+	for !root.IsRoot() {
+		root = root.parent
+	}
+	return root
+}
+
 func (c *transactionContext) Ctx() context.Context {
 	return c.ctx
 }
@@ -81,18 +217,34 @@ func (c *transactionContext) InTransaction() bool {
 	return ok && committer != nil
 }
 
-func (c *transactionContext) Session() *transactionContext {
-	return &transactionContext{
-		ctx:    c.ctx,
-		tx:     c.tx.WithContext(c.ctx),
-		parent: c,
+// Session return a child of c for a block joining it from ctx, ctx keeps the transactions of other datasources
+// started in between
+func (c *transactionContext) Session(ctx context.Context, propagation TransactionPropagation) *transactionContext {
+	session := &transactionContext{
+		ctx:         ctx,
+		parent:      c,
+		datasource:  c.datasource,
+		key:         c.key,
+		propagation: propagation,
 	}
+	session.tx = c.tx.WithContext(session)
+	return session
 }
 
-func (c *transactionContext) Rollback() {
-	if c.InTransaction() && c.IsRoot() {
-		c.tx.Rollback()
+// Rollback rolls the root transaction back, it return the error of the rollback, nil if the transaction was
+// already completed
+func (c *transactionContext) Rollback() error {
+	if !c.InTransaction() || !c.IsRoot() {
+		return nil
+	}
+	c.triggerBeforeCompletion()
+	err := c.tx.Rollback().Error
+	c.rollbackResources()
+	c.triggerAfterRollback()
+	if errors.Is(err, stdsql.ErrTxDone) {
+		return nil
 	}
+	return err
 }
 
 func (c *transactionContext) Commit() error {
@@ -100,28 +252,132 @@ func (c *transactionContext) Commit() error {
 		return ErrCommitWithoutTransaction
 	}
 	if c.IsRoot() {
-		return c.tx.Commit().Error
+		if c.rollbackOnly {
+			return ErrRollbackOnly
+		}
+		// a canceled call must not commit, database/sql rolls the transaction back on its own anyway
+		if err := c.ctx.Err(); err != nil {
+			return err
+		}
+		if err := c.triggerBeforeCommit(); err != nil {
+			return err
+		}
+		if err := c.validateCommit(); err != nil {
+			return err
+		}
+		c.triggerBeforeCompletion()
+		if err := c.tx.Commit().Error; err != nil {
+			if errors.Is(err, stdsql.ErrTxDone) && c.ctx.Err() != nil {
+				return c.ctx.Err()
+			}
+			if errors.Is(err, stdsql.ErrTxDone) && c.watchdogRolledBack() {
+				return ErrWatchdogRollback
+			}
+			if isBrokenConn(err) {
+				return &CommitOutcomeUnknownError{Err: err}
+			}
+			return err
+		}
+		return c.completeCommit()
+	}
+	return nil
+}
+
+// completeCommit commits the resources and runs the after commit hooks once the gorm transaction committed
+func (c *transactionContext) completeCommit() error {
+	if err := c.commitResources(); err != nil {
+		return err
 	}
+	c.triggerAfterCommit()
 	return nil
 }
 
 type TransactionManager interface {
-	DBFactory
-	Transaction(ctx context.Context, bizFn func(ctx context.Context, tx *gorm.DB) error, propagations ...TransactionPropagation) error
+	NonTxDBFactory
+	Transaction(ctx context.Context, bizFn func(ctx context.Context, tx *gorm.DB) error, opts ...TxOption) error
+	// Begin is Transaction for the calls which can't be structured as one closure, see Txn
+	Begin(ctx context.Context, opts ...TxOption) (*Txn, error)
+	// Idempotent runs fn in a Transaction once per key, the retries of a processed key get its stored result
+	Idempotent(ctx context.Context, key string, fn func(ctx context.Context, tx *gorm.DB) ([]byte, error), opts ...TxOption) ([]byte, error)
 }
 
 type transactionManager struct {
-	dBFactory DBFactory
+	dBFactory              DBFactory
+	resources              []ResourceManager
+	crossDatasourcePolicy  CrossDatasourcePolicy
+	traceSink              TraceSink
+	dualWrite              *dualWrite
+	metadataLockCheck      *metadataLockCheck
+	observers              []TransactionObserver
+	forcedPropagation      *TransactionPropagation
+	interceptors           []PropagationInterceptor
+	guardrails             *Guardrails
+	schemaVersionGuard     *schemaVersionGuard
+	callerNames            bool
+	clock                  Clock
+	idGenerator            IDGenerator
+	enforceReadOnly        bool
+	beginRetry             *beginRetry
+	rollbackRules          []RollbackRule
+	rollbackFailureHandler func(ctx context.Context, info TransactionInfo, err error)
+	commitVerifier         CommitVerifier
+	maxTransactionAge      time.Duration
+	txDefaults             txDefaults
+	configErr              error
+	savepointNamer         SavepointNamer
+	keepSavepoints         bool
+	suspensionValues       *suspensionValuePolicy
+	defaultPropagation     TransactionPropagation
+	shadowTraffic          *ShadowTraffic
+	beginComment           bool
+	quotaChecker           QuotaChecker
+	nestedFallback         NestedFallbackPolicy
+	maxNestingDepth        int
+	alwaysRollback         bool
+	savepointsDisabled     bool
+	watchdog               *watchdog
+	commitValidators       []CommitValidator
+	eventPublisher         EventPublisher
+	idempotencyTable       atomic.Bool
+	idempotencyTableMu     sync.Mutex
+	// key is the transactionKey of the datasource
+	key                transactionKey
+	concurrentUseCheck bool
 }
 
-func NewTransactionManager(factory DBFactory) TransactionManager {
-	return &transactionManager{
-		dBFactory: factory,
+// ManagerOption configures a TransactionManager
+type ManagerOption func(m *transactionManager)
+
+func NewTransactionManager(factory DBFactory, opts ...ManagerOption) TransactionManager {
+	m := &transactionManager{
+		dBFactory:       factory,
+		clock:           systemClock{},
+		idGenerator:     randomIDs{},
+		savepointNamer:  sequentialSavepoints{},
+		maxNestingDepth: defaultMaxNestingDepth,
+	}
+	if provider, ok := factory.(ConnConfigProvider); ok && provider.ConnConfig() != nil {
+		m.txDefaults, m.configErr = txDefaultsOf(provider.ConnConfig())
 	}
+	if factory != nil {
+		m.key = transactionKeyOf(m.GetOriginDB())
+		registerStatsCallbacks(m.GetOriginDB())
+		registerStatementBudgetCallbacks(m.GetOriginDB())
+		registerReadRetryCallbacks(m.GetOriginDB())
+		registerDryRunCallbacks(m.GetOriginDB())
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	// the watchdog starts once the options are applied, WithClock included
+	if m.watchdog != nil && m.configErr == nil {
+		go m.watchdog.run(m)
+	}
+	return m
 }
 
 func (m *transactionManager) GetDB(ctx context.Context) *gorm.DB {
-	if txCtx, ok := ctx.(*transactionContext); ok && txCtx.tx != nil {
+	if txCtx, ok := m.transactionOf(ctx); ok {
 		return txCtx.tx
 	}
 	return m.getPureDB(ctx)
@@ -131,159 +387,333 @@ func (m *transactionManager) GetOriginDB() *gorm.DB {
 	return m.dBFactory.GetOriginDB()
 }
 
+// transactionOf return the transaction context of ctx if ctx is in a transaction on the datasource of m
+func (m *transactionManager) transactionOf(ctx context.Context) (*transactionContext, bool) {
+	txCtx, ok := ctx.Value(m.key).(*transactionContext)
+	return txCtx, ok
+}
+
+// withoutTransaction return ctx hiding the transaction of the datasource of m
+func (m *transactionManager) withoutTransaction(ctx context.Context) context.Context {
+	if _, ok := m.transactionOf(ctx); !ok {
+		return ctx
+	}
+	return context.WithValue(ctx, m.key, nil)
+}
+
 func (m *transactionManager) getPureDB(ctx context.Context) *gorm.DB {
 	return m.dBFactory.GetDB(ctx)
 }
 
-func (m *transactionManager) Transaction(ctx context.Context, bizFn func(ctx context.Context, tx *gorm.DB) error, propagations ...TransactionPropagation) error {
-	propagation := defaultPropagation()
-	if len(propagations) > 0 {
-		propagation = propagations[0]
+func (m *transactionManager) Transaction(ctx context.Context, bizFn func(ctx context.Context, tx *gorm.DB) error, opts ...TxOption) error {
+	o := m.newTxOptions(opts)
+	if m.guardrails != nil {
+		o.callsite = callsite()
+	}
+	if o.name == "" && (m.callerNames || len(m.interceptors) > 0) {
+		o.name = callerName()
+	}
+	return m.transaction(ctx, bizFn, o)
+}
+
+// transaction runs bizFn with the options o of a Transaction or Begin call
+func (m *transactionManager) transaction(ctx context.Context, bizFn func(ctx context.Context, tx *gorm.DB) error, o *txOptions) error {
+	if m.configErr != nil {
+		return m.configErr
 	}
+	propagation := o.propagation
+	if len(m.interceptors) > 0 {
+		_, inTransaction := m.transactionOf(ctx)
+		var err error
+		call := PropagationCall{Name: o.name, Propagation: propagation, InTransaction: inTransaction}
+		if propagation, err = m.interceptPropagation(ctx, call); err != nil {
+			return err
+		}
+	}
+	if txCtx, ok := m.transactionOf(ctx); ok {
+		if err := m.checkAge(txCtx); err != nil {
+			return err
+		}
+		if err := m.checkDepth(txCtx); err != nil {
+			return err
+		}
+	}
+	if _, ok := m.transactionOf(ctx); ok && m.forcedPropagation != nil {
+		propagation = *m.forcedPropagation
+	}
+	if txCtx, ok := m.transactionOf(ctx); ok && o.commitToken != nil && propagation.joins() {
+		// registered by the call itself, so it's discarded with the synchronizations of a rolled back nested call
+		joinedFn := bizFn
+		bizFn = func(ctx context.Context, tx *gorm.DB) error {
+			m.registerCommitToken(txCtx, o.commitToken)
+			return joinedFn(ctx, tx)
+		}
+	}
+	_, ownTransaction := m.transactionOf(ctx)
+	if _, ok := currentTransaction(ctx); ok && !ownTransaction {
+		var err error
+		if propagation, err = m.crossDatasourcePropagation(propagation); err != nil {
+			return err
+		}
+	}
+	m.markAlwaysRollback(ctx, propagation, o)
 	switch propagation {
 	case PropagationRequired:
-		return m.withRequiredPropagation(ctx, bizFn)
+		return m.withRequiredPropagation(ctx, bizFn, o)
 	case PropagationSupports:
-		return m.withSupportsPropagation(ctx, bizFn)
+		return m.withSupportsPropagation(ctx, bizFn, o)
 	case PropagationMandatory:
-		return m.withMandatoryPropagation(ctx, bizFn)
+		return m.withMandatoryPropagation(ctx, bizFn, o)
 	case PropagationRequiresNew:
-		return m.withRequiresNewPropagation(ctx, bizFn)
+		return m.withRequiresNewPropagation(ctx, bizFn, o)
 	case PropagationNotSupported:
-		return m.withNotSupportedPropagation(ctx, bizFn)
+		return m.withNotSupportedPropagation(ctx, bizFn, o)
 	case PropagationNested:
-		return m.withNestedPropagation(ctx, bizFn)
+		return m.withNestedPropagation(ctx, bizFn, o)
 	case PropagationNever:
-		return m.withNeverPropagation(ctx, bizFn)
+		return m.withNeverPropagation(ctx, bizFn, o)
 	default:
 		panic("not supported propagation")
 	}
 }
 
-func (m *transactionManager) withNeverPropagation(ctx context.Context, bizFn func(ctx context.Context, tx *gorm.DB) error) error {
-	if txCtx, ok := ctx.(*transactionContext); ok && txCtx.InTransaction() {
+func (m *transactionManager) withNeverPropagation(ctx context.Context, bizFn func(ctx context.Context, tx *gorm.DB) error, o *txOptions) error {
+	if _, ok := m.transactionOf(ctx); ok {
 		return ErrNeverPropInTransaction
 	}
+	if m.rollsBackAlways(o) {
+		return m.withoutTransactionRollback(ctx, bizFn, o)
+	}
 
 	db := m.getPureDB(ctx)
 	return bizFn(ctx, db)
 }
 
-func (m *transactionManager) withNestedPropagation(ctx context.Context, bizFn func(ctx context.Context, tx *gorm.DB) error) error {
+func (m *transactionManager) withNestedPropagation(ctx context.Context, bizFn func(ctx context.Context, tx *gorm.DB) error, o *txOptions) error {
 	var err error
-	if txCtx, ok := ctx.(*transactionContext); ok && txCtx.InTransaction() {
+	if txCtx, ok := m.transactionOf(ctx); ok {
+		if o.singleStatement && !o.alwaysRollback {
+			return m.withSingleStatement(ctx, txCtx, bizFn, o)
+		}
 		panicked := true
 		db := txCtx.TxDB()
-		if !db.DisableNestedTransaction {
-			err = db.SavePoint(fmt.Sprintf("sp%p", bizFn)).Error
+		if !db.DisableNestedTransaction && !m.savepointsDisabled {
+			savepoint := m.nextSavepoint(txCtx)
+			dialect := savepointDialectOf(db)
+			afterCommitMark, labelMark := len(txCtx.root().afterCommit), len(txCtx.root().labels)
+			err = dialect.Savepoint(db, savepoint)
+			if err == nil {
+				err = txCtx.savepointResources(savepoint)
+			}
+			if err == nil && o.savepointLabel != "" {
+				txCtx.labelSavepoint(o.savepointLabel, savepoint)
+			}
 			defer func() {
 				// Make sure to rollback when panic, Block error or Commit error
-				if panicked || err != nil {
-					db.RollbackTo(fmt.Sprintf("sp%p", bizFn))
+				if panicked || o.alwaysRollback || err != nil && m.rollsBack(o, err) {
+					_ = dialect.RollbackTo(db, savepoint)
+					txCtx.rollbackResourcesTo(savepoint)
+					txCtx.discardAfterCommit(afterCommitMark)
+					txCtx.discardLabels(labelMark)
+				} else if !m.keepSavepoints && len(txCtx.root().labels) == labelMark {
+					// releasing drops the savepoints after it as well, labeled ones must stay for RollbackToLabel
+					_ = dialect.Release(db, savepoint)
 				}
 			}()
 		}
 		if err == nil {
-			err = bizFn(txCtx.Session(), txCtx.TxDB())
+			err = bizFn(txCtx.Session(ctx, PropagationNested), txCtx.TxDB())
 		}
 		panicked = false
 	} else {
-		err = m.withRequiredPropagation(ctx, bizFn)
+		err = m.withoutOuterTransaction(ctx, bizFn, o)
 	}
 	return err
 }
 
-func (m *transactionManager) withRequiredPropagation(ctx context.Context, bizFn func(ctx context.Context, tx *gorm.DB) error) error {
-	var err error
-	panicked := true
-	if txCtx, ok := ctx.(*transactionContext); ok && txCtx.InTransaction() {
-		// There is no need to handle errors and panics here, the outer transaction manager will handle it
-		err = bizFn(txCtx.Session(), txCtx.tx)
-	} else {
-		var db *gorm.DB
-		db = m.getPureDB(ctx)
-		if !ok {
-			txCtx = &transactionContext{
-				ctx: ctx,
-				tx:  db.Begin(),
-			}
-		} else {
-			txCtx.tx = db.Begin()
-		}
-		defer func() {
-			if panicked || err != nil {
-				txCtx.Rollback()
-			}
-		}()
-		if err = txCtx.TxError(); err == nil {
-			err = bizFn(txCtx, txCtx.tx)
-		}
+// withoutOuterTransaction runs a PropagationNested call without enclosing transaction according to the
+// NestedFallbackPolicy of m
+func (m *transactionManager) withoutOuterTransaction(ctx context.Context, bizFn func(ctx context.Context, tx *gorm.DB) error, o *txOptions) error {
+	switch m.nestedFallback {
+	case NestedFallbackReject:
+		return ErrNestedPropWithoutTransaction
+	case NestedFallbackSavepoint:
+		return m.runRoot(ctx, m.getPureDB(ctx), func(ctx context.Context, tx *gorm.DB) error {
+			return m.withNestedPropagation(ctx, bizFn, o)
+		}, o)
+	default:
+		return m.withRequiredPropagation(ctx, bizFn, o)
+	}
+}
 
-		if err == nil {
-			err = txCtx.Commit()
-		}
+func (m *transactionManager) withRequiredPropagation(ctx context.Context, bizFn func(ctx context.Context, tx *gorm.DB) error, o *txOptions) error {
+	if txCtx, ok := m.transactionOf(ctx); ok {
+		// There is no need to handle errors and panics here, the outer transaction manager will handle it
+		return bizFn(txCtx.Session(ctx, PropagationRequired), txCtx.tx)
 	}
-	panicked = false
-	return err
+	return m.runRoot(ctx, m.getPureDB(ctx), bizFn, o)
 }
 
-func (m *transactionManager) withRequiresNewPropagation(ctx context.Context, bizFn func(ctx context.Context, tx *gorm.DB) error) error {
-	panicked := true
-	var pureCtx context.Context
-	if txCtx, ok := ctx.(*transactionContext); ok {
-		pureCtx = txCtx.Ctx()
-	} else {
-		pureCtx = ctx
+func (m *transactionManager) withRequiresNewPropagation(ctx context.Context, bizFn func(ctx context.Context, tx *gorm.DB) error, o *txOptions) (err error) {
+	suspended, ctx, err := m.suspend(ctx)
+	if err != nil {
+		return err
 	}
-	var err error
-	db := m.getPureDB(pureCtx)
+	defer func() {
+		if resumeErr := suspended.resume(); err == nil {
+			err = resumeErr
+		}
+	}()
+	return m.runRoot(ctx, m.getPureDB(ctx), bizFn, o)
+}
 
+// runRoot runs bizFn in a new root transaction begun on db
+func (m *transactionManager) runRoot(ctx context.Context, db *gorm.DB, bizFn func(ctx context.Context, tx *gorm.DB) error, o *txOptions) (err error) {
+	if m.metadataLockCheck != nil && len(o.writeTables) > 0 {
+		if err = m.metadataLockCheck.await(ctx, m.clock, db, o.writeTables); err != nil {
+			return err
+		}
+	}
+	if m.schemaVersionGuard != nil {
+		if err = m.schemaVersionGuard.check(ctx, m.clock, db); err != nil {
+			return err
+		}
+	}
+	if m.quotaChecker != nil {
+		if err = m.admit(ctx, o); err != nil {
+			return err
+		}
+	}
+	budget := budgetOf(ctx)
+	if err = budget.enter(m.clock); err != nil {
+		return err
+	}
+	defer budget.exit()
+	info := TransactionInfo{ID: m.idGenerator.NewID(), Name: o.name, Propagation: o.propagation}
+	ctx = m.transactionStarted(ctx, info)
+	panicked := true
+	var timings TransactionTimings
+	beginAt := m.clock.Now()
+	tx, conn := m.begin(ctx, db, o.sqlTxOptions())
 	txCtx := &transactionContext{
-		ctx: ctx,
-		tx:  db.Begin(),
+		tx:          tx,
+		id:          info.ID,
+		startedAt:   beginAt,
+		propagation: o.propagation,
+		ctx:         ctx,
+		conn:        conn,
+		datasource:  m.GetOriginDB(),
+		key:         m.key,
+	}
+	timings.Begin = m.since(beginAt)
+	if m.traceSink != nil {
+		txCtx.trace = txCtx.recordTrace(m.clock.Now())
+	}
+	if m.dualWrite != nil {
+		startDualWrite(txCtx)
 	}
+	if o.session != nil {
+		txCtx.tx = txCtx.tx.Session(o.session)
+	}
+	// bind tx to txCtx, so gorm hooks can reach the transaction by tx.Statement.Context
+	txCtx.tx = txCtx.tx.WithContext(txCtx)
+	if m.watchdog != nil {
+		defer m.watchdog.watch(txCtx, info)()
+	}
+	if o.commitToken != nil {
+		m.registerCommitToken(txCtx, o.commitToken)
+	}
+	bodyAt := m.clock.Now()
+	// kept is an error of bizFn committed according to the rollback rules
+	var kept error
+	committed, dryRun := false, false
 	defer func() {
-		if panicked || err != nil {
-			txCtx.Rollback()
+		if panicked || dryRun || err != nil && !committed {
+			if timings.Body == 0 {
+				timings.Body = m.since(bodyAt)
+			}
+			rollbackAt := m.clock.Now()
+			if rollbackErr := txCtx.Rollback(); rollbackErr != nil {
+				err = m.rollbackFailed(ctx, info, err, rollbackErr)
+			}
+			timings.Completion += m.since(rollbackAt)
+			if txCtx.trace != nil {
+				m.writeTrace(txCtx.trace, err)
+			}
 		}
+		txCtx.releaseConn()
+		txCtx.unbindTxResources()
+		m.transactionTimed(ctx, info, timings)
+		m.transactionFinished(ctx, info, err, panicked)
 	}()
 	if err = txCtx.TxError(); err == nil {
-		err = bizFn(txCtx, txCtx.tx)
+		err = m.startRoot(txCtx, o)
 	}
-
 	if err == nil {
+		if err = bizFn(txCtx, txCtx.tx); err != nil && !m.rollsBack(o, err) {
+			kept, err = err, nil
+		}
+	}
+
+	if err == nil && (m.rollsBackAlways(o) || txCtx.alwaysRollback) {
+		timings.Body = m.since(bodyAt)
+		dryRun = true
+	} else if err == nil {
+		timings.Body = m.since(bodyAt)
+		commitAt := m.clock.Now()
 		err = txCtx.Commit()
+		committed = err == nil
+		if err != nil {
+			committed, err = m.resolveCommitOutcome(ctx, txCtx, info, err)
+		}
+		if err != nil {
+			err = &CommitError{Name: info.Name, Cause: err}
+		}
+		timings.Completion = m.since(commitAt)
 	}
 	panicked = false
+	if committed && m.dualWrite != nil {
+		m.mirrorWrites(txCtx)
+	}
+	if err == nil {
+		err = kept
+	}
 	return err
 }
 
-func (m *transactionManager) withSupportsPropagation(ctx context.Context, bizFn func(ctx context.Context, tx *gorm.DB) error) error {
-	if txCtx, ok := ctx.(*transactionContext); ok && txCtx.InTransaction() {
+func (m *transactionManager) withSupportsPropagation(ctx context.Context, bizFn func(ctx context.Context, tx *gorm.DB) error, o *txOptions) error {
+	if txCtx, ok := m.transactionOf(ctx); ok {
 		// There is no need to handle errors and panics because the outer transaction manager will handle it
-		return bizFn(txCtx.Session(), txCtx.tx)
+		return bizFn(txCtx.Session(ctx, PropagationSupports), txCtx.tx)
+	} else if m.rollsBackAlways(o) {
+		return m.withoutTransactionRollback(ctx, bizFn, o)
 	} else {
 		db := m.getPureDB(ctx)
 		return bizFn(ctx, db)
 	}
 }
 
-func (m *transactionManager) withMandatoryPropagation(ctx context.Context, bizFn func(ctx context.Context, tx *gorm.DB) error) error {
-	if txCtx, ok := ctx.(*transactionContext); ok && txCtx.InTransaction() {
+func (m *transactionManager) withMandatoryPropagation(ctx context.Context, bizFn func(ctx context.Context, tx *gorm.DB) error, o *txOptions) error {
+	if txCtx, ok := m.transactionOf(ctx); ok {
 		// There is no need to handle errors and panics because the outer transaction manager will handle it
-		return bizFn(txCtx.Session(), txCtx.tx)
+		return bizFn(txCtx.Session(ctx, PropagationMandatory), txCtx.tx)
 	} else {
 		return ErrMandatoryPropWithoutTransaction
 	}
 }
 
-func (m *transactionManager) withNotSupportedPropagation(ctx context.Context, bizFn func(ctx context.Context, tx *gorm.DB) error) error {
-	var pureCtx context.Context
-	if txCtx, ok := ctx.(*transactionContext); ok {
-		pureCtx = txCtx.Ctx()
-	} else {
-		pureCtx = ctx
+func (m *transactionManager) withNotSupportedPropagation(ctx context.Context, bizFn func(ctx context.Context, tx *gorm.DB) error, o *txOptions) (err error) {
+	suspended, ctx, err := m.suspend(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if resumeErr := suspended.resume(); err == nil {
+			err = resumeErr
+		}
+	}()
+	if m.rollsBackAlways(o) {
+		return m.withoutTransactionRollback(ctx, bizFn, o)
 	}
-	db := m.getPureDB(pureCtx)
-	return bizFn(pureCtx, db)
+	return bizFn(ctx, m.getPureDB(ctx))
 }
@@ -6,6 +6,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"gorm.io/gorm"
 	"testing"
+	"time"
 )
 
 var (
@@ -442,6 +443,208 @@ func TestTransactionManager_Transaction_PropagationNever(t *testing.T) {
 	})
 }
 
+func TestTransactionManager_Transaction_ForcedPropagation(t *testing.T) {
+	forcedTm := NewTransactionManager(factory, WithForcedPropagation(PropagationRequired))
+	DefaultTransactionTest("test-requires-new-joins-outer", t, func() {
+		ctx := context.Background()
+		_ = forcedTm.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+			tx.Create(user1)
+
+			_ = forcedTm.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+				tx.Create(user2)
+				return nil
+			}, PropagationRequiresNew)
+
+			AssertNotExist(t, user2)
+			return mockErr
+		}, PropagationRequired)
+	}, func(t *testing.T) {
+		AssertNotExist(t, user1)
+		AssertNotExist(t, user2)
+	})
+}
+
+func TestTransactionManager_Transaction_PropagationInterceptor(t *testing.T) {
+	interceptedTm := NewTransactionManager(factory, WithPropagationInterceptors(ForbidRequiresNewInTransaction("audit")))
+	DefaultTransactionTest("test-requires-new-rejected", t, func() {
+		ctx := context.Background()
+		_ = interceptedTm.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+			tx.Create(user1)
+
+			err := interceptedTm.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+				tx.Create(user2)
+				return nil
+			}, PropagationRequiresNew)
+			assert.ErrorIs(t, err, ErrPropagationRejected)
+
+			return interceptedTm.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+				tx.Create(user3)
+				return nil
+			}, PropagationRequiresNew, WithName("audit"))
+		}, PropagationRequired)
+	}, func(t *testing.T) {
+		AssertExist(t, user1)
+		AssertNotExist(t, user2)
+		AssertExist(t, user3)
+	})
+}
+
+func TestTransactionManager_Transaction_InterleavedDatasources(t *testing.T) {
+	// same database behind another pool, so it's another datasource
+	otherFactory, _ := NewConfigDBFactory(&ConnConfig{Host: "localhost", Port: 3306, Database: "pt", User: "root", Password: "123456"})
+	otherTm := NewTransactionManager(otherFactory)
+
+	DefaultTransactionTest("test-join-own-transaction-across-other", t, func() {
+		ctx := context.Background()
+		_ = tm.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+			tx.Create(user1)
+
+			_ = otherTm.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+				tx.Create(user2)
+
+				return tm.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+					tx.Create(user3)
+					return nil
+				}, PropagationRequired)
+			}, PropagationRequired)
+			return mockErr
+		}, PropagationRequired)
+	}, func(t *testing.T) {
+		AssertNotExist(t, user1)
+		AssertExist(t, user2)
+		AssertNotExist(t, user3)
+	})
+
+	DefaultTransactionTest("test-interleaved-joins", t, func() {
+		ctx := context.Background()
+		_ = tm.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+			tx.Create(user1)
+
+			_ = otherTm.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+				tx.Create(user2)
+
+				_ = tm.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+					tx.Create(user3)
+
+					return otherTm.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+						tx.Create(user4)
+						return nil
+					}, PropagationRequired)
+				}, PropagationRequired)
+				return mockErr
+			}, PropagationRequired)
+			return nil
+		}, PropagationRequired)
+	}, func(t *testing.T) {
+		AssertExist(t, user1)
+		AssertNotExist(t, user2)
+		AssertExist(t, user3)
+		AssertNotExist(t, user4)
+	})
+}
+
+func TestTransactionManager_Transaction_RollbackRules(t *testing.T) {
+	DefaultTransactionTest("test-no-rollback-for-commits", t, func() {
+		err := tm.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+			tx.Create(user1)
+			return mockErr
+		}, PropagationRequired, NoRollbackFor(ErrorIs(mockErr)))
+		assert.ErrorIs(t, err, mockErr)
+	}, func(t *testing.T) {
+		AssertExist(t, user1)
+	})
+
+	DefaultTransactionTest("test-no-rollback-for-keeps-savepoint", t, func() {
+		_ = tm.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+			tx.Create(user1)
+
+			_ = tm.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+				tx.Create(user2)
+				return mockErr
+			}, PropagationNested, NoRollbackFor(ErrorIs(mockErr)))
+
+			_ = tm.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+				tx.Create(user3)
+				return mockErr
+			}, PropagationNested)
+			return nil
+		}, PropagationRequired)
+	}, func(t *testing.T) {
+		AssertExist(t, user1)
+		AssertExist(t, user2)
+		AssertNotExist(t, user3)
+	})
+}
+
+func TestTransactionManager_Begin(t *testing.T) {
+	DefaultTransactionTest("test-begin-commit", t, func() {
+		txn, err := tm.Begin(context.Background())
+		assert.NoError(t, err)
+		defer txn.Rollback()
+		txn.DB().Create(user1)
+		assert.NoError(t, txn.Savepoint("user2"))
+		tm.GetDB(txn.Context()).Create(user2)
+		assert.NoError(t, txn.RollbackTo("user2"))
+		assert.NoError(t, txn.Commit())
+		assert.ErrorIs(t, txn.Commit(), ErrTxnCompleted)
+	}, func(t *testing.T) {
+		AssertExist(t, user1)
+		AssertNotExist(t, user2)
+	})
+
+	DefaultTransactionTest("test-begin-rollback", t, func() {
+		txn, err := tm.Begin(context.Background())
+		assert.NoError(t, err)
+		txn.DB().Create(user1)
+		assert.NoError(t, txn.Rollback())
+	}, func(t *testing.T) {
+		AssertNotExist(t, user1)
+	})
+}
+
+func TestTransactionManager_Transaction_AlwaysRollback(t *testing.T) {
+	DefaultTransactionTest("test-always-rollback-root", t, func() {
+		err := tm.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+			tx.Create(user1)
+			return tm.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+				tx.Create(user2)
+				return nil
+			}, PropagationNotSupported)
+		}, PropagationRequired, AlwaysRollback())
+		assert.NoError(t, err)
+	}, func(t *testing.T) {
+		AssertNotExist(t, user1)
+		AssertExist(t, user2)
+	})
+
+	DefaultTransactionTest("test-always-rollback-nested", t, func() {
+		_ = tm.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+			tx.Create(user1)
+			return tm.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+				tx.Create(user2)
+				return nil
+			}, PropagationNested, AlwaysRollback())
+		}, PropagationRequired)
+	}, func(t *testing.T) {
+		AssertExist(t, user1)
+		AssertNotExist(t, user2)
+	})
+
+	dryRunTm := NewTransactionManager(factory, WithAlwaysRollback())
+	DefaultTransactionTest("test-always-rollback-manager", t, func() {
+		_ = dryRunTm.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+			tx.Create(user1)
+			return dryRunTm.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+				tx.Create(user2)
+				return nil
+			}, PropagationNotSupported)
+		}, PropagationRequired)
+	}, func(t *testing.T) {
+		AssertNotExist(t, user1)
+		AssertNotExist(t, user2)
+	})
+}
+
 func DefaultTransactionTest(name string, t *testing.T, testFn func(), checkFn func(t *testing.T)) {
 	TransactionTest(name, t, func() { clearData() }, func() { clearData() }, testFn, checkFn)
 }
@@ -482,3 +685,265 @@ func AssertErrorsIsEqual(t *testing.T, err1, err2 error) {
 func clearData() {
 	db.Delete(User{}, "1=1")
 }
+
+func TestTransactionManager_Transaction_CommitValidators(t *testing.T) {
+	validatedTm := NewTransactionManager(factory, WithCommitValidators(func(ctx context.Context, tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&User{}).Where("username = ?", user2.Username).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return mockErr
+		}
+		return nil
+	}))
+	DefaultTransactionTest("test-commit-validators-valid", t, func() {
+		err := validatedTm.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+			return tx.Create(user1).Error
+		}, PropagationRequired)
+		assert.NoError(t, err)
+	}, func(t *testing.T) {
+		AssertExist(t, user1)
+	})
+
+	DefaultTransactionTest("test-commit-validators-invalid", t, func() {
+		err := validatedTm.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+			tx.Create(user1)
+			return validatedTm.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+				return tx.Create(user2).Error
+			}, PropagationRequired)
+		}, PropagationRequired)
+		var commitErr *CommitError
+		assert.ErrorAs(t, err, &commitErr)
+		assert.ErrorIs(t, err, mockErr)
+	}, func(t *testing.T) {
+		AssertNotExist(t, user1)
+		AssertNotExist(t, user2)
+	})
+}
+
+func TestXATransactionManager(t *testing.T) {
+	xa, err := NewXATransactionManager("test", factory, factory)
+	assert.NoError(t, err)
+	assert.NoError(t, xa.Recover(context.Background()))
+	DefaultTransactionTest("test-xa-commit", t, func() {
+		err := xa.Transaction(context.Background(), func(ctx context.Context, txs []*gorm.DB) error {
+			if err := txs[0].Create(user1).Error; err != nil {
+				return err
+			}
+			return txs[1].Create(user2).Error
+		})
+		assert.NoError(t, err)
+	}, func(t *testing.T) {
+		AssertExist(t, user1)
+		AssertExist(t, user2)
+	})
+
+	DefaultTransactionTest("test-xa-rollback", t, func() {
+		err := xa.Transaction(context.Background(), func(ctx context.Context, txs []*gorm.DB) error {
+			txs[0].Create(user1)
+			txs[1].Create(user2)
+			return mockErr
+		})
+		assert.ErrorIs(t, err, mockErr)
+	}, func(t *testing.T) {
+		AssertNotExist(t, user1)
+		AssertNotExist(t, user2)
+	})
+}
+
+func TestTransactionManager_Idempotent(t *testing.T) {
+	key := "test-idempotent"
+	db.Exec("DELETE FROM ptx_idempotency WHERE idempotency_key = ?", key)
+	defer db.Exec("DELETE FROM ptx_idempotency WHERE idempotency_key = ?", key)
+	calls := 0
+	fn := func(ctx context.Context, tx *gorm.DB) ([]byte, error) {
+		calls++
+		return []byte(user1.Username), tx.Create(user1).Error
+	}
+	DefaultTransactionTest("test-idempotent", t, func() {
+		result, err := tm.Idempotent(context.Background(), key, fn)
+		assert.NoError(t, err)
+		assert.Equal(t, user1.Username, string(result))
+		result, err = tm.Idempotent(context.Background(), key, fn)
+		assert.ErrorIs(t, err, ErrDuplicateRequest)
+		assert.Equal(t, user1.Username, string(result))
+	}, func(t *testing.T) {
+		AssertExist(t, user1)
+		assert.Equal(t, 1, calls)
+	})
+}
+
+// sessionFactory is a DBFactory of a session of another *gorm.DB, sharing its pool
+type sessionFactory struct {
+	db *gorm.DB
+}
+
+func (f sessionFactory) GetDB(ctx context.Context) *gorm.DB {
+	return f.db.WithContext(ctx)
+}
+
+func (f sessionFactory) GetOriginDB() *gorm.DB {
+	return f.db
+}
+
+func TestTransactionManager_Transaction_SharedPool(t *testing.T) {
+	sessionTm := NewTransactionManager(sessionFactory{db: factory.GetOriginDB().Session(&gorm.Session{QueryFields: true})})
+	DefaultTransactionTest("test-join-across-managers", t, func() {
+		_ = tm.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+			tx.Create(user1)
+			_ = sessionTm.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+				tx.Create(user2)
+				return nil
+			}, PropagationRequired)
+			return mockErr
+		}, PropagationRequired)
+	}, func(t *testing.T) {
+		AssertNotExist(t, user1)
+		AssertNotExist(t, user2)
+	})
+}
+
+func TestTxGroup(t *testing.T) {
+	DefaultTransactionTest("test-tx-group-shared", t, func() {
+		_ = tm.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+			group := NewTxGroup(ctx, tm, TxGroupShared)
+			for _, user := range []*User{user1, user2} {
+				user := user
+				group.Go(func(ctx context.Context, tx *gorm.DB) error {
+					return tx.Create(user).Error
+				})
+			}
+			assert.NoError(t, group.Wait())
+			return mockErr
+		}, PropagationRequired)
+	}, func(t *testing.T) {
+		AssertNotExist(t, user1)
+		AssertNotExist(t, user2)
+	})
+
+	DefaultTransactionTest("test-tx-group-requires-new", t, func() {
+		_ = tm.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+			group := NewTxGroup(ctx, tm, TxGroupRequiresNew)
+			for _, user := range []*User{user1, user2} {
+				user := user
+				group.Go(func(ctx context.Context, tx *gorm.DB) error {
+					return tx.Create(user).Error
+				})
+			}
+			assert.NoError(t, group.Wait())
+			return mockErr
+		}, PropagationRequired)
+	}, func(t *testing.T) {
+		AssertExist(t, user1)
+		AssertExist(t, user2)
+	})
+}
+
+func TestTransactionManager_Transaction_CrossDatasourcePolicy(t *testing.T) {
+	otherFactory, _ := NewConfigDBFactory(&ConnConfig{Host: "localhost", Port: 3306, Database: "pt", User: "root", Password: "123456"})
+	strictTm := NewTransactionManager(otherFactory, WithCrossDatasourcePolicy(CrossDatasourceError))
+
+	DefaultTransactionTest("test-reject-foreign-transaction", t, func() {
+		_ = tm.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+			tx.Create(user1)
+			err := strictTm.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+				return tx.Create(user2).Error
+			}, PropagationRequired)
+			assert.ErrorIs(t, err, ErrCrossDatasourceTransaction)
+			return nil
+		}, PropagationRequired)
+	}, func(t *testing.T) {
+		AssertExist(t, user1)
+		AssertNotExist(t, user2)
+	})
+}
+
+func TestTransactional(t *testing.T) {
+	type userService struct {
+		Create func(ctx context.Context, users ...*User) error
+	}
+	impl := userService{Create: func(ctx context.Context, users ...*User) error {
+		for _, user := range users {
+			if err := tm.GetDB(ctx).Create(user).Error; err != nil {
+				return err
+			}
+		}
+		return mockErr
+	}}
+	svc, err := Transactional(impl, tm, map[string]TxRule{"Create": {PropagationRequired}})
+	assert.NoError(t, err)
+	DefaultTransactionTest("test-transactional", t, func() {
+		assert.ErrorIs(t, svc.Create(context.Background(), user1, user2), mockErr)
+		assert.ErrorIs(t, impl.Create(context.Background(), user3), mockErr)
+	}, func(t *testing.T) {
+		AssertNotExist(t, user1)
+		AssertNotExist(t, user2)
+		AssertExist(t, user3)
+	})
+}
+
+// recordingResource is a ResourceManager recording the outcome of its transactions
+type recordingResource struct {
+	outcomes []string
+}
+
+func (r *recordingResource) Begin(context.Context) (ResourceTransaction, error) {
+	return recordingResourceTx{r}, nil
+}
+
+type recordingResourceTx struct {
+	r *recordingResource
+}
+
+func (tx recordingResourceTx) Commit(context.Context) error {
+	tx.r.outcomes = append(tx.r.outcomes, "commit")
+	return nil
+}
+
+func (tx recordingResourceTx) Rollback(context.Context) error {
+	tx.r.outcomes = append(tx.r.outcomes, "rollback")
+	return nil
+}
+
+func TestTransactionManager_Transaction_DerivedContext(t *testing.T) {
+	resource := &recordingResource{}
+	resourceTm := NewTransactionManager(factory, WithResources(resource))
+	DefaultTransactionTest("test-derived-ctx", t, func() {
+		resource.outcomes = nil
+		_ = resourceTm.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+			derived, cancel := context.WithTimeout(context.WithValue(ctx, derivedKey{}, user1.Username), time.Minute)
+			defer cancel()
+			assert.NotNil(t, ResourceTx(derived, resource))
+			_, ok := TxResourcesOf(derived)
+			assert.True(t, ok)
+			assert.NotEmpty(t, TxID(derived))
+			assert.Equal(t, TxID(ctx), TxID(derived))
+			assert.True(t, TxStatus(derived).Active)
+			_, ok = TxStats(derived)
+			assert.True(t, ok)
+			assert.NoError(t, WithTempTable(derived, "tmp_derived", "id INT", func(ctx context.Context, tx *gorm.DB) error {
+				return nil
+			}))
+			statements, err := ValidateWrites(derived, func(tx *gorm.DB) error {
+				return tx.Create(user2).Error
+			})
+			assert.NoError(t, err)
+			assert.Len(t, statements, 1)
+			assert.NoError(t, resourceTm.(NonTxDBFactory).GetNonTxDB(derived).Create(user1).Error)
+			_ = resourceTm.Transaction(derived, func(ctx context.Context, tx *gorm.DB) error {
+				derived := context.WithValue(ctx, derivedKey{}, user2.Username)
+				assert.Empty(t, TxID(derived))
+				assert.Nil(t, ResourceTx(derived, resource))
+				assert.ErrorIs(t, SetRollbackOnly(derived), ErrNoTransaction)
+				return nil
+			}, PropagationNotSupported)
+			assert.NoError(t, SetRollbackOnly(derived))
+			return nil
+		}, PropagationRequired)
+	}, func(t *testing.T) {
+		AssertExist(t, user1)
+		AssertNotExist(t, user2)
+		assert.Equal(t, []string{"rollback"}, resource.outcomes)
+	})
+}
@@ -0,0 +1,90 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"reflect"
+)
+
+// TxRule are the options of the transaction of a method wrapped by Transactional, e.g.
+// TxRule{PropagationRequiresNew, WithReadOnly(true)}
+type TxRule []TxOption
+
+// ErrNotTransactional is returned by Transactional for a T or a rule it can't wrap in transactions
+var ErrNotTransactional = errors.New("not transactional")
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// Transactional return a copy of impl whose methods named in rules run in tm.Transaction with the options of their
+// rule, the others are left as they are. The repositories called by a method join its transaction through its ctx.
+//
+// Go can't implement an interface at runtime, so the methods are the exported func fields of a struct T:
+//
+//	type OrderService struct {
+//		Place func(ctx context.Context, order *Order) error
+//		Quote func(ctx context.Context, id int64) (*Quote, error)
+//	}
+//	svc, err := sql.Transactional(impl, tm, map[string]sql.TxRule{"Quote": {sql.PropagationRequiresNew, sql.WithReadOnly(true)}})
+//
+// Interface-based services get the same decorator from propagation-tx-gen. A wrapped method must take a
+// context.Context first and return an error last, Transactional return ErrNotTransactional and impl unchanged on a T
+// or a rule it can't apply.
+func Transactional[T any](impl T, tm TransactionManager, rules map[string]TxRule) (T, error) {
+	wrapped := impl
+	v := reflect.ValueOf(&wrapped).Elem()
+	if v.Kind() != reflect.Struct {
+		return impl, fmt.Errorf("%w: %s isn't a struct of func fields, generate its decorator with propagation-tx-gen",
+			ErrNotTransactional, v.Type())
+	}
+	for name, rule := range rules {
+		field := v.FieldByName(name)
+		if !field.IsValid() || !field.CanSet() || field.Kind() != reflect.Func || field.IsNil() {
+			return impl, fmt.Errorf("%w: %s.%s isn't an exported non-nil func field", ErrNotTransactional, v.Type(), name)
+		}
+		ft := field.Type()
+		if ft.NumIn() == 0 || ft.In(0) != contextType || ft.NumOut() == 0 || ft.Out(ft.NumOut()-1) != errorType {
+			return impl, fmt.Errorf("%w: %s.%s must take a context.Context first and return an error last",
+				ErrNotTransactional, v.Type(), name)
+		}
+		// the wrapper calls a copy of the func, not the field it replaces
+		field.Set(transactionalFunc(reflect.ValueOf(field.Interface()), tm, rule))
+	}
+	return wrapped, nil
+}
+
+// transactionalFunc return fn running in tm.Transaction with rule
+func transactionalFunc(fn reflect.Value, tm TransactionManager, rule TxRule) reflect.Value {
+	ft := fn.Type()
+	return reflect.MakeFunc(ft, func(args []reflect.Value) []reflect.Value {
+		var results []reflect.Value
+		ctx, _ := args[0].Interface().(context.Context)
+		err := tm.Transaction(ctx, func(ctx context.Context, _ *gorm.DB) error {
+			args[0] = reflect.ValueOf(&ctx).Elem()
+			if ft.IsVariadic() {
+				results = fn.CallSlice(args)
+			} else {
+				results = fn.Call(args)
+			}
+			err, _ := results[len(results)-1].Interface().(error)
+			return err
+		}, rule...)
+		// fn didn't run when the propagation failed
+		if results == nil {
+			results = make([]reflect.Value, ft.NumOut())
+			for i := range results {
+				results[i] = reflect.Zero(ft.Out(i))
+			}
+		}
+		if err != nil {
+			results[len(results)-1] = reflect.ValueOf(&err).Elem()
+		} else {
+			results[len(results)-1] = reflect.Zero(errorType)
+		}
+		return results
+	})
+}
@@ -0,0 +1,71 @@
+package sql
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"propagation-tx/internal/recordingdriver"
+	"testing"
+)
+
+type orderService struct {
+	Place func(ctx context.Context, ids ...int) (int, error)
+	Quote func(ctx context.Context, id int) (int, error)
+	Count func() int
+	Name  string
+}
+
+type orderRepository interface {
+	Place(ctx context.Context, id int) error
+}
+
+func TestTransactional_Statements(t *testing.T) {
+	d := &recordingdriver.Driver{}
+	manager := newRecordingManager(t, d)
+	impl := orderService{
+		Place: func(ctx context.Context, ids ...int) (int, error) {
+			for _, id := range ids {
+				manager.GetDB(ctx).Exec("INSERT INTO orders (id) VALUES (?)", id)
+			}
+			if len(ids) == 0 {
+				return 0, mockErr
+			}
+			return len(ids), nil
+		},
+		Quote: func(ctx context.Context, id int) (int, error) {
+			return id * 10, nil
+		},
+	}
+	svc, err := Transactional(impl, manager, map[string]TxRule{"Place": {PropagationRequired}, "Quote": {PropagationMandatory}})
+	assert.NoError(t, err)
+
+	n, err := svc.Place(context.Background(), 1, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	n, err = svc.Place(context.Background())
+	assert.ErrorIs(t, err, mockErr)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, []string{"BEGIN", "INSERT INTO orders (id) VALUES (?)", "INSERT INTO orders (id) VALUES (?)", "COMMIT",
+		"BEGIN", "ROLLBACK"}, d.Statements())
+
+	// the method doesn't run when its propagation fails
+	quote, err := svc.Quote(context.Background(), 1)
+	assert.ErrorIs(t, err, ErrMandatoryPropWithoutTransaction)
+	assert.Equal(t, 0, quote)
+	quote, err = impl.Quote(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, quote)
+}
+
+func TestTransactional_Errors(t *testing.T) {
+	manager := newRecordingManager(t, &recordingdriver.Driver{})
+	var repository orderRepository
+	_, err := Transactional(repository, manager, nil)
+	assert.ErrorIs(t, err, ErrNotTransactional)
+
+	impl := orderService{Count: func() int { return 1 }}
+	for _, name := range []string{"Cancel", "Name", "Place", "Count"} {
+		svc, err := Transactional(impl, manager, map[string]TxRule{name: {PropagationRequired}})
+		assert.ErrorIs(t, err, ErrNotTransactional, name)
+		assert.Equal(t, 1, svc.Count())
+	}
+}
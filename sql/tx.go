@@ -0,0 +1,65 @@
+package sql
+
+import (
+	"context"
+	stdsql "database/sql"
+	"gorm.io/gorm"
+)
+
+// Tx is the transaction given to the bizFn of TransactionTx, for repositories not written with gorm. The
+// statements of Exec and Query go through gorm, so the features of the manager (stats, guardrails, read-only
+// enforcement...) apply to them; SQLTx gives the *sql.Tx for libraries built on database/sql, e.g.
+// &sqlx.Tx{Tx: tx.SQLTx(), Mapper: mapper}. The TransactionTx of the stdsql and sqlxtx managers give a Tx running
+// on database/sql and sqlx instead, so such repositories run with or without gorm.
+type Tx interface {
+	// GormDB return the gorm.DB of the transaction, nil for the Tx of the stdsql and sqlxtx managers
+	GormDB() *gorm.DB
+	// SQLTx return the *sql.Tx of the transaction, nil when bizFn runs without transaction (e.g.
+	// PropagationNotSupported) or the connection pool isn't database/sql
+	SQLTx() *stdsql.Tx
+	// Exec executes a statement and return the rows it affected
+	Exec(query string, args ...interface{}) (int64, error)
+	// Query executes a query, the rows must be closed
+	Query(query string, args ...interface{}) (*stdsql.Rows, error)
+}
+
+// gormTx is the Tx of a gorm.DB
+type gormTx struct {
+	db *gorm.DB
+}
+
+// WrapTx return the Tx of the tx given to a bizFn
+func WrapTx(tx *gorm.DB) Tx {
+	return gormTx{db: tx}
+}
+
+func (t gormTx) GormDB() *gorm.DB {
+	return t.db
+}
+
+func (t gormTx) SQLTx() *stdsql.Tx {
+	switch pool := t.db.Statement.ConnPool.(type) {
+	case *stdsql.Tx:
+		return pool
+	case *gorm.PreparedStmtTX:
+		sqlTx, _ := pool.Tx.(*stdsql.Tx)
+		return sqlTx
+	}
+	return nil
+}
+
+func (t gormTx) Exec(query string, args ...interface{}) (int64, error) {
+	result := t.db.Exec(query, args...)
+	return result.RowsAffected, result.Error
+}
+
+func (t gormTx) Query(query string, args ...interface{}) (*stdsql.Rows, error) {
+	return t.db.Raw(query, args...).Rows()
+}
+
+// TransactionTx is tm.Transaction with a bizFn taking a Tx rather than a *gorm.DB
+func TransactionTx(ctx context.Context, tm TransactionManager, bizFn func(ctx context.Context, tx Tx) error, opts ...TxOption) error {
+	return tm.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+		return bizFn(ctx, WrapTx(tx))
+	}, opts...)
+}
@@ -0,0 +1,91 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	"gorm.io/gorm"
+	"sync"
+)
+
+// TxGroupMode is how the tasks of a TxGroup use transactions
+type TxGroupMode int8
+
+const (
+	TxGroupShared      TxGroupMode = iota // 在当前事务中执行，任务之间串行访问事务
+	TxGroupRequiresNew                    // 每个任务在各自的新事务中并发执行
+)
+
+// TxGroup runs tasks on goroutines of a transaction, the safe alternative to handing its tx to goroutines:
+//
+//	group := sql.NewTxGroup(ctx, tm, sql.TxGroupRequiresNew)
+//	for _, item := range items {
+//		item := item
+//		group.Go(func(ctx context.Context, tx *gorm.DB) error { return tx.Create(item).Error })
+//	}
+//	err := group.Wait()
+//
+// With TxGroupShared the tasks join the transaction of ctx (PropagationMandatory) one at a time, so the work around
+// the statements runs concurrently while the tx is used by a single goroutine; the caller must not use the tx
+// until Wait returns. With TxGroupRequiresNew every task runs in a transaction of its own, beside the transaction
+// of ctx which isn't suspended. The tasks are linked: the ctx of the others is canceled once one fails, so the
+// transactions not committed yet roll back.
+type TxGroup struct {
+	tm     TransactionManager
+	ctx    context.Context
+	cancel context.CancelFunc
+	mode   TxGroupMode
+	wg     sync.WaitGroup
+	// shared serializes the tasks of TxGroupShared
+	shared  sync.Mutex
+	errOnce sync.Once
+	err     error
+}
+
+// NewTxGroup return a TxGroup running tasks with tm from ctx
+func NewTxGroup(ctx context.Context, tm TransactionManager, mode TxGroupMode) *TxGroup {
+	g := &TxGroup{tm: tm, mode: mode}
+	if mode == TxGroupRequiresNew {
+		// the transaction of ctx is hidden rather than suspended, suspending it from several goroutines isn't safe
+		ctx = context.WithValue(ctx, transactionKeyOf(tm.GetOriginDB()), nil)
+	}
+	g.ctx, g.cancel = context.WithCancel(ctx)
+	return g
+}
+
+// Go runs fn on a new goroutine, a panic of fn is recovered as its error
+func (g *TxGroup) Go(fn func(ctx context.Context, tx *gorm.DB) error) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		if err := g.run(fn); err != nil {
+			g.errOnce.Do(func() {
+				g.err = err
+				g.cancel()
+			})
+		}
+	}()
+}
+
+func (g *TxGroup) run(fn func(ctx context.Context, tx *gorm.DB) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("tx group task panic: %v", r)
+		}
+	}()
+	if g.mode == TxGroupRequiresNew {
+		return g.tm.Transaction(g.ctx, fn, PropagationRequiresNew)
+	}
+	g.shared.Lock()
+	defer g.shared.Unlock()
+	if err := g.ctx.Err(); err != nil {
+		return err
+	}
+	return g.tm.Transaction(g.ctx, fn, PropagationMandatory)
+}
+
+// Wait waits for the tasks and return the first error
+func (g *TxGroup) Wait() error {
+	g.wg.Wait()
+	g.cancel()
+	return g.err
+}
@@ -0,0 +1,119 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+)
+
+var ErrResourceBound = errors.New("resource already bound to the transaction")
+
+// txResourcesKey is the key of the TxResources of a root transaction
+type txResourcesKey struct{}
+
+// TxResources are the values bound to a root transaction (a message producer, a Redis pipeline...), so the
+// repositories called within the transaction share them without globals. A PropagationRequiresNew block gets the
+// TxResources of its own transaction, a block without transaction none.
+type TxResources struct {
+	mu       sync.Mutex
+	values   map[interface{}]interface{}
+	cleanups []boundResourceCleanup
+}
+
+type boundResourceCleanup struct {
+	key     interface{}
+	cleanup func(ctx context.Context, value interface{})
+}
+
+// TxResourcesOf return the TxResources of the root transaction of ctx, false if ctx is not in transaction
+func TxResourcesOf(ctx context.Context) (*TxResources, bool) {
+	txCtx, ok := currentTransaction(ctx)
+	if !ok {
+		return nil, false
+	}
+	return txCtx.boundValue(txResourcesKey{}, func() interface{} {
+		return &TxResources{values: make(map[interface{}]interface{})}
+	}).(*TxResources), true
+}
+
+// Bind binds value to key until the root transaction completes, then cleanup (if not nil) is called with it,
+// whether the transaction committed or rolled back. Keys are compared like the keys of context.WithValue.
+func (r *TxResources) Bind(key, value interface{}, cleanup func(ctx context.Context, value interface{})) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exist := r.values[key]; exist {
+		return ErrResourceBound
+	}
+	r.values[key] = value
+	if cleanup != nil {
+		r.cleanups = append(r.cleanups, boundResourceCleanup{key: key, cleanup: cleanup})
+	}
+	return nil
+}
+
+// Get return the value bound to key
+func (r *TxResources) Get(key interface{}) (interface{}, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	value, exist := r.values[key]
+	return value, exist
+}
+
+// GetOrBind return the value bound to key, bound with create and cleanup on first access
+func (r *TxResources) GetOrBind(key interface{}, create func() interface{}, cleanup func(ctx context.Context, value interface{})) interface{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if value, exist := r.values[key]; exist {
+		return value
+	}
+	value := create()
+	r.values[key] = value
+	if cleanup != nil {
+		r.cleanups = append(r.cleanups, boundResourceCleanup{key: key, cleanup: cleanup})
+	}
+	return value
+}
+
+// Unbind removes the value bound to key and return it, its cleanup isn't called
+func (r *TxResources) Unbind(key interface{}) (interface{}, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	value, exist := r.values[key]
+	if !exist {
+		return nil, false
+	}
+	delete(r.values, key)
+	for i, c := range r.cleanups {
+		if c.key == key {
+			r.cleanups = append(r.cleanups[:i], r.cleanups[i+1:]...)
+			break
+		}
+	}
+	return value, true
+}
+
+// unbindTxResources cleans the TxResources of the root transaction c up once it completed, in the reverse order
+// of their binding
+func (c *transactionContext) unbindTxResources() {
+	r, ok := c.values[txResourcesKey{}].(*TxResources)
+	if !ok {
+		return
+	}
+	r.mu.Lock()
+	values, cleanups := r.values, r.cleanups
+	r.values, r.cleanups = make(map[interface{}]interface{}), nil
+	r.mu.Unlock()
+	for i := len(cleanups) - 1; i >= 0; i-- {
+		c.cleanupTxResource(cleanups[i], values[cleanups[i].key])
+	}
+}
+
+func (c *transactionContext) cleanupTxResource(bound boundResourceCleanup, value interface{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[TX] cleanup of resource %v panic: %v", bound.key, r)
+		}
+	}()
+	bound.cleanup(c.ctx, value)
+}
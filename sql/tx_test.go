@@ -0,0 +1,37 @@
+package sql
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"propagation-tx/internal/recordingdriver"
+	"testing"
+)
+
+func TestTransactionTx(t *testing.T) {
+	d := &recordingdriver.Driver{}
+	manager := newRecordingManager(t, d)
+	err := TransactionTx(context.Background(), manager, func(ctx context.Context, tx Tx) error {
+		assert.Same(t, manager.GetDB(ctx), tx.GormDB())
+		assert.NotNil(t, tx.SQLTx())
+		n, err := tx.Exec("UPDATE users SET age = ?", 1)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+		rows, err := tx.Query("SELECT id FROM users")
+		assert.NoError(t, err)
+		assert.False(t, rows.Next())
+		assert.NoError(t, rows.Close())
+		return TransactionTx(ctx, manager, func(ctx context.Context, tx Tx) error {
+			assert.Nil(t, tx.SQLTx())
+			return nil
+		}, PropagationNotSupported)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"BEGIN", "UPDATE users SET age = ?", "SELECT id FROM users", "COMMIT"}, d.Statements())
+
+	err = manager.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+		_, err := WrapTx(tx).Exec("UPDATE users SET age = ?", 2)
+		return err
+	})
+	assert.NoError(t, err)
+}
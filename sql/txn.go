@@ -0,0 +1,155 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+)
+
+var ErrTxnCompleted = errors.New("transaction already committed or rolled back")
+
+// errTxnRollback completes the call of a Txn rolled back
+var errTxnRollback = errors.New("transaction rolled back")
+
+// Txn is a call of TransactionManager.Begin, it's completed by Commit or Rollback exactly like the bizFn of
+// Transaction returning nil or an error. Rollback after Commit is a no-op, so it can be deferred:
+//
+//	txn, err := tm.Begin(ctx)
+//	if err != nil {
+//		return err
+//	}
+//	defer txn.Rollback()
+//	if err := txn.DB().Create(&user).Error; err != nil {
+//		return err
+//	}
+//	return txn.Commit()
+//
+// The hooks of the transaction run on the goroutine of the call until Commit or Rollback returns, and a Txn must
+// be completed, otherwise its transaction and connection are never released. A Txn joining an ambient
+// transaction leaves its completion to the ambient call.
+type Txn struct {
+	m         *transactionManager
+	ctx       context.Context
+	tx        *gorm.DB
+	decision  chan error
+	done      chan txnResult
+	completed bool
+}
+
+type txnResult struct {
+	err      error
+	panicked bool
+	panicVal interface{}
+}
+
+func (m *transactionManager) Begin(ctx context.Context, opts ...TxOption) (*Txn, error) {
+	o := m.newTxOptions(opts)
+	if m.guardrails != nil {
+		o.callsite = callsite()
+	}
+	if o.name == "" && (m.callerNames || len(m.interceptors) > 0) {
+		o.name = callerName()
+	}
+	txn := &Txn{m: m, decision: make(chan error), done: make(chan txnResult, 1)}
+	started := make(chan struct{})
+	go func() {
+		result := txnResult{panicked: true}
+		defer func() {
+			if result.panicked {
+				result.panicVal = recover()
+			}
+			txn.done <- result
+		}()
+		result.err = m.transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+			txn.ctx, txn.tx = ctx, tx
+			close(started)
+			return <-txn.decision
+		}, o)
+		result.panicked = false
+	}()
+	select {
+	case <-started:
+		return txn, nil
+	case result := <-txn.done:
+		// the call failed before running its body
+		txn.completed = true
+		if result.panicked {
+			panic(result.panicVal)
+		}
+		if result.err == nil {
+			result.err = ErrTxnCompleted
+		}
+		return nil, result.err
+	}
+}
+
+// Context return the context of the transaction, to pass down to the code running in it
+func (t *Txn) Context() context.Context {
+	return t.ctx
+}
+
+// DB return the gorm.DB of the transaction
+func (t *Txn) DB() *gorm.DB {
+	return t.tx
+}
+
+// Commit completes the call successfully, it return the error of the commit like Transaction does
+func (t *Txn) Commit() error {
+	return t.complete(nil)
+}
+
+// Rollback completes the call rolling its transaction back, it return nil unless the rollback itself fails.
+// It's a no-op once the Txn completed.
+func (t *Txn) Rollback() error {
+	if t.completed {
+		return nil
+	}
+	if err := t.complete(errTxnRollback); err != errTxnRollback {
+		return err
+	}
+	return nil
+}
+
+func (t *Txn) complete(decision error) error {
+	if t.completed {
+		return ErrTxnCompleted
+	}
+	t.completed = true
+	t.decision <- decision
+	result := <-t.done
+	if result.panicked {
+		panic(result.panicVal)
+	}
+	return result.err
+}
+
+// Savepoint creates a savepoint labeled name in the transaction, see RollbackTo
+func (t *Txn) Savepoint(name string) error {
+	if t.completed {
+		return ErrTxnCompleted
+	}
+	txCtx, ok := currentTransaction(t.ctx)
+	if !ok {
+		return ErrNoTransaction
+	}
+	if t.m.savepointsDisabled {
+		return ErrSavepointsDisabled
+	}
+	savepoint := t.m.nextSavepoint(txCtx)
+	if err := savepointDialectOf(txCtx.tx).Savepoint(txCtx.tx, savepoint); err != nil {
+		return err
+	}
+	if err := txCtx.savepointResources(savepoint); err != nil {
+		return err
+	}
+	txCtx.labelSavepoint(name, savepoint)
+	return nil
+}
+
+// RollbackTo rolls the transaction back to the savepoint name, like RollbackToLabel
+func (t *Txn) RollbackTo(name string) error {
+	if t.completed {
+		return ErrTxnCompleted
+	}
+	return RollbackToLabel(t.ctx, name)
+}
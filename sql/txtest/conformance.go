@@ -0,0 +1,130 @@
+package txtest
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"propagation-tx/sql"
+	"sort"
+	"strings"
+)
+
+// propagations are the propagations of the canonical trees
+var propagations = []sql.TransactionPropagation{
+	sql.PropagationRequired,
+	sql.PropagationSupports,
+	sql.PropagationMandatory,
+	sql.PropagationRequiresNew,
+	sql.PropagationNotSupported,
+	sql.PropagationNested,
+	sql.PropagationNever,
+}
+
+// CanonicalTrees return the trees of the conformance report: every propagation alone, inside a Required
+// transaction with its failure swallowed or not, and a mix of them three levels deep
+func CanonicalTrees() []*Node {
+	var trees []*Node
+	for _, p := range propagations {
+		trees = append(trees, &Node{Key: "a", Propagation: p})
+	}
+	for _, p := range propagations {
+		for _, recovered := range []bool{false, true} {
+			trees = append(trees, &Node{Key: "a", Propagation: sql.PropagationRequired, Children: []*Node{
+				{Key: "b", Propagation: p, Recover: recovered},
+				{Key: "c", Propagation: sql.PropagationRequired},
+			}})
+		}
+	}
+	return append(trees, &Node{Key: "a", Propagation: sql.PropagationRequired, Children: []*Node{
+		{Key: "b", Propagation: sql.PropagationNested, Recover: true, Children: []*Node{
+			{Key: "c", Propagation: sql.PropagationRequired},
+		}},
+		{Key: "d", Propagation: sql.PropagationRequiresNew, Recover: true, Children: []*Node{
+			{Key: "e", Propagation: sql.PropagationNested, Recover: true},
+		}},
+		{Key: "f", Propagation: sql.PropagationNotSupported, Recover: true},
+	}})
+}
+
+// Env is the storage of the writes of a conformance run
+type Env struct {
+	// Reset clears the written keys before each run
+	Reset func() error
+	// Write makes the write of a node with the tx given to it
+	Write func(ctx context.Context, tx *gorm.DB, key string) error
+	// Visible return the keys visible outside of any transaction
+	Visible func() ([]string, error)
+}
+
+// ConformanceReport is the outcome of the CanonicalTrees and their Variants on a dialect, in JSON so other
+// implementations of the propagation can be compared to it
+type ConformanceReport struct {
+	Dialect string            `json:"dialect"`
+	Passed  bool              `json:"passed"`
+	Cases   []ConformanceCase `json:"cases"`
+}
+
+// ConformanceCase is the outcome of a tree, see Node.String for the notation of Scenario
+type ConformanceCase struct {
+	Scenario string `json:"scenario"`
+	// Committed are the keys visible after the run
+	Committed []string `json:"committed"`
+	// RolledBack are the keys written but not visible after the run
+	RolledBack []string `json:"rolledBack"`
+	// Savepoints are the keys written in a PropagationNested block inside a transaction, i.e. under a savepoint
+	Savepoints []string `json:"savepoints"`
+	Expected   []string `json:"expected"`
+	Passed     bool     `json:"passed"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// Conformance runs the CanonicalTrees and their Variants with tm on env, it fails only if env does
+func Conformance(tm sql.TransactionManager, env Env) (ConformanceReport, error) {
+	report := ConformanceReport{Dialect: tm.GetOriginDB().Dialector.Name(), Passed: true}
+	for _, canonical := range CanonicalTrees() {
+		for _, tree := range append([]*Node{canonical}, Variants(canonical)...) {
+			c, err := conformanceCase(tm, env, tree)
+			if err != nil {
+				return report, err
+			}
+			report.Passed = report.Passed && c.Passed
+			report.Cases = append(report.Cases, c)
+		}
+	}
+	return report, nil
+}
+
+func conformanceCase(tm sql.TransactionManager, env Env, tree *Node) (ConformanceCase, error) {
+	c := ConformanceCase{Scenario: tree.String(), Expected: Expected(tree)}
+	if err := env.Reset(); err != nil {
+		return c, err
+	}
+	var written []string
+	err := Run(context.Background(), tm, tree, func(ctx context.Context, tx *gorm.DB, key string) error {
+		written = append(written, key)
+		status := sql.TxStatus(ctx)
+		if status.Depth > 0 && status.Propagations[status.Depth] == sql.PropagationNested {
+			c.Savepoints = append(c.Savepoints, key)
+		}
+		return env.Write(ctx, tx, key)
+	})
+	if err != nil {
+		c.Error = err.Error()
+	}
+	visible, err := env.Visible()
+	if err != nil {
+		return c, err
+	}
+	sort.Strings(visible)
+	c.Committed = visible
+	committed := make(map[string]bool, len(visible))
+	for _, key := range visible {
+		committed[key] = true
+	}
+	for _, key := range written {
+		if !committed[key] {
+			c.RolledBack = append(c.RolledBack, key)
+		}
+	}
+	c.Passed = strings.Join(visible, ",") == strings.Join(c.Expected, ",")
+	return c, nil
+}
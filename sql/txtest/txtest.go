@@ -0,0 +1,261 @@
+// Package txtest regression-tests the propagation engine with scripted trees of nested transactions.
+//
+// A Scenario runs its tree once as scripted, then once per node with an error and once per node with a panic
+// injected, and asserts after each run that exactly the writes the propagation semantics keep are visible:
+//
+//	txtest.Scenario{
+//		Manager: tm,
+//		Tree: &txtest.Node{Key: "a", Propagation: sql.PropagationRequired, Children: []*txtest.Node{
+//			{Key: "b", Propagation: sql.PropagationNested, Recover: true},
+//			{Key: "c", Propagation: sql.PropagationRequiresNew},
+//		}},
+//		Reset:   func(t testing.TB) { db.Exec("DELETE FROM kv") },
+//		Write:   func(ctx context.Context, tx *gorm.DB, key string) error { return tx.Create(&KV{Key: key}).Error },
+//		Visible: func(t testing.TB) []string { var keys []string; db.Model(&KV{}).Pluck("key", &keys); return keys },
+//	}.Run(t)
+package txtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"propagation-tx/sql"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var ErrInjected = errors.New("injected failure")
+
+// Failure is the failure injected in a Node once its write and its children ran
+type Failure int8
+
+const (
+	NoFailure Failure = iota // 正常返回
+	FailError                // 返回ErrInjected
+	FailPanic                // panic(ErrInjected)
+)
+
+// Node is a Transaction call of a scripted tree: it writes Key, runs its Children in order, then fails as Fail
+type Node struct {
+	// Key identifies the write of the node, it must be unique in the tree
+	Key         string
+	Propagation sql.TransactionPropagation
+	Fail        Failure
+	// Recover makes the parent swallow the failure of the node, recovering its panic
+	Recover  bool
+	Children []*Node
+}
+
+func (n *Node) String() string {
+	var children []string
+	for _, child := range n.Children {
+		children = append(children, child.String())
+	}
+	s := fmt.Sprintf("%s:%s", n.Key, n.Propagation)
+	switch n.Fail {
+	case FailError:
+		s += "!error"
+	case FailPanic:
+		s += "!panic"
+	}
+	if n.Recover {
+		s += "?"
+	}
+	if len(children) > 0 {
+		s += "(" + strings.Join(children, ",") + ")"
+	}
+	return s
+}
+
+// clone deep copies the tree of n
+func (n *Node) clone() *Node {
+	c := *n
+	c.Children = make([]*Node, len(n.Children))
+	for i, child := range n.Children {
+		c.Children[i] = child.clone()
+	}
+	return &c
+}
+
+// walk calls fn on the nodes of the tree of n in preorder
+func (n *Node) walk(fn func(n *Node)) {
+	fn(n)
+	for _, child := range n.Children {
+		child.walk(fn)
+	}
+}
+
+// Variants return copies of tree with a failure injected in one node, an error and a panic for every node
+func Variants(tree *Node) []*Node {
+	var keys []string
+	tree.walk(func(n *Node) { keys = append(keys, n.Key) })
+	var variants []*Node
+	for _, key := range keys {
+		for _, fail := range []Failure{FailError, FailPanic} {
+			variant := tree.clone()
+			variant.walk(func(n *Node) {
+				if n.Key == key {
+					n.Fail = fail
+				}
+			})
+			variants = append(variants, variant)
+		}
+	}
+	return variants
+}
+
+// Run runs tree with tm from ctx, write makes the write of a node with the tx given to it.
+// It return the failure escaping the tree, a panic is recovered as ErrInjected.
+func Run(ctx context.Context, tm sql.TransactionManager, tree *Node, write func(ctx context.Context, tx *gorm.DB, key string) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: panic %v", ErrInjected, r)
+		}
+	}()
+	return run(ctx, tm, tree, write)
+}
+
+func run(ctx context.Context, tm sql.TransactionManager, node *Node, write func(ctx context.Context, tx *gorm.DB, key string) error) error {
+	return tm.Transaction(ctx, func(ctx context.Context, tx *gorm.DB) error {
+		if err := write(ctx, tx, node.Key); err != nil {
+			return err
+		}
+		for _, child := range node.Children {
+			if err := runChild(ctx, tm, child, write); err != nil && !child.Recover {
+				return err
+			}
+		}
+		switch node.Fail {
+		case FailError:
+			return ErrInjected
+		case FailPanic:
+			panic(ErrInjected)
+		}
+		return nil
+	}, node.Propagation)
+}
+
+func runChild(ctx context.Context, tm sql.TransactionManager, child *Node, write func(ctx context.Context, tx *gorm.DB, key string) error) (err error) {
+	if child.Recover {
+		defer func() {
+			if r := recover(); r != nil {
+				err = ErrInjected
+			}
+		}()
+	}
+	return run(ctx, tm, child, write)
+}
+
+// txModel is a transaction of the model of the propagation semantics
+type txModel struct {
+	writes []string
+}
+
+// model is the visible state of the database in the model of the propagation semantics
+type model struct {
+	visible []string
+}
+
+// Expected return the keys visible once tree ran outside of any transaction, sorted
+func Expected(tree *Node) []string {
+	m := &model{}
+	m.call(tree, nil)
+	sort.Strings(m.visible)
+	return m.visible
+}
+
+// call runs node with the ambient transaction tx (nil outside of transaction), it tells whether node failed
+func (m *model) call(node *Node, tx *txModel) bool {
+	switch node.Propagation {
+	case sql.PropagationRequired:
+		if tx != nil {
+			return m.body(node, tx)
+		}
+		return m.root(node)
+	case sql.PropagationSupports:
+		return m.body(node, tx)
+	case sql.PropagationMandatory:
+		if tx == nil {
+			return true
+		}
+		return m.body(node, tx)
+	case sql.PropagationRequiresNew:
+		return m.root(node)
+	case sql.PropagationNotSupported:
+		return m.body(node, nil)
+	case sql.PropagationNested:
+		if tx == nil {
+			return m.root(node)
+		}
+		mark := len(tx.writes)
+		failed := m.body(node, tx)
+		if failed {
+			tx.writes = tx.writes[:mark]
+		}
+		return failed
+	case sql.PropagationNever:
+		if tx != nil {
+			return true
+		}
+		return m.body(node, nil)
+	default:
+		panic("not supported propagation")
+	}
+}
+
+// root runs node in a new root transaction, committed unless node failed
+func (m *model) root(node *Node) bool {
+	tx := &txModel{}
+	failed := m.body(node, tx)
+	if !failed {
+		m.visible = append(m.visible, tx.writes...)
+	}
+	return failed
+}
+
+// body runs the write, the children and the failure of node in tx, writes outside of transaction are visible
+// at once
+func (m *model) body(node *Node, tx *txModel) bool {
+	if tx != nil {
+		tx.writes = append(tx.writes, node.Key)
+	} else {
+		m.visible = append(m.visible, node.Key)
+	}
+	for _, child := range node.Children {
+		if m.call(child, tx) && !child.Recover {
+			return true
+		}
+	}
+	return node.Fail != NoFailure
+}
+
+// Scenario checks the visible state of a Tree and its Variants against their Expected keys
+type Scenario struct {
+	Manager sql.TransactionManager
+	Tree    *Node
+	// Reset clears the written keys before each run
+	Reset func(t testing.TB)
+	// Write makes the write of a node with the tx given to it
+	Write func(ctx context.Context, tx *gorm.DB, key string) error
+	// Visible return the keys visible outside of any transaction
+	Visible func(t testing.TB) []string
+}
+
+// Run runs the Tree and its Variants in a subtest each
+func (s Scenario) Run(t *testing.T) {
+	for _, tree := range append([]*Node{s.Tree}, Variants(s.Tree)...) {
+		tree := tree
+		t.Run(tree.String(), func(t *testing.T) {
+			s.Reset(t)
+			defer s.Reset(t)
+			_ = Run(context.Background(), s.Manager, tree, s.Write)
+			visible := s.Visible(t)
+			sort.Strings(visible)
+			if expected := Expected(tree); strings.Join(visible, ",") != strings.Join(expected, ",") {
+				t.Errorf("visible keys %v, expected %v", visible, expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package txtest
+
+import (
+	"github.com/stretchr/testify/assert"
+	"propagation-tx/sql"
+	"testing"
+)
+
+func TestExpected(t *testing.T) {
+	tree := &Node{Key: "a", Propagation: sql.PropagationRequired, Children: []*Node{
+		{Key: "b", Propagation: sql.PropagationNested, Fail: FailError, Recover: true},
+		{Key: "c", Propagation: sql.PropagationRequiresNew},
+		{Key: "d", Propagation: sql.PropagationNotSupported},
+	}}
+	assert.Equal(t, []string{"a", "c", "d"}, Expected(tree))
+
+	tree.Fail = FailPanic
+	assert.Equal(t, []string{"c", "d"}, Expected(tree))
+
+	tree.Fail = NoFailure
+	tree.Children[0].Recover = false
+	assert.Empty(t, Expected(tree))
+
+	never := &Node{Key: "a", Propagation: sql.PropagationRequired, Children: []*Node{
+		{Key: "b", Propagation: sql.PropagationNever, Recover: true},
+	}}
+	assert.Equal(t, []string{"a"}, Expected(never))
+}
+
+func TestVariants(t *testing.T) {
+	tree := &Node{Key: "a", Propagation: sql.PropagationRequired, Children: []*Node{
+		{Key: "b", Propagation: sql.PropagationNested},
+	}}
+	variants := Variants(tree)
+	assert.Len(t, variants, 4)
+	assert.Equal(t, "a:Required!error(b:Nested)", variants[0].String())
+	assert.Equal(t, "a:Required(b:Nested!panic)", variants[3].String())
+	assert.Equal(t, NoFailure, tree.Fail)
+}
@@ -0,0 +1,161 @@
+package sql
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"log"
+	"runtime"
+	"sync"
+	"time"
+)
+
+var ErrWatchdogRollback = errors.New("transaction rolled back by the watchdog")
+
+// ErrInvalidWatchdog is returned by the transactions of a manager whose Watchdog has no positive Threshold
+var ErrInvalidWatchdog = errors.New("watchdog threshold must be positive")
+
+// Watchdog watches the open root transactions of a manager and reports the ones open for longer than Threshold
+type Watchdog struct {
+	Threshold time.Duration
+	// Interval is the period of the checks, Threshold/2 if 0
+	Interval time.Duration
+	// OnLongRunning is called once with every transaction past Threshold, e.g. to count them in a metric.
+	// They are logged anyway.
+	OnLongRunning func(tx LongRunningTransaction)
+	// ForceRollback rolls the transactions past Threshold back, their next statements fail with sql.ErrTxDone
+	// and their commit with ErrWatchdogRollback
+	ForceRollback bool
+	// CaptureStack records the stack of the goroutine beginning every root transaction for the reports, it costs a
+	// 4 KB capture per transaction
+	CaptureStack bool
+}
+
+// LongRunningTransaction is a root transaction open for longer than the Threshold of the Watchdog
+type LongRunningTransaction struct {
+	Info      TransactionInfo
+	StartedAt time.Time
+	Age       time.Duration
+	// Stack is the stack of the goroutine which began the transaction, empty without CaptureStack
+	Stack string
+}
+
+type watchedTransaction struct {
+	txCtx    *transactionContext
+	info     TransactionInfo
+	stack    string
+	reported bool
+}
+
+type watchdog struct {
+	Watchdog
+	mu       sync.Mutex
+	open     map[*transactionContext]*watchedTransaction
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// WithWatchdog watches the root transactions of the manager with watchdog, its checks run on a goroutine started
+// with the manager until StopWatchdog
+func WithWatchdog(watchdog Watchdog) ManagerOption {
+	return func(m *transactionManager) {
+		if watchdog.Threshold <= 0 {
+			m.configErr = ErrInvalidWatchdog
+			return
+		}
+		m.watchdog = newWatchdog(watchdog)
+	}
+}
+
+// StopWatchdog stops the checks of the watchdog of tm, if it has one
+func StopWatchdog(tm TransactionManager) {
+	if m, ok := tm.(*transactionManager); ok && m.watchdog != nil {
+		m.watchdog.stopOnce.Do(func() {
+			close(m.watchdog.done)
+		})
+	}
+}
+
+func newWatchdog(config Watchdog) *watchdog {
+	if config.Interval <= 0 {
+		config.Interval = config.Threshold / 2
+	}
+	return &watchdog{Watchdog: config, open: make(map[*transactionContext]*watchedTransaction), done: make(chan struct{})}
+}
+
+// watch starts watching the root transaction txCtx, until the returned func is called
+func (w *watchdog) watch(txCtx *transactionContext, info TransactionInfo) func() {
+	watched := &watchedTransaction{txCtx: txCtx, info: info}
+	if w.CaptureStack {
+		stack := make([]byte, 4096)
+		watched.stack = string(stack[:runtime.Stack(stack, false)])
+	}
+	w.mu.Lock()
+	w.open[txCtx] = watched
+	w.mu.Unlock()
+	return func() {
+		w.mu.Lock()
+		delete(w.open, txCtx)
+		w.mu.Unlock()
+	}
+}
+
+// run checks the open transactions every Interval of the clock of m until the watchdog is stopped
+func (w *watchdog) run(m *transactionManager) {
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-m.clock.After(w.Interval):
+			w.check(m.clock.Now())
+		}
+	}
+}
+
+func (w *watchdog) check(now time.Time) {
+	var longRunning []*watchedTransaction
+	w.mu.Lock()
+	for _, watched := range w.open {
+		if !watched.reported && now.Sub(watched.txCtx.startedAt) > w.Threshold {
+			watched.reported = true
+			longRunning = append(longRunning, watched)
+		}
+	}
+	w.mu.Unlock()
+	for _, watched := range longRunning {
+		tx := LongRunningTransaction{
+			Info:      watched.info,
+			StartedAt: watched.txCtx.startedAt,
+			Age:       now.Sub(watched.txCtx.startedAt),
+			Stack:     watched.stack,
+		}
+		if tx.Stack != "" {
+			log.Printf("[TX] transaction %s open for %s, begun at:\n%s", tx.Info, tx.Age, tx.Stack)
+		} else {
+			log.Printf("[TX] transaction %s open for %s", tx.Info, tx.Age)
+		}
+		if w.OnLongRunning != nil {
+			w.OnLongRunning(tx)
+		}
+		if w.ForceRollback {
+			watched.txCtx.forceRollback()
+		}
+	}
+}
+
+// forceRollback rolls the root transaction c back from another goroutine than the one running it,
+// database/sql makes the rollback safe while statements run
+func (c *transactionContext) forceRollback() {
+	committer, ok := c.tx.Statement.ConnPool.(gorm.TxCommitter)
+	if !ok {
+		return
+	}
+	c.watchdogRollback.Store(true)
+	if err := committer.Rollback(); err != nil {
+		log.Println("[TX] watchdog rollback error: ", err)
+	}
+}
+
+// watchdogRolledBack tells whether the watchdog rolled the root transaction c back
+func (c *transactionContext) watchdogRolledBack() bool {
+	return c.watchdogRollback.Load()
+}
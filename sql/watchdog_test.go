@@ -0,0 +1,48 @@
+package sql
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"propagation-tx/internal/recordingdriver"
+	"testing"
+	"time"
+)
+
+func TestWithWatchdog(t *testing.T) {
+	clock := newFakeClock()
+	reported := make(chan LongRunningTransaction, 1)
+	d := &recordingdriver.Driver{}
+	manager := newRecordingManager(t, d, WithWatchdog(Watchdog{
+		Threshold:     time.Minute,
+		OnLongRunning: func(tx LongRunningTransaction) { reported <- tx },
+		ForceRollback: true,
+		CaptureStack:  true,
+	}), WithClock(clock))
+	defer StopWatchdog(manager)
+
+	err := manager.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+		// the checks run every Threshold/2 of the clock given after the watchdog
+		clock.WaitForWaiter()
+		clock.Advance(30 * time.Second)
+		clock.WaitForWaiter()
+		assert.Empty(t, reported)
+		clock.Advance(31 * time.Second)
+		longRunning := <-reported
+		assert.Equal(t, TxID(ctx), longRunning.Info.ID)
+		assert.Equal(t, 61*time.Second, longRunning.Age)
+		assert.Contains(t, longRunning.Stack, "TestWithWatchdog")
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrWatchdogRollback)
+	assert.NotContains(t, d.Statements(), "COMMIT")
+}
+
+func TestWithWatchdog_InvalidThreshold(t *testing.T) {
+	manager := newRecordingManager(t, &recordingdriver.Driver{}, WithWatchdog(Watchdog{}))
+	defer StopWatchdog(manager)
+	err := manager.Transaction(context.Background(), func(ctx context.Context, tx *gorm.DB) error {
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrInvalidWatchdog)
+}
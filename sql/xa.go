@@ -0,0 +1,281 @@
+package sql
+
+import (
+	"context"
+	stdsql "database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrXAUnsupported = errors.New("XA transactions are only supported on mysql")
+	// ErrXAInDoubt is wrapped by the CommitError of an XA transaction whose commit decision was logged but some
+	// branches couldn't be committed: they are committed by XATransactionManager.Recover
+	ErrXAInDoubt = errors.New("XA branches in doubt")
+)
+
+// XATransactionManager runs a bizFn in an XA transaction spanning several MySQL datasources, committed with
+// two-phase commit: every branch is prepared (XA PREPARE), then the commit decision is logged in the
+// ptx_xa_decisions table of the first datasource, then every branch is committed (XA COMMIT). A coordinator crashing
+// in between leaves prepared branches, resolved by Recover according to the decision log.
+//
+// bizFn gets a tx per branch, calls of TransactionManagers inside bizFn don't join the branches. The user of the
+// datasources needs the XA_RECOVER_ADMIN privilege for Recover.
+type XATransactionManager struct {
+	coordinator string
+	datasources []*gorm.DB
+	idGenerator IDGenerator
+	clock       Clock
+}
+
+// xaDecision is a row of the decision log, the XA transaction gtrid committed once prepared
+type xaDecision struct {
+	Gtrid     string    `gorm:"column:gtrid;type:varchar(64);primaryKey"`
+	CreatedAt time.Time `gorm:"column:created_at;not null"`
+}
+
+func (d *xaDecision) TableName() string {
+	return "ptx_xa_decisions"
+}
+
+// NewXATransactionManager return the XATransactionManager of the datasources of factories, creating the decision
+// log. coordinator identifies the XA transactions of the manager for Recover, it must be stable across restarts of
+// a process and unique among the processes sharing the datasources, up to 27 letters and digits.
+func NewXATransactionManager(coordinator string, factories ...DBFactory) (*XATransactionManager, error) {
+	if !validCoordinator(coordinator) {
+		return nil, fmt.Errorf("invalid XA coordinator %q", coordinator)
+	}
+	x := &XATransactionManager{coordinator: coordinator, idGenerator: randomIDs{}, clock: systemClock{}}
+	for _, factory := range factories {
+		db := factory.GetOriginDB()
+		if db.Dialector.Name() != "mysql" {
+			return nil, ErrXAUnsupported
+		}
+		x.datasources = append(x.datasources, db)
+	}
+	if len(x.datasources) == 0 {
+		return nil, errors.New("XA transaction without datasource")
+	}
+	if err := x.datasources[0].AutoMigrate(&xaDecision{}); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// validCoordinator tells whether coordinator fits in the 64 bytes of a gtrid with the prefix and the random part
+// of the gtrids, and can't be mistaken for the prefix of another coordinator
+func validCoordinator(coordinator string) bool {
+	if coordinator == "" || len(coordinator) > 27 {
+		return false
+	}
+	for _, r := range coordinator {
+		if !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// xaBranch is the branch of an XA transaction on a datasource
+type xaBranch struct {
+	conn *stdsql.Conn
+	tx   *gorm.DB
+	// xid is the quoted 'gtrid','bqual' of the branch
+	xid   string
+	ended bool
+}
+
+func (b *xaBranch) exec(ctx context.Context, statement string) error {
+	_, err := b.conn.ExecContext(ctx, statement+" "+b.xid)
+	return err
+}
+
+// release gives the connection of the branch back to the pool, or closes it if the branch may still be attached
+func (b *xaBranch) release(clean bool) {
+	if !clean {
+		_ = b.conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+	}
+	_ = b.conn.Close()
+}
+
+// gtridPrefix return the prefix of the gtrids of the manager
+func (x *XATransactionManager) gtridPrefix() string {
+	return "ptx-" + x.coordinator + "-"
+}
+
+// Transaction runs bizFn with the tx of every branch, in the order of the datasources. An error or a panic of bizFn
+// rolls every branch back; a failed prepare does as well and is returned as a *CommitError.
+func (x *XATransactionManager) Transaction(ctx context.Context, bizFn func(ctx context.Context, txs []*gorm.DB) error) (err error) {
+	gtrid := x.gtridPrefix() + x.idGenerator.NewID()
+	branches := make([]*xaBranch, 0, len(x.datasources))
+	clean := false
+	defer func() {
+		for _, b := range branches {
+			b.release(clean)
+		}
+	}()
+	for i, db := range x.datasources {
+		b, err := x.start(ctx, db, gtrid, i)
+		if err != nil {
+			clean = x.abort(branches)
+			return err
+		}
+		branches = append(branches, b)
+	}
+	txs := make([]*gorm.DB, len(branches))
+	for i, b := range branches {
+		txs[i] = b.tx
+	}
+
+	panicked := true
+	defer func() {
+		if panicked {
+			clean = x.abort(branches)
+		}
+	}()
+	err = bizFn(ctx, txs)
+	panicked = false
+	if err != nil {
+		clean = x.abort(branches)
+		return err
+	}
+
+	for _, b := range branches {
+		if err = b.exec(ctx, "XA END"); err == nil {
+			b.ended = true
+			err = b.exec(ctx, "XA PREPARE")
+		}
+		if err != nil {
+			clean = x.abort(branches)
+			return &CommitError{Cause: err}
+		}
+	}
+	// the decision is logged outside of the XA transaction, Recover commits the prepared branches once it's there
+	decision := &xaDecision{Gtrid: gtrid, CreatedAt: x.clock.Now()}
+	if err = x.datasources[0].WithContext(ctx).Create(decision).Error; err != nil {
+		clean = x.abort(branches)
+		return &CommitError{Cause: err}
+	}
+	var inDoubt []string
+	for i, b := range branches {
+		if commitErr := b.exec(ctx, "XA COMMIT"); commitErr != nil {
+			inDoubt = append(inDoubt, fmt.Sprintf("branch %d: %v", i, commitErr))
+		}
+	}
+	clean = true
+	if len(inDoubt) > 0 {
+		return &CommitError{Cause: fmt.Errorf("%w: %s", ErrXAInDoubt, strings.Join(inDoubt, ", "))}
+	}
+	if err := x.datasources[0].WithContext(ctx).Delete(decision).Error; err != nil {
+		log.Printf("[TX] XA transaction %s committed, deleting its decision error: %v", gtrid, err)
+	}
+	return nil
+}
+
+// start begins the branch bqual of gtrid on db
+func (x *XATransactionManager) start(ctx context.Context, db *gorm.DB, gtrid string, bqual int) (*xaBranch, error) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	b := &xaBranch{conn: conn, xid: xid(gtrid, strconv.Itoa(bqual))}
+	if err := b.exec(ctx, "XA START"); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	b.tx = db.Session(&gorm.Session{NewDB: true, Context: ctx})
+	b.tx.Statement.ConnPool = conn
+	return b, nil
+}
+
+// abort rolls the branches back, it tells whether they all did so their connections are clean
+func (x *XATransactionManager) abort(branches []*xaBranch) bool {
+	// the branches must be rolled back even if the ctx of the call is done
+	ctx := context.Background()
+	clean := true
+	for _, b := range branches {
+		if !b.ended {
+			if err := b.exec(ctx, "XA END"); err != nil {
+				log.Printf("[TX] XA END %s error: %v", b.xid, err)
+			}
+		}
+		if err := b.exec(ctx, "XA ROLLBACK"); err != nil {
+			log.Printf("[TX] XA ROLLBACK %s error: %v", b.xid, err)
+			clean = false
+		}
+	}
+	return clean
+}
+
+// Recover resolves the branches of the manager left prepared by a crash, it must run on startup before the manager
+// begins transactions: branches whose commit decision was logged are committed, the others rolled back.
+func (x *XATransactionManager) Recover(ctx context.Context) error {
+	var decided []string
+	if err := x.datasources[0].WithContext(ctx).Model(&xaDecision{}).
+		Where("gtrid LIKE ?", x.gtridPrefix()+"%").Pluck("gtrid", &decided).Error; err != nil {
+		return err
+	}
+	committed := make(map[string]bool, len(decided))
+	for _, gtrid := range decided {
+		committed[gtrid] = true
+	}
+	for _, db := range x.datasources {
+		if err := x.recoverDatasource(ctx, db, committed); err != nil {
+			return err
+		}
+	}
+	if len(decided) == 0 {
+		return nil
+	}
+	return x.datasources[0].WithContext(ctx).Where("gtrid IN ?", decided).Delete(&xaDecision{}).Error
+}
+
+// recoverDatasource resolves the prepared branches of the manager on db
+func (x *XATransactionManager) recoverDatasource(ctx context.Context, db *gorm.DB, committed map[string]bool) error {
+	rows, err := db.WithContext(ctx).Raw("XA RECOVER").Rows()
+	if err != nil {
+		return err
+	}
+	var xids [][2]string
+	for rows.Next() {
+		var formatID, gtridLength, bqualLength int
+		var data []byte
+		if err := rows.Scan(&formatID, &gtridLength, &bqualLength, &data); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		gtrid := string(data[:gtridLength])
+		if strings.HasPrefix(gtrid, x.gtridPrefix()) {
+			xids = append(xids, [2]string{gtrid, string(data[gtridLength : gtridLength+bqualLength])})
+		}
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+	for _, id := range xids {
+		statement := "XA ROLLBACK "
+		if committed[id[0]] {
+			statement = "XA COMMIT "
+		}
+		log.Printf("[TX] recovering XA branch %s: %s", xid(id[0], id[1]), strings.TrimSpace(statement))
+		if err := db.WithContext(ctx).Exec(statement + xid(id[0], id[1])).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// xid return the quoted xid of the branch bqual of gtrid, both made of letters, digits and dashes
+func xid(gtrid, bqual string) string {
+	return "'" + gtrid + "','" + bqual + "'"
+}
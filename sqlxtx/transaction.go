@@ -0,0 +1,52 @@
+// Package sqlxtx implements the propagations of propagation-tx on sqlx, like the stdsql package on database/sql:
+//
+//	tm := sqlxtx.NewSQLXTransactionManager(db)
+//	err := tm.Transaction(ctx, func(ctx context.Context, q sqlxtx.Querier) error {
+//		_, err := q.NamedExecContext(ctx, "INSERT INTO orders (id) VALUES (:id)", order)
+//		return err
+//	}, ptx.PropagationRequired) // ptx "propagation-tx/sql"
+package sqlxtx
+
+import (
+	"context"
+	"database/sql"
+	"github.com/jmoiron/sqlx"
+	"propagation-tx/internal/propagation"
+	ptx "propagation-tx/sql"
+)
+
+// Querier runs the statements of a bizFn: the *sqlx.Tx of its transaction, or the *sqlx.DB without transaction.
+// Named queries returning rows go through sqlx.NamedQueryContext(ctx, q, query, arg).
+type Querier interface {
+	sqlx.ExtContext
+	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	NamedExecContext(ctx context.Context, query string, arg interface{}) (sql.Result, error)
+	PrepareNamedContext(ctx context.Context, query string) (*sqlx.NamedStmt, error)
+}
+
+// TransactionManager runs bizFn with the propagations of the sql package on a *sqlx.DB
+type TransactionManager struct {
+	core *propagation.Manager[*sqlx.Tx, Querier]
+}
+
+func NewSQLXTransactionManager(db *sqlx.DB) *TransactionManager {
+	begin := func(ctx context.Context) (*sqlx.Tx, error) {
+		return db.BeginTxx(ctx, nil)
+	}
+	querier := func(tx *sqlx.Tx) Querier {
+		return tx
+	}
+	return &TransactionManager{core: propagation.New(Querier(db), db, begin, querier)}
+}
+
+// Querier return the *sqlx.Tx of the ambient transaction of ctx, or the *sqlx.DB
+func (m *TransactionManager) Querier(ctx context.Context) Querier {
+	return m.core.Querier(ctx)
+}
+
+// Transaction runs bizFn with propagation, PropagationRequired if none is given. An error or a panic of bizFn rolls
+// back the transaction (or the savepoint) it started, the panic is propagated afterwards.
+func (m *TransactionManager) Transaction(ctx context.Context, bizFn func(ctx context.Context, q Querier) error, propagation ...ptx.TransactionPropagation) error {
+	return m.core.Transaction(ctx, bizFn, propagation...)
+}
@@ -0,0 +1,57 @@
+package sqlxtx
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"propagation-tx/internal/recordingdriver"
+	ptx "propagation-tx/sql"
+	"strings"
+	"testing"
+)
+
+var mockErr = errors.New("mock error")
+
+type order struct {
+	ID int `db:"id"`
+}
+
+func newRecordingManager(t *testing.T) (*TransactionManager, *recordingdriver.Driver) {
+	d := &recordingdriver.Driver{WithArgs: true}
+	return NewSQLXTransactionManager(sqlx.NewDb(sql.OpenDB(d), "mysql")), d
+}
+
+func TestTransactionManager_Transaction(t *testing.T) {
+	tm, d := newRecordingManager(t)
+	ctx := context.Background()
+
+	insert := func(id int) func(ctx context.Context, q Querier) error {
+		return func(ctx context.Context, q Querier) error {
+			_, err := q.NamedExecContext(ctx, "INSERT INTO orders (id) VALUES (:id)", order{ID: id})
+			return err
+		}
+	}
+	err := tm.Transaction(ctx, func(ctx context.Context, q Querier) error {
+		_ = insert(1)(ctx, q)
+		assert.Same(t, q, tm.Querier(ctx))
+		_ = tm.Transaction(ctx, func(ctx context.Context, q Querier) error {
+			_ = insert(2)(ctx, q)
+			return mockErr
+		}, ptx.PropagationNested)
+		assert.ErrorIs(t, tm.Transaction(ctx, insert(3), ptx.PropagationNever), ptx.ErrNeverPropInTransaction)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "BEGIN,INSERT INTO orders (id) VALUES (?) 1,SAVEPOINT sp1,INSERT INTO orders (id) VALUES (?) 2,"+
+		"ROLLBACK TO SAVEPOINT sp1,COMMIT", strings.Join(d.Statements(), ","))
+
+	d.Reset()
+	assert.ErrorIs(t, tm.Transaction(ctx, insert(1), ptx.PropagationMandatory), ptx.ErrMandatoryPropWithoutTransaction)
+	assert.ErrorIs(t, tm.Transaction(ctx, func(ctx context.Context, q Querier) error {
+		_ = insert(1)(ctx, q)
+		return mockErr
+	}), mockErr)
+	assert.Equal(t, "BEGIN,INSERT INTO orders (id) VALUES (?) 1,ROLLBACK", strings.Join(d.Statements(), ","))
+}
@@ -0,0 +1,51 @@
+package sqlxtx
+
+import (
+	"context"
+	"database/sql"
+	"github.com/jmoiron/sqlx"
+	"gorm.io/gorm"
+	ptx "propagation-tx/sql"
+)
+
+// querierTx is the ptx.Tx of a Querier
+type querierTx struct {
+	ctx context.Context
+	q   Querier
+}
+
+// WrapTx return the ptx.Tx running the statements of q with ctx, so the repositories written against ptx.Tx run in
+// the transactions of a TransactionManager. Its GormDB is nil.
+func WrapTx(ctx context.Context, q Querier) ptx.Tx {
+	return querierTx{ctx: ctx, q: q}
+}
+
+func (t querierTx) GormDB() *gorm.DB {
+	return nil
+}
+
+func (t querierTx) SQLTx() *sql.Tx {
+	if tx, ok := t.q.(*sqlx.Tx); ok {
+		return tx.Tx
+	}
+	return nil
+}
+
+func (t querierTx) Exec(query string, args ...interface{}) (int64, error) {
+	result, err := t.q.ExecContext(t.ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (t querierTx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return t.q.QueryContext(t.ctx, query, args...)
+}
+
+// TransactionTx is Transaction with a bizFn taking a ptx.Tx rather than a Querier
+func (m *TransactionManager) TransactionTx(ctx context.Context, bizFn func(ctx context.Context, tx ptx.Tx) error, propagation ...ptx.TransactionPropagation) error {
+	return m.Transaction(ctx, func(ctx context.Context, q Querier) error {
+		return bizFn(ctx, WrapTx(ctx, q))
+	}, propagation...)
+}
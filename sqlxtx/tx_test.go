@@ -0,0 +1,30 @@
+package sqlxtx
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	ptx "propagation-tx/sql"
+	"strings"
+	"testing"
+)
+
+func TestTransactionManager_TransactionTx(t *testing.T) {
+	tm, d := newRecordingManager(t)
+	ctx := context.Background()
+
+	err := tm.TransactionTx(ctx, func(ctx context.Context, tx ptx.Tx) error {
+		assert.Nil(t, tx.GormDB())
+		assert.Same(t, tm.Querier(ctx).(*sqlx.Tx).Tx, tx.SQLTx())
+		n, err := tx.Exec("INSERT INTO orders (id) VALUES (?)", 1)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+		_ = tm.TransactionTx(ctx, func(ctx context.Context, tx ptx.Tx) error {
+			assert.Nil(t, tx.SQLTx())
+			return nil
+		}, ptx.PropagationNotSupported)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "BEGIN,INSERT INTO orders (id) VALUES (?) 1,COMMIT", strings.Join(d.Statements(), ","))
+}
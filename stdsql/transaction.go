@@ -0,0 +1,51 @@
+// Package stdsql implements the propagations of propagation-tx on database/sql, for services not using gorm:
+//
+//	tm := stdsql.NewSQLTransactionManager(db)
+//	err := tm.Transaction(ctx, func(ctx context.Context, q stdsql.Querier) error {
+//		_, err := q.ExecContext(ctx, "INSERT INTO orders (id) VALUES (?)", id)
+//		return err
+//	}, ptx.PropagationRequired) // ptx "propagation-tx/sql"
+//
+// The propagations, their errors and the joining of the ambient transaction through the ctx are the ones of the
+// sql package, PropagationNested uses SAVEPOINT statements.
+package stdsql
+
+import (
+	"context"
+	"database/sql"
+	"propagation-tx/internal/propagation"
+	ptx "propagation-tx/sql"
+)
+
+// Querier runs the statements of a bizFn: the *sql.Tx of its transaction, or the *sql.DB without transaction
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// TransactionManager runs bizFn with the propagations of the sql package on a *sql.DB
+type TransactionManager struct {
+	core *propagation.Manager[*sql.Tx, Querier]
+}
+
+func NewSQLTransactionManager(db *sql.DB) *TransactionManager {
+	begin := func(ctx context.Context) (*sql.Tx, error) {
+		return db.BeginTx(ctx, nil)
+	}
+	querier := func(tx *sql.Tx) Querier {
+		return tx
+	}
+	return &TransactionManager{core: propagation.New(Querier(db), db, begin, querier)}
+}
+
+// Querier return the *sql.Tx of the ambient transaction of ctx, or the *sql.DB
+func (m *TransactionManager) Querier(ctx context.Context) Querier {
+	return m.core.Querier(ctx)
+}
+
+// Transaction runs bizFn with propagation, PropagationRequired if none is given. An error or a panic of bizFn rolls
+// back the transaction (or the savepoint) it started, the panic is propagated afterwards.
+func (m *TransactionManager) Transaction(ctx context.Context, bizFn func(ctx context.Context, q Querier) error, propagation ...ptx.TransactionPropagation) error {
+	return m.core.Transaction(ctx, bizFn, propagation...)
+}
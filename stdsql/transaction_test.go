@@ -0,0 +1,58 @@
+package stdsql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"propagation-tx/internal/recordingdriver"
+	ptx "propagation-tx/sql"
+	"strings"
+	"testing"
+)
+
+var mockErr = errors.New("mock error")
+
+func newRecordingManager(t *testing.T) (*TransactionManager, *recordingdriver.Driver) {
+	d := &recordingdriver.Driver{}
+	db := sql.OpenDB(d)
+	db.SetMaxOpenConns(2)
+	return NewSQLTransactionManager(db), d
+}
+
+func exec(statement string) func(ctx context.Context, q Querier) error {
+	return func(ctx context.Context, q Querier) error {
+		_, err := q.ExecContext(ctx, statement)
+		return err
+	}
+}
+
+func TestTransactionManager_Transaction(t *testing.T) {
+	tm, d := newRecordingManager(t)
+	ctx := context.Background()
+
+	err := tm.Transaction(ctx, func(ctx context.Context, q Querier) error {
+		_ = exec("a")(ctx, q)
+		_ = tm.Transaction(ctx, exec("b"), ptx.PropagationRequired)
+		_ = tm.Transaction(ctx, func(ctx context.Context, q Querier) error {
+			_ = exec("c")(ctx, q)
+			return mockErr
+		}, ptx.PropagationNested)
+		_ = tm.Transaction(ctx, exec("d"), ptx.PropagationNested)
+		assert.ErrorIs(t, tm.Transaction(ctx, exec("e"), ptx.PropagationNever), ptx.ErrNeverPropInTransaction)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "BEGIN,a,b,SAVEPOINT sp1,c,ROLLBACK TO SAVEPOINT sp1,SAVEPOINT sp2,d,RELEASE SAVEPOINT sp2,COMMIT",
+		strings.Join(d.Statements(), ","))
+
+	d.Reset()
+	assert.ErrorIs(t, tm.Transaction(ctx, exec("a"), ptx.PropagationMandatory), ptx.ErrMandatoryPropWithoutTransaction)
+	assert.Panics(t, func() {
+		_ = tm.Transaction(ctx, func(ctx context.Context, q Querier) error {
+			_ = tm.Transaction(ctx, exec("a"), ptx.PropagationNotSupported)
+			panic(mockErr)
+		})
+	})
+	assert.Equal(t, "BEGIN,a,ROLLBACK", strings.Join(d.Statements(), ","))
+}
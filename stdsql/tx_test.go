@@ -0,0 +1,33 @@
+package stdsql
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	ptx "propagation-tx/sql"
+	"strings"
+	"testing"
+)
+
+func TestTransactionManager_TransactionTx(t *testing.T) {
+	tm, d := newRecordingManager(t)
+	ctx := context.Background()
+
+	err := tm.TransactionTx(ctx, func(ctx context.Context, tx ptx.Tx) error {
+		assert.Nil(t, tx.GormDB())
+		assert.Same(t, tm.Querier(ctx), tx.SQLTx())
+		n, err := tx.Exec("a")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+		_ = tm.TransactionTx(ctx, func(ctx context.Context, tx ptx.Tx) error {
+			assert.Nil(t, tx.SQLTx())
+			_, err := tx.Exec("b")
+			return err
+		}, ptx.PropagationNotSupported)
+		return tm.TransactionTx(ctx, func(ctx context.Context, tx ptx.Tx) error {
+			_, _ = tx.Exec("c")
+			return mockErr
+		}, ptx.PropagationNested)
+	})
+	assert.ErrorIs(t, err, mockErr)
+	assert.Equal(t, "BEGIN,a,b,SAVEPOINT sp1,c,ROLLBACK TO SAVEPOINT sp1,ROLLBACK", strings.Join(d.Statements(), ","))
+}